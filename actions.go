@@ -172,6 +172,12 @@ func (a *Actions) concat(o *Actions) *Actions {
 }
 
 type ClientActions struct {
+	// RecoverClients is set only on the first ClientActions after the node starts,
+	// and contains the client states of the most recent checkpoint in the WAL.  The
+	// consumer must restore its client state from these (see ClientProcessor.Recover)
+	// before servicing any other ClientActions.
+	RecoverClients []*pb.NetworkState_Client
+
 	// AllocatedRequests is a set of client request numbers which are eligible for
 	// clients to begin filling.  It is the responsibility of the consumer to ensure
 	// that a client request has been allocated for a particular client's request number,
@@ -191,13 +197,15 @@ type ClientActions struct {
 
 // clear nils out all of the fields.
 func (ca *ClientActions) clear() {
+	ca.RecoverClients = nil
 	ca.AllocatedRequests = nil
 	ca.StoreRequests = nil
 	ca.ForwardRequests = nil
 }
 
 func (ca *ClientActions) isEmpty() bool {
-	return len(ca.AllocatedRequests) == 0 &&
+	return len(ca.RecoverClients) == 0 &&
+		len(ca.AllocatedRequests) == 0 &&
 		len(ca.StoreRequests) == 0 &&
 		len(ca.ForwardRequests) == 0
 }
@@ -205,6 +213,7 @@ func (ca *ClientActions) isEmpty() bool {
 // concat takes a set of actions and for each field, appends it to
 // the corresponding field of itself.
 func (ca *ClientActions) concat(o *ClientActions) *ClientActions {
+	ca.RecoverClients = append(ca.RecoverClients, o.RecoverClients...)
 	ca.AllocatedRequests = append(ca.AllocatedRequests, o.AllocatedRequests...)
 	ca.StoreRequests = append(ca.StoreRequests, o.StoreRequests...)
 	ca.ForwardRequests = append(ca.ForwardRequests, o.ForwardRequests...)
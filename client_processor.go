@@ -9,6 +9,7 @@ package mirbft
 import (
 	"bytes"
 	"container/list"
+	"math"
 	"sync"
 
 	"github.com/pkg/errors"
@@ -23,7 +24,12 @@ type RequestStore interface {
 	PutAllocation(clientID, reqNo uint64, digest []byte) error
 	GetRequest(requestAck *pb.RequestAck) ([]byte, error)
 	PutRequest(requestAck *pb.RequestAck, data []byte) error
+	Truncate(clientID, lowWatermark uint64) error
 	Sync() error
+
+	// Allocations invokes forEach in request number order for each allocation
+	// of the client with a request number in the range [startReqNo, endReqNo).
+	Allocations(clientID, startReqNo, endReqNo uint64, forEach func(reqNo uint64, digest []byte)) error
 }
 
 // ClientProcessor is the client half of the processor components.
@@ -99,7 +105,39 @@ func (cp *ClientProcessor) Client(clientID uint64) *Client {
 	return c
 }
 
+// Recover rebuilds the client state from the RequestStore after a restart.  The
+// clients should be the client states of the most recent checkpoint in the WAL
+// (or, for a new node, of the initial network state), as supplied by the node
+// in ClientActions.RecoverClients.  For each client, any records below the
+// client's low watermark are removed from the store, as they may have outlived
+// an interrupted truncation.  Then, the next request number
+// expected from the client is restored, and the allocated requests at or above
+// the low watermark are re-offered to the state machine via the ClientWork, as
+// they may have been persisted, but never acked before the restart.  The state
+// machine ignores any requests which have already committed, or which are
+// otherwise not in its watermarks.  Process invokes Recover whenever the
+// ClientActions carry RecoverClients, before handling any other client actions.
+func (cp *ClientProcessor) Recover(clients []*pb.NetworkState_Client) error {
+	for _, client := range clients {
+		if err := cp.RequestStore.Truncate(client.Id, client.LowWatermark); err != nil {
+			return errors.WithMessagef(err, "could not truncate client %d", client.Id)
+		}
+
+		if err := cp.Client(client.Id).recover(client.LowWatermark); err != nil {
+			return errors.WithMessagef(err, "could not recover client %d", client.Id)
+		}
+	}
+
+	return nil
+}
+
 func (cp *ClientProcessor) Process(ca *ClientActions) (*ClientActionResults, error) {
+	if len(ca.RecoverClients) > 0 {
+		if err := cp.Recover(ca.RecoverClients); err != nil {
+			return nil, errors.WithMessage(err, "could not recover client state")
+		}
+	}
+
 	results := &ClientActionResults{}
 
 	for _, r := range ca.AllocatedRequests {
@@ -189,6 +227,13 @@ func (c *Client) allocate(reqNo uint64) ([]byte, error) {
 		return clientReq.localAllocationDigest, nil
 	}
 
+	if c.requests.Len() == 0 && reqNo > c.nextReqNo {
+		// With no other knowledge of this client, the first allocation
+		// must be at the client's low watermark, so all prior requests
+		// have already committed.
+		c.nextReqNo = reqNo
+	}
+
 	cr := &clientRequest{
 		reqNo: reqNo,
 	}
@@ -205,6 +250,48 @@ func (c *Client) allocate(reqNo uint64) ([]byte, error) {
 	return digest, nil
 }
 
+// recover loads the allocations for this client at or above the low watermark
+// from the request store, and queues them to be re-offered to the state machine.
+func (c *Client) recover(lowWatermark uint64) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if lowWatermark > c.nextReqNo {
+		c.nextReqNo = lowWatermark
+	}
+
+	var acks []*pb.RequestAck
+	err := c.requestStore.Allocations(c.clientID, lowWatermark, math.MaxUint64, func(reqNo uint64, digest []byte) {
+		acks = append(acks, &pb.RequestAck{
+			ClientId: c.clientID,
+			ReqNo:    reqNo,
+			Digest:   digest,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, ack := range acks {
+		if el, ok := c.reqNoMap[ack.ReqNo]; ok {
+			el.Value.(*clientRequest).localAllocationDigest = ack.Digest
+		} else {
+			c.reqNoMap[ack.ReqNo] = c.requests.PushBack(&clientRequest{
+				reqNo:                 ack.ReqNo,
+				localAllocationDigest: ack.Digest,
+			})
+		}
+
+		if ack.ReqNo >= c.nextReqNo {
+			c.nextReqNo = ack.ReqNo + 1
+		}
+
+		c.clientWork.addPersistedReq(ack)
+	}
+
+	return nil
+}
+
 func (c *Client) NextReqNo() (uint64, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
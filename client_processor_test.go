@@ -0,0 +1,265 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package mirbft_test
+
+import (
+	"crypto"
+	"math"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/IBM/mirbft"
+	pb "github.com/IBM/mirbft/mirbftpb"
+	"github.com/IBM/mirbft/pkg/memstore"
+)
+
+// walEntries is a WALStorage which loads the given entries
+// with indexes starting from 1.
+type walEntries []*pb.Persistent
+
+func (we walEntries) LoadAll(forEach func(index uint64, p *pb.Persistent)) error {
+	for i, p := range we {
+		forEach(uint64(i+1), p)
+	}
+	return nil
+}
+
+var _ = Describe("ClientProcessor", func() {
+	var (
+		reqStore        *memstore.RequestStore
+		clientProcessor *mirbft.ClientProcessor
+	)
+
+	digest := func(clientID, reqNo uint64) []byte {
+		h := crypto.SHA256.New()
+		h.Write(clientReq(clientID, reqNo))
+		return h.Sum(nil)
+	}
+
+	allocations := func(clientID uint64) []uint64 {
+		var reqNos []uint64
+		err := reqStore.Allocations(clientID, 0, math.MaxUint64, func(reqNo uint64, _ []byte) {
+			reqNos = append(reqNos, reqNo)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return reqNos
+	}
+
+	BeforeEach(func() {
+		reqStore = memstore.NewRequestStore()
+		clientProcessor = &mirbft.ClientProcessor{
+			RequestStore: reqStore,
+			Hasher:       crypto.SHA256,
+		}
+	})
+
+	When("recovering a partially committed client", func() {
+		BeforeEach(func() {
+			for reqNo := uint64(0); reqNo < 5; reqNo++ {
+				Expect(reqStore.PutAllocation(1, reqNo, digest(1, reqNo))).To(Succeed())
+			}
+
+			err := clientProcessor.Recover([]*pb.NetworkState_Client{
+				{
+					Id:           1,
+					LowWatermark: 3,
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("removes the allocations below the low watermark", func() {
+			Expect(allocations(1)).To(Equal([]uint64{3, 4}))
+		})
+
+		It("re-offers only the allocations at or above the low watermark", func() {
+			Eventually(clientProcessor.ClientWork.Ready()).Should(BeClosed())
+			results := clientProcessor.ClientWork.Results()
+			Expect(results.PersistedRequests).To(Equal([]*pb.RequestAck{
+				{
+					ClientId: 1,
+					ReqNo:    3,
+					Digest:   digest(1, 3),
+				},
+				{
+					ClientId: 1,
+					ReqNo:    4,
+					Digest:   digest(1, 4),
+				},
+			}))
+		})
+
+		It("expects the request after the last allocation next", func() {
+			nextReqNo, err := clientProcessor.Client(1).NextReqNo()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nextReqNo).To(Equal(uint64(5)))
+		})
+	})
+
+	When("recovering a client with no allocations", func() {
+		BeforeEach(func() {
+			err := clientProcessor.Recover([]*pb.NetworkState_Client{
+				{
+					Id:           2,
+					LowWatermark: 7,
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("does not consider the client to exist until it is allocated", func() {
+			_, err := clientProcessor.Client(2).NextReqNo()
+			Expect(err).To(Equal(mirbft.ErrClientNotExist))
+		})
+
+		It("expects the allocated request number next", func() {
+			_, err := clientProcessor.Process(&mirbft.ClientActions{
+				AllocatedRequests: []mirbft.RequestSlot{
+					{
+						ClientID: 2,
+						ReqNo:    9,
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			nextReqNo, err := clientProcessor.Client(2).NextReqNo()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nextReqNo).To(Equal(uint64(9)))
+		})
+	})
+
+	When("the first allocation for a client is above zero", func() {
+		BeforeEach(func() {
+			_, err := clientProcessor.Process(&mirbft.ClientActions{
+				AllocatedRequests: []mirbft.RequestSlot{
+					{
+						ClientID: 3,
+						ReqNo:    10,
+					},
+					{
+						ClientID: 3,
+						ReqNo:    11,
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("sets the next request number to the first allocation", func() {
+			nextReqNo, err := clientProcessor.Client(3).NextReqNo()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nextReqNo).To(Equal(uint64(10)))
+		})
+
+		It("ignores proposals below the first allocation", func() {
+			client := clientProcessor.Client(3)
+			Expect(client.Propose(4, clientReq(3, 4))).To(Succeed())
+			Expect(allocations(3)).To(BeEmpty())
+
+			Expect(client.Propose(10, clientReq(3, 10))).To(Succeed())
+			Expect(allocations(3)).To(Equal([]uint64{10}))
+
+			nextReqNo, err := client.NextReqNo()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nextReqNo).To(Equal(uint64(11)))
+		})
+
+		It("does not move the next request number for later allocations", func() {
+			_, err := clientProcessor.Process(&mirbft.ClientActions{
+				AllocatedRequests: []mirbft.RequestSlot{
+					{
+						ClientID: 3,
+						ReqNo:    12,
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			nextReqNo, err := clientProcessor.Client(3).NextReqNo()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nextReqNo).To(Equal(uint64(10)))
+		})
+	})
+
+	When("a node restarts from a checkpoint beyond the initial network state", func() {
+		var (
+			node         *mirbft.Node
+			networkState *pb.NetworkState
+		)
+
+		BeforeEach(func() {
+			for reqNo := uint64(0); reqNo < 5; reqNo++ {
+				Expect(reqStore.PutAllocation(1, reqNo, digest(1, reqNo))).To(Succeed())
+			}
+
+			networkState = mirbft.StandardInitialNetworkState(1, 0)
+			networkState.Clients = []*pb.NetworkState_Client{
+				{
+					Id:           1,
+					Width:        100,
+					LowWatermark: 3,
+				},
+			}
+
+			var err error
+			node, err = mirbft.RestartNode(
+				&mirbft.Config{
+					BatchSize:            1,
+					SuspectTicks:         4,
+					HeartbeatTicks:       2,
+					NewEpochTimeoutTicks: 8,
+					BufferSize:           5 * 1024 * 1024, // 5 MB
+					Logger:               mirbft.ConsoleWarnLogger,
+				},
+				walEntries{
+					{
+						Type: &pb.Persistent_CEntry{
+							CEntry: &pb.CEntry{
+								SeqNo:           0,
+								CheckpointValue: []byte("fake-application-state"),
+								NetworkState:    networkState,
+							},
+						},
+					},
+					{
+						Type: &pb.Persistent_FEntry{
+							FEntry: &pb.FEntry{
+								EndsEpochConfig: &pb.EpochConfig{
+									Number:  0,
+									Leaders: networkState.Config.Nodes,
+								},
+							},
+						},
+					},
+				},
+			)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			node.Stop()
+		})
+
+		It("recovers the clients from the checkpoint in the WAL", func() {
+			Expect(node.Tick()).To(Succeed())
+
+			var clientActions mirbft.ClientActions
+			Eventually(node.ClientReady()).Should(Receive(&clientActions))
+			Expect(clientActions.RecoverClients).To(Equal(networkState.Clients))
+
+			_, err := clientProcessor.Process(&clientActions)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(allocations(1)).To(Equal([]uint64{3, 4}))
+
+			nextReqNo, err := clientProcessor.Client(1).NextReqNo()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nextReqNo).To(Equal(uint64(5)))
+		})
+	})
+})
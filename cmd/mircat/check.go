@@ -0,0 +1,245 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	"github.com/IBM/mirbft/pkg/eventlog"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+	"github.com/IBM/mirbft/pkg/statemachine"
+)
+
+// checkArguments are the arguments for the 'check' subcommand, which replays
+// the logs of several nodes and verifies that they agree.
+type checkArguments struct {
+	inputs []io.ReadCloser
+}
+
+// commitRecord is the first commit observed for a sequence number, against
+// which the commits of all other nodes are compared.
+type commitRecord struct {
+	nodeID uint64
+	digest []byte
+}
+
+// checkpointRecord is the first checkpoint observed for a sequence number.
+type checkpointRecord struct {
+	nodeID       uint64
+	value        []byte
+	networkState *pb.NetworkState
+}
+
+// requestKey identifies a request irrespective of its digest.
+type requestKey struct {
+	clientID uint64
+	reqNo    uint64
+}
+
+// agreementChecker accumulates the commits and checkpoints of every node,
+// recording a violation whenever two nodes disagree, or a node's own commits
+// are inconsistent.
+type agreementChecker struct {
+	violations []string
+
+	batches     map[uint64]commitRecord
+	checkpoints map[uint64]checkpointRecord
+	requests    map[requestKey]uint64
+
+	// lastSeqNos is the last contiguously committed sequence number
+	// for each node.
+	lastSeqNos map[uint64]uint64
+}
+
+func newAgreementChecker() *agreementChecker {
+	return &agreementChecker{
+		batches:     map[uint64]commitRecord{},
+		checkpoints: map[uint64]checkpointRecord{},
+		requests:    map[requestKey]uint64{},
+		lastSeqNos:  map[uint64]uint64{},
+	}
+}
+
+func (ac *agreementChecker) violationf(format string, args ...interface{}) {
+	ac.violations = append(ac.violations, fmt.Sprintf(format, args...))
+}
+
+// event inspects the event for state transfers and checkpoint values, and the
+// actions resulting from the event, if any, for commits.
+func (ac *agreementChecker) event(event *rpb.RecordedEvent, actions *pb.StateEventResult) {
+	nodeID := event.NodeId
+
+	switch et := event.StateEvent.Type.(type) {
+	case *pb.StateEvent_Transfer:
+		// After a state transfer, the node resumes committing
+		// immediately after the transferred checkpoint.
+		ac.lastSeqNos[nodeID] = et.Transfer.SeqNo
+	case *pb.StateEvent_AddResults:
+		for _, cr := range et.AddResults.Checkpoints {
+			ac.checkpoint(nodeID, cr)
+		}
+	}
+
+	if actions == nil {
+		return
+	}
+
+	for _, commit := range actions.Commits {
+		if commit.Batch != nil {
+			ac.batch(nodeID, commit.Batch)
+			continue
+		}
+
+		// Otherwise, this is a request to compute the checkpoint
+		if commit.SeqNo > ac.lastSeqNos[nodeID] {
+			ac.violationf("node %d committed checkpoint at seq_no %d but has only committed through seq_no %d", nodeID, commit.SeqNo, ac.lastSeqNos[nodeID])
+		}
+	}
+}
+
+func (ac *agreementChecker) batch(nodeID uint64, batch *pb.QEntry) {
+	lastSeqNo := ac.lastSeqNos[nodeID]
+	switch {
+	case batch.SeqNo > lastSeqNo+1:
+		ac.violationf("node %d committed seq_no %d without committing seq_nos %d through %d", nodeID, batch.SeqNo, lastSeqNo+1, batch.SeqNo-1)
+		ac.lastSeqNos[nodeID] = batch.SeqNo
+	case batch.SeqNo == lastSeqNo+1:
+		ac.lastSeqNos[nodeID] = batch.SeqNo
+	default:
+		// Nodes re-commit sequences after restarting, these
+		// must simply agree with the previous commits.
+	}
+
+	previous, ok := ac.batches[batch.SeqNo]
+	if !ok {
+		ac.batches[batch.SeqNo] = commitRecord{
+			nodeID: nodeID,
+			digest: batch.Digest,
+		}
+
+		for _, request := range batch.Requests {
+			key := requestKey{
+				clientID: request.ClientId,
+				reqNo:    request.ReqNo,
+			}
+			if seqNo, ok := ac.requests[key]; ok {
+				ac.violationf("request client_id=%d req_no=%d committed at seq_no %d and seq_no %d", key.clientID, key.reqNo, seqNo, batch.SeqNo)
+				continue
+			}
+			ac.requests[key] = batch.SeqNo
+		}
+		return
+	}
+
+	if !bytes.Equal(previous.digest, batch.Digest) {
+		ac.violationf("seq_no %d committed with digest %x by node %d but with digest %x by node %d", batch.SeqNo, previous.digest, previous.nodeID, batch.Digest, nodeID)
+	}
+}
+
+func (ac *agreementChecker) checkpoint(nodeID uint64, cr *pb.CheckpointResult) {
+	previous, ok := ac.checkpoints[cr.SeqNo]
+	if !ok {
+		ac.checkpoints[cr.SeqNo] = checkpointRecord{
+			nodeID:       nodeID,
+			value:        cr.Value,
+			networkState: cr.NetworkState,
+		}
+		return
+	}
+
+	if !bytes.Equal(previous.value, cr.Value) {
+		ac.violationf("checkpoint at seq_no %d has value %x at node %d but value %x at node %d", cr.SeqNo, previous.value, previous.nodeID, cr.Value, nodeID)
+	}
+
+	if !proto.Equal(previous.networkState, cr.NetworkState) {
+		ac.violationf("checkpoint at seq_no %d has a different network state at node %d than at node %d", cr.SeqNo, nodeID, previous.nodeID)
+	}
+}
+
+func (ca *checkArguments) close() {
+	for _, input := range ca.inputs {
+		input.Close()
+	}
+}
+
+func (ca *checkArguments) execute(output io.Writer) error {
+	defer ca.close()
+
+	ac := newAgreementChecker()
+	s := newStateMachines(output, statemachine.LevelWarn)
+
+	for i, input := range ca.inputs {
+		if err := ca.replay(input, s, ac); err != nil {
+			return errors.WithMessagef(err, "could not replay input %d", i)
+		}
+	}
+
+	var nodeIDs []uint64
+	for nodeID := range ac.lastSeqNos {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Slice(nodeIDs, func(i, j int) bool {
+		return nodeIDs[i] < nodeIDs[j]
+	})
+
+	for _, nodeID := range nodeIDs {
+		fmt.Fprintf(output, "Node %d committed through seq_no %d\n", nodeID, ac.lastSeqNos[nodeID])
+	}
+
+	for _, violation := range ac.violations {
+		fmt.Fprintf(output, "violation: %s\n", violation)
+	}
+
+	if len(ac.violations) > 0 {
+		return errors.Errorf("logs failed agreement check with %d violations", len(ac.violations))
+	}
+
+	fmt.Fprintf(output, "%d nodes agree on %d batches and %d checkpoints\n", len(s.nodes), len(ac.batches), len(ac.checkpoints))
+	return nil
+}
+
+func (ca *checkArguments) replay(input io.Reader, s *stateMachines, ac *agreementChecker) error {
+	reader, err := eventlog.NewReader(input)
+	if err != nil {
+		return errors.WithMessage(err, "bad input file")
+	}
+
+	index := uint64(0)
+	for {
+		event, err := reader.ReadEvent()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.WithMessage(err, "failed reading input")
+		}
+
+		index++
+
+		if dropped, ok := eventlog.GapMarker(event); ok {
+			return errors.Errorf("cannot replay log, %d events were dropped at index %d", dropped, index)
+		}
+
+		if _, ok := ac.lastSeqNos[event.NodeId]; !ok {
+			ac.lastSeqNos[event.NodeId] = 0
+		}
+
+		actions, err := s.apply(event)
+		if err != nil {
+			return err
+		}
+
+		ac.event(event, actions)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+)
+
+var _ = Describe("Check", func() {
+	var (
+		output *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		output = &bytes.Buffer{}
+	})
+
+	It("parses the inputs", func() {
+		cmd, err := parseArgs([]string{
+			"check",
+			"--input", "main.go",
+			"--input", "check.go",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(BeAssignableToTypeOf(&checkArguments{}))
+		checkArgs := cmd.(*checkArguments)
+		Expect(checkArgs.inputs).To(HaveLen(2))
+		checkArgs.close()
+	})
+
+	It("verifies that the nodes of a recording agree", func() {
+		checkArgs := &checkArguments{
+			inputs: []io.ReadCloser{ioutil.NopCloser(newBasicLog())},
+		}
+		err := checkArgs.execute(output)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.String()).To(ContainSubstring("Node 3 committed through seq_no "))
+		Expect(output.String()).To(MatchRegexp(`4 nodes agree on \d+ batches and \d+ checkpoints`))
+		Expect(output.String()).NotTo(ContainSubstring("violation"))
+	})
+
+	Describe("agreementChecker", func() {
+		var (
+			ac *agreementChecker
+		)
+
+		BeforeEach(func() {
+			ac = newAgreementChecker()
+		})
+
+		commit := func(nodeID, seqNo uint64, digest string, reqNos ...uint64) {
+			batch := &pb.QEntry{
+				SeqNo:  seqNo,
+				Digest: []byte(digest),
+			}
+			for _, reqNo := range reqNos {
+				batch.Requests = append(batch.Requests, &pb.RequestAck{
+					ClientId: 9,
+					ReqNo:    reqNo,
+				})
+			}
+
+			ac.event(
+				&rpb.RecordedEvent{
+					NodeId: nodeID,
+					StateEvent: &pb.StateEvent{
+						Type: &pb.StateEvent_ActionsReceived{
+							ActionsReceived: &pb.StateEvent_Ready{},
+						},
+					},
+				},
+				&pb.StateEventResult{
+					Commits: []*pb.StateEventResult_Commit{
+						{
+							Batch: batch,
+						},
+					},
+				},
+			)
+		}
+
+		checkpoint := func(nodeID, seqNo uint64, value string) {
+			ac.event(
+				&rpb.RecordedEvent{
+					NodeId: nodeID,
+					StateEvent: &pb.StateEvent{
+						Type: &pb.StateEvent_AddResults{
+							AddResults: &pb.StateEvent_ActionResults{
+								Checkpoints: []*pb.CheckpointResult{
+									{
+										SeqNo: seqNo,
+										Value: []byte(value),
+									},
+								},
+							},
+						},
+					},
+				},
+				nil,
+			)
+		}
+
+		It("accepts consistent commits", func() {
+			commit(0, 1, "a", 1)
+			commit(1, 1, "a", 1)
+			commit(0, 2, "b", 2)
+			commit(0, 1, "a", 1) // re-commit after restart
+			checkpoint(0, 2, "c")
+			checkpoint(1, 2, "c")
+			Expect(ac.violations).To(BeEmpty())
+		})
+
+		It("detects divergent digests", func() {
+			commit(0, 1, "a")
+			commit(1, 1, "b")
+			Expect(ac.violations).To(Equal([]string{
+				"seq_no 1 committed with digest 61 by node 0 but with digest 62 by node 1",
+			}))
+		})
+
+		It("detects divergent checkpoint values", func() {
+			checkpoint(0, 5, "a")
+			checkpoint(2, 5, "b")
+			Expect(ac.violations).To(Equal([]string{
+				"checkpoint at seq_no 5 has value 61 at node 0 but value 62 at node 2",
+			}))
+		})
+
+		It("detects gaps in the committed sequences", func() {
+			commit(0, 1, "a")
+			commit(0, 4, "d")
+			Expect(ac.violations).To(Equal([]string{
+				"node 0 committed seq_no 4 without committing seq_nos 2 through 3",
+			}))
+		})
+
+		It("does not consider a state transfer a gap", func() {
+			ac.event(
+				&rpb.RecordedEvent{
+					NodeId: 0,
+					StateEvent: &pb.StateEvent{
+						Type: &pb.StateEvent_Transfer{
+							Transfer: &pb.CEntry{SeqNo: 3},
+						},
+					},
+				},
+				nil,
+			)
+			commit(0, 4, "d")
+			Expect(ac.violations).To(BeEmpty())
+		})
+
+		It("detects requests committed twice", func() {
+			commit(0, 1, "a", 1, 2)
+			commit(0, 2, "b", 2, 3)
+			Expect(ac.violations).To(Equal([]string{
+				"request client_id=9 req_no=2 committed at seq_no 1 and seq_no 2",
+			}))
+		})
+	})
+})
@@ -0,0 +1,638 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	"github.com/IBM/mirbft/pkg/eventlog"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+	"github.com/IBM/mirbft/pkg/statemachine"
+	"github.com/IBM/mirbft/pkg/status"
+)
+
+const debugHelp = `Commands:
+  step [n]               apply the next n events (default 1)
+  continue               apply events until a breakpoint is hit
+  break <condition>...   stop after any event matching all of the conditions:
+                           event <type>   the event is of this type (e.g. Tick)
+                           msg <type>     the event steps a message of this type (e.g. Commit)
+                           seqno <n>      the event steps a message for, or commits, this seq_no
+                           epoch <n>      the node's last active epoch becomes n
+                           epochstate     the node's epoch target state changes
+                           node <id>      the event is for this node
+  breaks                 list the breakpoints
+  delete <n>             delete breakpoint n
+  status [node] [tree]   print the status of the node (default, the last event's node),
+                         or one tree of it: epochs, buckets, checkpoints, clients, buffers
+  mark <name>            remember the status of every node
+  diff <name> [node]     print the difference between the marked and current status
+  help                   print this help
+  quit                   exit the debugger
+`
+
+// debugArguments are the arguments for the 'debug' subcommand, which replays
+// a log under the control of commands read from the commands reader.
+type debugArguments struct {
+	input    io.ReadCloser
+	commands io.Reader
+	logLevel statemachine.LogLevel
+	verbose  bool
+}
+
+// breakCondition is a single condition of a breakpoint.
+type breakCondition struct {
+	kind  string
+	value string
+	// number is the parsed value for the numeric kinds
+	number uint64
+}
+
+type breakpoint []breakCondition
+
+func (b breakpoint) String() string {
+	var parts []string
+	for _, c := range b {
+		parts = append(parts, strings.TrimSpace(c.kind+" "+c.value))
+	}
+	return strings.Join(parts, " ")
+}
+
+func parseBreakpoint(args []string) (breakpoint, error) {
+	if len(args) == 0 {
+		return nil, errors.Errorf("breakpoint requires at least one condition")
+	}
+
+	var b breakpoint
+	for len(args) > 0 {
+		c := breakCondition{kind: args[0]}
+		args = args[1:]
+
+		switch c.kind {
+		case "epochstate":
+			b = append(b, c)
+			continue
+		case "event", "msg", "seqno", "epoch", "node":
+		default:
+			return nil, errors.Errorf("unknown breakpoint condition '%s'", c.kind)
+		}
+
+		if len(args) == 0 {
+			return nil, errors.Errorf("breakpoint condition '%s' requires a value", c.kind)
+		}
+		c.value = args[0]
+		args = args[1:]
+
+		switch c.kind {
+		case "event":
+			if excludeByType(c.value, allEventTypes, nil) {
+				return nil, errors.Errorf("unknown event type '%s'", c.value)
+			}
+		case "msg":
+			if excludeByType(c.value, allMsgTypes, nil) {
+				return nil, errors.Errorf("unknown message type '%s'", c.value)
+			}
+		default:
+			number, err := strconv.ParseUint(c.value, 10, 64)
+			if err != nil {
+				return nil, errors.Errorf("breakpoint condition '%s' requires a number, not '%s'", c.kind, c.value)
+			}
+			c.number = number
+		}
+
+		b = append(b, c)
+	}
+
+	return b, nil
+}
+
+// stepSeqNo returns the seq_no of the stepped message, if the message
+// has one.
+func stepSeqNo(msg *pb.Msg) (uint64, bool) {
+	m := msg.ProtoReflect()
+	od := m.Descriptor().Oneofs().ByName("type")
+	fd := m.WhichOneof(od)
+	if fd == nil || fd.Kind() != protoreflect.MessageKind {
+		return 0, false
+	}
+
+	inner := m.Get(fd).Message()
+	seqNoField := inner.Descriptor().Fields().ByName("seq_no")
+	if seqNoField == nil {
+		return 0, false
+	}
+
+	return inner.Get(seqNoField).Uint(), true
+}
+
+// nodeTransition is the change to a node's epoch tracker caused by an event.
+type nodeTransition struct {
+	before, after *status.EpochTracker
+}
+
+func (b breakpoint) matches(event *rpb.RecordedEvent, actions *pb.StateEventResult, transition nodeTransition) bool {
+	step, _ := event.StateEvent.Type.(*pb.StateEvent_Step)
+
+	for _, c := range b {
+		switch c.kind {
+		case "event":
+			if eventTypeName(event) != c.value {
+				return false
+			}
+		case "msg":
+			if step == nil || msgTypeName(step.Step.Msg) != c.value {
+				return false
+			}
+		case "node":
+			if event.NodeId != c.number {
+				return false
+			}
+		case "seqno":
+			matched := false
+			if step != nil {
+				seqNo, ok := stepSeqNo(step.Step.Msg)
+				matched = ok && seqNo == c.number
+			}
+			if actions != nil {
+				for _, commit := range actions.Commits {
+					if commit.SeqNo == c.number || (commit.Batch != nil && commit.Batch.SeqNo == c.number) {
+						matched = true
+					}
+				}
+			}
+			if !matched {
+				return false
+			}
+		case "epoch":
+			if transition.after == nil || transition.after.LastActiveEpoch != c.number ||
+				(transition.before != nil && transition.before.LastActiveEpoch == c.number) {
+				return false
+			}
+		case "epochstate":
+			if transition.before == nil || transition.after == nil || transition.before.State == transition.after.State {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (b breakpoint) needsStatus() bool {
+	for _, c := range b {
+		if c.kind == "epoch" || c.kind == "epochstate" {
+			return true
+		}
+	}
+	return false
+}
+
+// debugger holds the state of a debugging session.
+type debugger struct {
+	output      io.Writer
+	reader      eventReader
+	verbose     bool
+	s           *stateMachines
+	index       uint64
+	lastNodeID  uint64
+	exhausted   bool
+	breakpoints []breakpoint
+	marks       map[string]map[uint64]*status.StateMachine
+
+	// replayErr is set if reading or applying an event fails, after
+	// which the state machines can no longer be trusted.
+	replayErr error
+}
+
+// next applies the next event, printing it and its actions if print is set,
+// and returns whether any breakpoint matched.
+func (d *debugger) next(print bool) (bool, error) {
+	if d.exhausted {
+		fmt.Fprintf(d.output, "End of log after %d events\n", d.index)
+		return false, nil
+	}
+
+	event, err := d.reader.ReadEvent()
+	if err == io.EOF {
+		d.exhausted = true
+		fmt.Fprintf(d.output, "End of log after %d events\n", d.index)
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.WithMessage(err, "failed reading input")
+	}
+
+	d.index++
+
+	if dropped, ok := eventlog.GapMarker(event); ok {
+		return false, errors.Errorf("cannot replay log, %d events were dropped at index %d", dropped, d.index)
+	}
+
+	needsStatus := false
+	for _, b := range d.breakpoints {
+		needsStatus = needsStatus || b.needsStatus()
+	}
+
+	var transition nodeTransition
+	if node, ok := d.s.nodes[event.NodeId]; ok && needsStatus {
+		transition.before = node.machine.Status().EpochTracker
+	}
+
+	actions, err := d.s.apply(event)
+	if err != nil {
+		return false, err
+	}
+	d.lastNodeID = event.NodeId
+
+	if needsStatus {
+		transition.after = d.s.status(event).EpochTracker
+	}
+
+	var hit []int
+	for i, b := range d.breakpoints {
+		if b.matches(event, actions, transition) {
+			hit = append(hit, i+1)
+		}
+	}
+
+	if !print && len(hit) == 0 {
+		return false, nil
+	}
+
+	for _, i := range hit {
+		fmt.Fprintf(d.output, "Breakpoint %d (%s) hit\n", i, d.breakpoints[i-1])
+	}
+
+	text, err := textFormat(event, !d.verbose)
+	if err != nil {
+		return false, errors.WithMessage(err, "could not marshal event")
+	}
+	fmt.Fprintf(d.output, "% 6d %s\n", d.index, text)
+
+	if actions != nil {
+		text, err := textFormat(actions, !d.verbose)
+		if err != nil {
+			return false, errors.WithMessage(err, "could not marshal actions")
+		}
+		fmt.Fprintf(d.output, "       actions: %s\n", text)
+	}
+
+	return len(hit) > 0, nil
+}
+
+func (d *debugger) nodeStatus(nodeID uint64) (*status.StateMachine, error) {
+	node, ok := d.s.nodes[nodeID]
+	if !ok {
+		return nil, errors.Errorf("node %d has not been initialized", nodeID)
+	}
+	return node.machine.Status(), nil
+}
+
+func (d *debugger) printStatus(args []string) error {
+	nodeID := d.lastNodeID
+	if len(args) > 0 {
+		if id, err := strconv.ParseUint(args[0], 10, 64); err == nil {
+			nodeID = id
+			args = args[1:]
+		}
+	}
+
+	nodeStatus, err := d.nodeStatus(nodeID)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		fmt.Fprint(d.output, nodeStatus.Pretty())
+		fmt.Fprint(d.output, "\n")
+		return nil
+	}
+
+	var tree interface{}
+	switch args[0] {
+	case "epochs":
+		tree = nodeStatus.EpochTracker
+	case "buckets":
+		tree = nodeStatus.Buckets
+	case "checkpoints":
+		tree = nodeStatus.Checkpoints
+	case "clients":
+		tree = nodeStatus.ClientWindows
+	case "buffers":
+		tree = nodeStatus.NodeBuffers
+	default:
+		return errors.Errorf("unknown status tree '%s'", args[0])
+	}
+
+	data, err := json.MarshalIndent(tree, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(d.output, "%s\n", data)
+	return nil
+}
+
+func (d *debugger) mark(name string) {
+	statuses := map[uint64]*status.StateMachine{}
+	for nodeID, node := range d.s.nodes {
+		statuses[nodeID] = node.machine.Status()
+	}
+	d.marks[name] = statuses
+	fmt.Fprintf(d.output, "Marked status of %d nodes at event %d as '%s'\n", len(statuses), d.index, name)
+}
+
+func (d *debugger) diff(args []string) error {
+	marked, ok := d.marks[args[0]]
+	if !ok {
+		return errors.Errorf("no mark named '%s'", args[0])
+	}
+
+	var nodeIDs []uint64
+	if len(args) > 1 {
+		nodeID, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return errors.Errorf("bad node id '%s'", args[1])
+		}
+		nodeIDs = []uint64{nodeID}
+	} else {
+		for nodeID := range d.s.nodes {
+			nodeIDs = append(nodeIDs, nodeID)
+		}
+		sort.Slice(nodeIDs, func(i, j int) bool {
+			return nodeIDs[i] < nodeIDs[j]
+		})
+	}
+
+	for _, nodeID := range nodeIDs {
+		current, err := d.nodeStatus(nodeID)
+		if err != nil {
+			return err
+		}
+
+		before, err := statusLines(marked[nodeID])
+		if err != nil {
+			return err
+		}
+		after, err := statusLines(current)
+		if err != nil {
+			return err
+		}
+
+		changes := lineDiff(before, after)
+		if len(changes) == 0 {
+			fmt.Fprintf(d.output, "Node %d: unchanged\n", nodeID)
+			continue
+		}
+
+		fmt.Fprintf(d.output, "Node %d:\n", nodeID)
+		for _, change := range changes {
+			fmt.Fprintf(d.output, "%s\n", change)
+		}
+	}
+
+	return nil
+}
+
+func statusLines(s *status.StateMachine) ([]string, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(string(data), "\n"), nil
+}
+
+// maxDiffEdits bounds the number of lines lineDiff will align.  Beyond it,
+// the lines between the common prefix and suffix are reported as wholly
+// replaced, rather than aligned.
+const maxDiffEdits = 1000
+
+// lineDiff returns the lines removed from a (prefixed with '-') and added
+// in b (prefixed with '+'), as the shortest edit script found by Myers'
+// algorithm.  Its cost grows with the size of the inputs times the number
+// of edits, so the edits are bounded by maxDiffEdits.
+func lineDiff(a, b []string) []string {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	n, m := len(a), len(b)
+	maxD := n + m
+	if maxD > maxDiffEdits {
+		maxD = maxDiffEdits
+	}
+
+	// v[offset+k] is the furthest x reached on diagonal k = x - y, and
+	// trace[d] is the window [-d, d] of v once d edits have been made.
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+				return editScript(a, b, trace)
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+
+	result := make([]string, 0, n+m)
+	for _, line := range a {
+		result = append(result, "-"+line)
+	}
+	for _, line := range b {
+		result = append(result, "+"+line)
+	}
+	return result
+}
+
+// editScript walks the trace of lineDiff back from the end of both inputs,
+// recovering the edit made at each step.
+func editScript(a, b []string, trace [][]int) []string {
+	var reversed []string
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := func(k int) int {
+			return trace[d-1][k+d-1]
+		}
+
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && prev(k-1) < prev(k+1)) {
+			prevK = k + 1
+		}
+
+		prevX := prev(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+		}
+
+		if prevK == k+1 {
+			reversed = append(reversed, "+"+b[prevY])
+		} else {
+			reversed = append(reversed, "-"+a[prevX])
+		}
+		x, y = prevX, prevY
+	}
+
+	result := make([]string, len(reversed))
+	for i, line := range reversed {
+		result[len(reversed)-1-i] = line
+	}
+	return result
+}
+
+// command executes a single debugger command, returning true if the
+// debugger should exit.
+func (d *debugger) command(fields []string) (bool, error) {
+	switch fields[0] {
+	case "step", "s":
+		n := uint64(1)
+		if len(fields) > 1 {
+			var err error
+			n, err = strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return false, errors.Errorf("bad step count '%s'", fields[1])
+			}
+		}
+		for i := uint64(0); i < n; i++ {
+			if _, err := d.next(true); err != nil {
+				d.replayErr = err
+				return false, err
+			}
+			if d.exhausted {
+				break
+			}
+		}
+	case "continue", "c":
+		for {
+			hit, err := d.next(false)
+			if err != nil {
+				d.replayErr = err
+				return false, err
+			}
+			if hit || d.exhausted {
+				break
+			}
+		}
+	case "break", "b":
+		b, err := parseBreakpoint(fields[1:])
+		if err != nil {
+			return false, err
+		}
+		d.breakpoints = append(d.breakpoints, b)
+		fmt.Fprintf(d.output, "Breakpoint %d: %s\n", len(d.breakpoints), b)
+	case "breaks":
+		for i, b := range d.breakpoints {
+			fmt.Fprintf(d.output, "Breakpoint %d: %s\n", i+1, b)
+		}
+	case "delete":
+		if len(fields) != 2 {
+			return false, errors.Errorf("delete requires a breakpoint number")
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 1 || n > len(d.breakpoints) {
+			return false, errors.Errorf("no breakpoint '%s'", fields[1])
+		}
+		d.breakpoints = append(d.breakpoints[:n-1], d.breakpoints[n:]...)
+	case "status":
+		return false, d.printStatus(fields[1:])
+	case "mark":
+		if len(fields) != 2 {
+			return false, errors.Errorf("mark requires a name")
+		}
+		d.mark(fields[1])
+	case "diff":
+		if len(fields) < 2 {
+			return false, errors.Errorf("diff requires a mark name")
+		}
+		return false, d.diff(fields[1:])
+	case "help", "h":
+		fmt.Fprint(d.output, debugHelp)
+	case "quit", "q":
+		return true, nil
+	default:
+		return false, errors.Errorf("unknown command '%s', try 'help'", fields[0])
+	}
+
+	return false, nil
+}
+
+func (da *debugArguments) execute(output io.Writer) error {
+	defer da.input.Close()
+
+	reader, err := eventlog.NewReader(da.input)
+	if err != nil {
+		return errors.WithMessage(err, "bad input file")
+	}
+
+	d := &debugger{
+		output:  output,
+		reader:  reader,
+		verbose: da.verbose,
+		s:       newStateMachines(output, da.logLevel),
+		marks:   map[string]map[uint64]*status.StateMachine{},
+	}
+
+	scanner := bufio.NewScanner(da.commands)
+	for {
+		fmt.Fprint(output, "(mircat) ")
+		if !scanner.Scan() {
+			fmt.Fprint(output, "\n")
+			return scanner.Err()
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		exit, err := d.command(fields)
+		if d.replayErr != nil {
+			return d.replayErr
+		}
+		if err != nil {
+			fmt.Fprintf(output, "error: %s\n", err)
+			continue
+		}
+		if exit {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/IBM/mirbft/pkg/statemachine"
+)
+
+var _ = Describe("Debug", func() {
+	var (
+		logBytes *bytes.Buffer
+		output   *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		logBytes = newBasicLog()
+		output = &bytes.Buffer{}
+	})
+
+	debug := func(commands ...string) error {
+		da := &debugArguments{
+			input:    ioutil.NopCloser(logBytes),
+			commands: strings.NewReader(strings.Join(commands, "\n")),
+			logLevel: statemachine.LevelError,
+		}
+		return da.execute(output)
+	}
+
+	It("parses the arguments", func() {
+		cmd, err := parseArgs([]string{
+			"debug",
+			"--input", "main.go",
+			"--logLevel", "warn",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(BeAssignableToTypeOf(&debugArguments{}))
+		da := cmd.(*debugArguments)
+		Expect(da.logLevel).To(Equal(statemachine.LevelWarn))
+		Expect(da.input.Close()).To(Succeed())
+	})
+
+	It("steps through events", func() {
+		Expect(debug("step", "step 2", "quit")).To(Succeed())
+		Expect(output.String()).To(ContainSubstring("     1 [node_id=0 time=0 state_event=[initialize="))
+		Expect(output.String()).To(ContainSubstring("     3 [node_id=2 "))
+		Expect(output.String()).NotTo(ContainSubstring("     4 "))
+	})
+
+	It("continues to a breakpoint", func() {
+		Expect(debug("break msg Commit seqno 3 node 2", "continue", "status clients")).To(Succeed())
+		Expect(output.String()).To(ContainSubstring("Breakpoint 1: msg Commit seqno 3 node 2\n"))
+		Expect(output.String()).To(ContainSubstring("Breakpoint 1 (msg Commit seqno 3 node 2) hit\n"))
+		Expect(output.String()).To(MatchRegexp(`hit\n *\d+ \[node_id=2 time=\d+ state_event=\[step=\[source=\d msg=\[commit=\[seq_no=3 `))
+		Expect(output.String()).To(ContainSubstring(`"client_id": 0`))
+	})
+
+	It("breaks on epoch state changes", func() {
+		Expect(debug("step 8", "break epochstate", "continue")).To(Succeed())
+		Expect(output.String()).To(ContainSubstring("Breakpoint 1 (epochstate) hit\n"))
+	})
+
+	It("runs to the end of the log without breakpoints", func() {
+		Expect(debug("continue", "step")).To(Succeed())
+		Expect(strings.Count(output.String(), "End of log after")).To(Equal(2))
+	})
+
+	It("diffs the status against a mark", func() {
+		Expect(debug("step 8", "mark start", "diff start 0", "break node 0 seqno 5", "continue", "diff start 0")).To(Succeed())
+		Expect(output.String()).To(ContainSubstring("Marked status of 4 nodes at event 8 as 'start'\n"))
+		Expect(output.String()).To(ContainSubstring("Node 0: unchanged\n"))
+		Expect(output.String()).To(MatchRegexp(`Node 0:\n[-+]`))
+	})
+
+	It("reports bad commands without exiting", func() {
+		Expect(debug("bogus", "break seqno x", "break msg Bogus", "diff missing", "status", "quit")).To(Succeed())
+		Expect(output.String()).To(ContainSubstring("error: unknown command 'bogus', try 'help'\n"))
+		Expect(output.String()).To(ContainSubstring("error: breakpoint condition 'seqno' requires a number, not 'x'\n"))
+		Expect(output.String()).To(ContainSubstring("error: unknown message type 'Bogus'\n"))
+		Expect(output.String()).To(ContainSubstring("error: no mark named 'missing'\n"))
+		Expect(output.String()).To(ContainSubstring("error: node 0 has not been initialized\n"))
+	})
+
+	It("computes a line diff", func() {
+		Expect(lineDiff(
+			[]string{"a", "b", "c", "d"},
+			[]string{"a", "c", "x", "d"},
+		)).To(Equal([]string{"-b", "+x"}))
+	})
+
+	It("diffs large inputs with localized changes", func() {
+		a := make([]string, 100000)
+		for i := range a {
+			a[i] = strconv.Itoa(i)
+		}
+		b := append([]string{}, a...)
+		b[500] = "x"
+		b[50000] = "y"
+		Expect(lineDiff(a, b)).To(Equal([]string{"-500", "+x", "-50000", "+y"}))
+	})
+
+	It("reports the differing lines as replaced once they are too many to align", func() {
+		a := make([]string, 2000)
+		b := make([]string, 2000)
+		for i := range a {
+			a[i] = "a" + strconv.Itoa(i)
+			b[i] = "b" + strconv.Itoa(i)
+		}
+		b[1000] = a[1000]
+		changes := lineDiff(append([]string{"same"}, a...), append([]string{"same"}, b...))
+		Expect(changes).To(HaveLen(4000))
+		Expect(changes[0]).To(Equal("-a0"))
+		Expect(changes[1999]).To(Equal("-a1999"))
+		Expect(changes[2000]).To(Equal("+b0"))
+	})
+})
@@ -0,0 +1,322 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	"github.com/IBM/mirbft/pkg/eventlog"
+	"github.com/IBM/mirbft/pkg/statemachine"
+)
+
+const (
+	diagramMermaid  = "mermaid"
+	diagramPlantUML = "plantuml"
+	diagramDot      = "dot"
+)
+
+// diagramArguments are the arguments for the 'diagram' subcommand, which
+// replays a log and renders the messages exchanged between the nodes.
+type diagramArguments struct {
+	input    io.ReadCloser
+	format   string
+	seqNo    *uint64
+	epoch    *uint64
+	msgTypes []string
+
+	// startIndex and endIndex bound the events drawn, if set
+	startIndex *uint64
+	endIndex   *uint64
+}
+
+// msgEpoch returns the epoch the message pertains to, if any.
+func msgEpoch(msg *pb.Msg) (uint64, bool) {
+	switch t := msg.Type.(type) {
+	case *pb.Msg_Preprepare:
+		return t.Preprepare.Epoch, true
+	case *pb.Msg_Prepare:
+		return t.Prepare.Epoch, true
+	case *pb.Msg_Commit:
+		return t.Commit.Epoch, true
+	case *pb.Msg_Suspect:
+		return t.Suspect.Epoch, true
+	case *pb.Msg_EpochChange:
+		return t.EpochChange.NewEpoch, true
+	case *pb.Msg_EpochChangeAck:
+		return t.EpochChangeAck.EpochChange.NewEpoch, true
+	case *pb.Msg_NewEpoch:
+		return t.NewEpoch.NewConfig.Config.Number, true
+	case *pb.Msg_NewEpochEcho:
+		return t.NewEpochEcho.Config.Number, true
+	case *pb.Msg_NewEpochReady:
+		return t.NewEpochReady.Config.Number, true
+	default:
+		return 0, false
+	}
+}
+
+// msgLabel describes the message by its type, seq_no, and epoch.
+func msgLabel(msg *pb.Msg) string {
+	label := msgTypeName(msg)
+	if seqNo, ok := stepSeqNo(msg); ok {
+		label += fmt.Sprintf(" seq_no=%d", seqNo)
+	}
+	if epoch, ok := msgEpoch(msg); ok {
+		label += fmt.Sprintf(" epoch=%d", epoch)
+	}
+	return label
+}
+
+func (da *diagramArguments) selected(msg *pb.Msg) bool {
+	if da.msgTypes != nil && excludeByType(msgTypeName(msg), da.msgTypes, nil) {
+		return false
+	}
+
+	if da.seqNo != nil {
+		if seqNo, ok := stepSeqNo(msg); !ok || seqNo != *da.seqNo {
+			return false
+		}
+	}
+
+	if da.epoch != nil {
+		if epoch, ok := msgEpoch(msg); !ok || epoch != *da.epoch {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (da *diagramArguments) inRange(index uint64) bool {
+	return (da.startIndex == nil || index >= *da.startIndex) &&
+		(da.endIndex == nil || index <= *da.endIndex)
+}
+
+// arrow is a single message in the diagram.
+type arrow struct {
+	index    uint64
+	from, to uint64
+	label    string
+
+	// send is true if this arrow is drawn at the time of the send
+	// rather than the receipt, which is only the case if the message
+	// was received outside of the selected range (show), or never
+	// received at all (lost).
+	send bool
+	show bool
+	lost bool
+}
+
+type sendKey struct {
+	from, to uint64
+	msg      string
+}
+
+// diagram accumulates the arrows, matching each send to its receipt.
+type diagram struct {
+	arrows       []*arrow
+	participants map[uint64]struct{}
+	pending      map[sendKey][]*arrow
+}
+
+func msgKey(from, to uint64, msg *pb.Msg) sendKey {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		panic(fmt.Sprintf("could not marshal message: %s", err))
+	}
+
+	return sendKey{
+		from: from,
+		to:   to,
+		msg:  string(data),
+	}
+}
+
+func (d *diagram) send(index, from uint64, send *pb.StateEventResult_Send, draw bool) {
+	for _, to := range send.Targets {
+		a := &arrow{
+			index: index,
+			from:  from,
+			to:    to,
+			label: msgLabel(send.Msg),
+			send:  true,
+		}
+		key := msgKey(from, to, send.Msg)
+		d.pending[key] = append(d.pending[key], a)
+		if draw {
+			d.arrows = append(d.arrows, a)
+		}
+	}
+}
+
+func (d *diagram) receive(index, to uint64, step *pb.StateEvent_InboundMsg, draw bool) {
+	key := msgKey(step.Source, to, step.Msg)
+	if sends := d.pending[key]; len(sends) > 0 {
+		// If the receipt is drawn, the send need not be, otherwise,
+		// the arrow is drawn at the time of the send.
+		sends[0].show = !draw
+		d.pending[key] = sends[1:]
+	}
+
+	if draw {
+		d.arrows = append(d.arrows, &arrow{
+			index: index,
+			from:  step.Source,
+			to:    to,
+			label: msgLabel(step.Msg),
+		})
+	}
+}
+
+// finish resolves the remaining sends as lost, and returns the arrows
+// which should be drawn.
+func (d *diagram) finish() []*arrow {
+	for _, sends := range d.pending {
+		for _, a := range sends {
+			a.lost = true
+		}
+	}
+
+	var result []*arrow
+	for _, a := range d.arrows {
+		if a.send && !a.show && !a.lost {
+			continue
+		}
+		d.participants[a.from] = struct{}{}
+		d.participants[a.to] = struct{}{}
+		result = append(result, a)
+	}
+
+	return result
+}
+
+func (d *diagram) sortedParticipants() []uint64 {
+	var nodeIDs []uint64
+	for nodeID := range d.participants {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Slice(nodeIDs, func(i, j int) bool {
+		return nodeIDs[i] < nodeIDs[j]
+	})
+	return nodeIDs
+}
+
+func (d *diagram) write(output io.Writer, format string) {
+	arrows := d.finish()
+	nodeIDs := d.sortedParticipants()
+
+	label := func(a *arrow) string {
+		switch {
+		case a.lost:
+			return fmt.Sprintf("[%d] %s (lost)", a.index, a.label)
+		case a.send:
+			return fmt.Sprintf("[%d] %s (sent)", a.index, a.label)
+		default:
+			return fmt.Sprintf("[%d] %s", a.index, a.label)
+		}
+	}
+
+	switch format {
+	case diagramPlantUML:
+		fmt.Fprintf(output, "@startuml\n")
+		for _, nodeID := range nodeIDs {
+			fmt.Fprintf(output, "participant \"node%d\" as N%d\n", nodeID, nodeID)
+		}
+		for _, a := range arrows {
+			arrowText := "->"
+			if a.lost {
+				arrowText = "->x"
+			}
+			fmt.Fprintf(output, "N%d %s N%d : %s\n", a.from, arrowText, a.to, label(a))
+		}
+		fmt.Fprintf(output, "@enduml\n")
+	case diagramDot:
+		fmt.Fprintf(output, "digraph mirbft {\n")
+		for _, nodeID := range nodeIDs {
+			fmt.Fprintf(output, "  N%d [label=\"node%d\"];\n", nodeID, nodeID)
+		}
+		for _, a := range arrows {
+			style := ""
+			if a.lost {
+				style = ", style=dashed, color=red"
+			}
+			fmt.Fprintf(output, "  N%d -> N%d [label=\"%s\"%s];\n", a.from, a.to, label(a), style)
+		}
+		fmt.Fprintf(output, "}\n")
+	default:
+		fmt.Fprintf(output, "sequenceDiagram\n")
+		for _, nodeID := range nodeIDs {
+			fmt.Fprintf(output, "    participant N%d as node%d\n", nodeID, nodeID)
+		}
+		for _, a := range arrows {
+			arrowText := "->>"
+			if a.lost {
+				arrowText = "-x"
+			}
+			fmt.Fprintf(output, "    N%d%sN%d: %s\n", a.from, arrowText, a.to, label(a))
+		}
+	}
+}
+
+func (da *diagramArguments) execute(output io.Writer) error {
+	defer da.input.Close()
+
+	reader, err := eventlog.NewReader(da.input)
+	if err != nil {
+		return errors.WithMessage(err, "bad input file")
+	}
+
+	d := &diagram{
+		participants: map[uint64]struct{}{},
+		pending:      map[sendKey][]*arrow{},
+	}
+
+	s := newStateMachines(output, statemachine.LevelError)
+
+	index := uint64(0)
+	for {
+		event, err := reader.ReadEvent()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.WithMessage(err, "failed reading input")
+		}
+
+		index++
+
+		if dropped, ok := eventlog.GapMarker(event); ok {
+			return errors.Errorf("cannot replay log, %d events were dropped at index %d", dropped, index)
+		}
+
+		if step, ok := event.StateEvent.Type.(*pb.StateEvent_Step); ok {
+			d.receive(index, event.NodeId, step.Step, da.inRange(index) && da.selected(step.Step.Msg))
+		}
+
+		actions, err := s.apply(event)
+		if err != nil {
+			return err
+		}
+
+		if actions == nil {
+			continue
+		}
+
+		for _, send := range actions.Send {
+			d.send(index, event.NodeId, send, da.inRange(index) && da.selected(send.Msg))
+		}
+	}
+
+	d.write(output, da.format)
+	return nil
+}
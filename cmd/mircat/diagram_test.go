@@ -0,0 +1,125 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+)
+
+var _ = Describe("Diagram", func() {
+	var output *bytes.Buffer
+
+	BeforeEach(func() {
+		output = &bytes.Buffer{}
+	})
+
+	It("parses the arguments", func() {
+		cmd, err := parseArgs([]string{
+			"diagram",
+			"--input", "main.go",
+			"--format", "dot",
+			"--seqNo", "3",
+			"--stepType", "Prepare",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(BeAssignableToTypeOf(&diagramArguments{}))
+		da := cmd.(*diagramArguments)
+		Expect(da.format).To(Equal(diagramDot))
+		Expect(*da.seqNo).To(Equal(uint64(3)))
+		Expect(da.epoch).To(BeNil())
+		Expect(da.msgTypes).To(Equal([]string{"Prepare"}))
+		Expect(da.input.Close()).To(Succeed())
+	})
+
+	It("rejects an inverted index range", func() {
+		_, err := parseArgs([]string{
+			"diagram",
+			"--input", "main.go",
+			"--startIndex", "10",
+			"--endIndex", "5",
+		})
+		Expect(err).To(MatchError("--startIndex must not exceed --endIndex"))
+	})
+
+	When("a recording is diagrammed", func() {
+		var logBytes *bytes.Buffer
+
+		BeforeEach(func() {
+			logBytes = newBasicLog()
+		})
+
+		It("renders the messages for a sequence number", func() {
+			seqNo := uint64(3)
+			da := &diagramArguments{
+				input:  ioutil.NopCloser(logBytes),
+				format: diagramMermaid,
+				seqNo:  &seqNo,
+			}
+			Expect(da.execute(output)).To(Succeed())
+			Expect(output.String()).To(HavePrefix("sequenceDiagram\n    participant N0 as node0\n"))
+			Expect(output.String()).To(MatchRegexp(`\n    N0->>N1: \[\d+\] Preprepare seq_no=3 epoch=1\n`))
+			Expect(output.String()).To(MatchRegexp(`\n    N1->>N0: \[\d+\] Prepare seq_no=3 epoch=1\n`))
+			Expect(output.String()).NotTo(ContainSubstring("seq_no=4"))
+		})
+	})
+
+	Describe("matching sends to receipts", func() {
+		var (
+			d   *diagram
+			msg *pb.Msg
+		)
+
+		BeforeEach(func() {
+			d = &diagram{
+				participants: map[uint64]struct{}{},
+				pending:      map[sendKey][]*arrow{},
+			}
+			msg = &pb.Msg{
+				Type: &pb.Msg_Prepare{
+					Prepare: &pb.Prepare{
+						SeqNo: 3,
+						Epoch: 1,
+					},
+				},
+			}
+		})
+
+		It("draws an arrow at the receipt", func() {
+			d.send(1, 0, &pb.StateEventResult_Send{Targets: []uint64{1, 2}, Msg: msg}, true)
+			d.receive(2, 1, &pb.StateEvent_InboundMsg{Source: 0, Msg: msg}, true)
+			d.write(output, diagramPlantUML)
+			Expect(output.String()).To(Equal(
+				"@startuml\n" +
+					"participant \"node0\" as N0\n" +
+					"participant \"node1\" as N1\n" +
+					"participant \"node2\" as N2\n" +
+					"N0 ->x N2 : [1] Prepare seq_no=3 epoch=1 (lost)\n" +
+					"N0 -> N1 : [2] Prepare seq_no=3 epoch=1\n" +
+					"@enduml\n",
+			))
+		})
+
+		It("draws an arrow at the send when the receipt is not drawn", func() {
+			d.send(1, 0, &pb.StateEventResult_Send{Targets: []uint64{1}, Msg: msg}, true)
+			d.receive(2, 1, &pb.StateEvent_InboundMsg{Source: 0, Msg: msg}, false)
+			d.write(output, diagramDot)
+			Expect(output.String()).To(Equal(
+				"digraph mirbft {\n" +
+					"  N0 [label=\"node0\"];\n" +
+					"  N1 [label=\"node1\"];\n" +
+					"  N0 -> N1 [label=\"[1] Prepare seq_no=3 epoch=1 (sent)\"];\n" +
+					"}\n",
+			))
+		})
+	})
+})
@@ -0,0 +1,48 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/IBM/mirbft/pkg/testengine"
+)
+
+// basicLog and basicRecording are the log and the final state of a four node,
+// four client recording, drained of its requests.  They are generated once
+// for the suite, and shared by every spec, so must not be modified.
+var (
+	basicLog       []byte
+	basicRecording *testengine.Recording
+)
+
+var _ = BeforeSuite(func() {
+	buffer := &bytes.Buffer{}
+	gzWriter := gzip.NewWriter(buffer)
+
+	recorder := testengine.BasicRecorder(4, 4, 20)
+
+	recording, err := recorder.Recording(gzWriter)
+	Expect(err).NotTo(HaveOccurred())
+
+	_, err = recording.DrainClients(5000)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(gzWriter.Close()).To(Succeed())
+
+	basicLog = buffer.Bytes()
+	basicRecording = recording
+})
+
+// newBasicLog returns a copy of the shared log, which the caller may
+// consume or modify.
+func newBasicLog() *bytes.Buffer {
+	return bytes.NewBuffer(append([]byte(nil), basicLog...))
+}
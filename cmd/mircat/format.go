@@ -0,0 +1,213 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+	"github.com/IBM/mirbft/pkg/statemachine"
+	"github.com/IBM/mirbft/pkg/status"
+)
+
+const (
+	formatText  = "text"
+	formatJSON  = "json"
+	formatJSONL = "jsonl"
+)
+
+var allFormats = []string{formatText, formatJSON, formatJSONL}
+
+// record is the unit of output for the json and jsonl formats.  Each record
+// corresponds to a single event in the log, and in interactive mode, includes
+// the resulting actions, status, and any state machine logs.  Records are
+// also emitted for gaps in the log and for each node once replay completes.
+type record struct {
+	Index     uint64               `json:"index,omitempty"`
+	Event     json.RawMessage      `json:"event,omitempty"`
+	Gap       *gapRecord           `json:"gap,omitempty"`
+	Logs      []*logRecord         `json:"logs,omitempty"`
+	Actions   json.RawMessage      `json:"actions,omitempty"`
+	Status    *status.StateMachine `json:"status,omitempty"`
+	Completed *completedRecord     `json:"completed,omitempty"`
+}
+
+type gapRecord struct {
+	NodeID        uint64 `json:"node_id"`
+	Time          int64  `json:"time"`
+	DroppedEvents uint64 `json:"dropped_events"`
+}
+
+type logRecord struct {
+	NodeID  uint64            `json:"node_id"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+type completedRecord struct {
+	NodeID        uint64 `json:"node_id"`
+	ExecutionTime string `json:"execution_time"`
+}
+
+// protoJSON marshals the message using the proto field names.  Because
+// protojson deliberately randomizes its whitespace, the result is compacted
+// so that the output is stable.
+func protoJSON(msg proto.Message) (json.RawMessage, error) {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &bytes.Buffer{}
+	if err := json.Compact(result, data); err != nil {
+		return nil, err
+	}
+
+	return result.Bytes(), nil
+}
+
+// recordWriter writes records as either a single JSON array, or
+// as JSON lines.
+type recordWriter struct {
+	output  io.Writer
+	lines   bool
+	written bool
+}
+
+func (rw *recordWriter) write(r *record) error {
+	if rw.lines {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return errors.WithMessage(err, "could not marshal record")
+		}
+		fmt.Fprintf(rw.output, "%s\n", data)
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r, "  ", "  ")
+	if err != nil {
+		return errors.WithMessage(err, "could not marshal record")
+	}
+
+	separator := ","
+	if !rw.written {
+		separator = "["
+		rw.written = true
+	}
+	fmt.Fprintf(rw.output, "%s\n  %s", separator, data)
+	return nil
+}
+
+func (rw *recordWriter) close() {
+	switch {
+	case rw.lines:
+	case rw.written:
+		fmt.Fprint(rw.output, "\n]\n")
+	default:
+		fmt.Fprint(rw.output, "[]\n")
+	}
+}
+
+// recordLogger collects the logs of a state machine so that they may
+// be included in the record of the event which produced them.
+type recordLogger struct {
+	nodeID uint64
+	level  statemachine.LogLevel
+	logs   *[]*logRecord
+}
+
+func (rl recordLogger) Log(level statemachine.LogLevel, msg string, args ...interface{}) {
+	if level < rl.level {
+		return
+	}
+
+	var levelText string
+	switch level {
+	case statemachine.LevelDebug:
+		levelText = "debug"
+	case statemachine.LevelInfo:
+		levelText = "info"
+	case statemachine.LevelWarn:
+		levelText = "warn"
+	default:
+		levelText = "error"
+	}
+
+	lr := &logRecord{
+		NodeID:  rl.nodeID,
+		Level:   levelText,
+		Message: msg,
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		if lr.Fields == nil {
+			lr.Fields = map[string]string{}
+		}
+
+		key := fmt.Sprint(args[i])
+		if i+1 == len(args) {
+			lr.Fields[key] = "%MISSING%"
+			continue
+		}
+
+		switch v := args[i+1].(type) {
+		case []byte:
+			lr.Fields[key] = fmt.Sprintf("%x", v)
+		default:
+			lr.Fields[key] = fmt.Sprint(v)
+		}
+	}
+
+	*rl.logs = append(*rl.logs, lr)
+}
+
+// eventRecord builds the record for a single event, the event, actions
+// and status are each optional.
+func eventRecord(index uint64, event *rpb.RecordedEvent, actions *pb.StateEventResult, nodeStatus *status.StateMachine, logs []*logRecord) (*record, error) {
+	r := &record{
+		Index:  index,
+		Status: nodeStatus,
+		Logs:   logs,
+	}
+
+	if event != nil {
+		var err error
+		r.Event, err = protoJSON(event)
+		if err != nil {
+			return nil, errors.WithMessage(err, "could not marshal event")
+		}
+	}
+
+	if actions != nil {
+		var err error
+		r.Actions, err = protoJSON(actions)
+		if err != nil {
+			return nil, errors.WithMessage(err, "could not marshal actions")
+		}
+	}
+
+	return r, nil
+}
+
+func completionRecord(nodeID uint64, executionTime time.Duration) *record {
+	return &record{
+		Completed: &completedRecord{
+			NodeID:        nodeID,
+			ExecutionTime: executionTime.String(),
+		},
+	}
+}
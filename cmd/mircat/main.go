@@ -8,7 +8,16 @@ SPDX-License-Identifier: Apache-2.0
 // It understands the format encoded via github.com/IBM/mirbft/eventlog
 // and is able to parse and filter these log files.  It is also able to
 // play them against an identical version of the state machine for problem
-// reproduction and debugging.
+// reproduction and debugging, either in one pass, or step by step via the
+// 'debug' subcommand.  Via the 'check' subcommand, it is able to
+// verify that the logs of several nodes agree on what was committed, and via
+// the 'stats' subcommand, to report latency and other statistics.  The
+// 'diagram' subcommand renders the message flow between nodes.  Via the
+// 'verify' subcommand, it is able to check that the current state machine
+// still produces the actions recorded alongside each event.  The 'extract',
+// 'merge', and 'redact' subcommands write new logs derived from existing ones.
+// Additionally, via the 'wal' subcommands, it is able to inspect, validate,
+// and repair the WAL of a node.
 package main
 
 import (
@@ -17,6 +26,7 @@ import (
 	"os"
 	"runtime/debug"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
@@ -99,8 +109,33 @@ func excludedByNodeID(re *rpb.RecordedEvent, nodeIDs []uint64) bool {
 	return true
 }
 
+// optionalUint64 is a kingpin flag value which records whether it was set.
+type optionalUint64 struct {
+	value *uint64
+}
+
+func (ou *optionalUint64) Set(s string) error {
+	value, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	ou.value = &value
+	return nil
+}
+
+func (ou *optionalUint64) String() string {
+	if ou.value == nil {
+		return ""
+	}
+	return strconv.FormatUint(*ou.value, 10)
+}
+
 type arguments struct {
 	input         io.ReadCloser
+	manifestDir   string
+	segment       *uint64
+	startIndex    *uint64
+	startTime     *uint64
 	interactive   bool
 	logLevel      statemachine.LogLevel
 	nodeIDs       []uint64
@@ -110,6 +145,7 @@ type arguments struct {
 	notStepTypes  []string
 	statusIndices []uint64
 	verboseText   bool
+	format        string
 }
 
 type namedLogger struct {
@@ -143,9 +179,8 @@ func (nl namedLogger) Log(level statemachine.LogLevel, msg string, args ...inter
 }
 
 type stateMachines struct {
-	logLevel statemachine.LogLevel
-	nodes    map[uint64]*stateMachine
-	output   io.Writer
+	nodes     map[uint64]*stateMachine
+	newLogger func(nodeID uint64) statemachine.Logger
 }
 
 type stateMachine struct {
@@ -153,13 +188,21 @@ type stateMachine struct {
 	pendingActions       *pb.StateEventResult
 	pendingClientActions *pb.StateEventResult
 	executionTime        time.Duration
+
+	// lastResult is the result of applying the most recent event
+	lastResult *pb.StateEventResult
 }
 
 func newStateMachines(output io.Writer, logLevel statemachine.LogLevel) *stateMachines {
 	return &stateMachines{
-		output:   output,
-		logLevel: logLevel,
-		nodes:    map[uint64]*stateMachine{},
+		nodes: map[uint64]*stateMachine{},
+		newLogger: func(nodeID uint64) statemachine.Logger {
+			return namedLogger{
+				name:   fmt.Sprintf("node%d", nodeID),
+				output: output,
+				level:  logLevel,
+			}
+		},
 	}
 }
 
@@ -170,11 +213,7 @@ func (s *stateMachines) apply(event *rpb.RecordedEvent) (result *pb.StateEventRe
 		delete(s.nodes, event.NodeId)
 		node = &stateMachine{
 			machine: &statemachine.StateMachine{
-				Logger: namedLogger{
-					name:   fmt.Sprintf("node%d", event.NodeId),
-					output: s.output,
-					level:  s.logLevel,
-				},
+				Logger: s.newLogger(event.NodeId),
 			},
 			pendingActions:       &pb.StateEventResult{},
 			pendingClientActions: &pb.StateEventResult{},
@@ -197,6 +236,7 @@ func (s *stateMachines) apply(event *rpb.RecordedEvent) (result *pb.StateEventRe
 	start := time.Now()
 	actions := node.machine.ApplyEvent(event.StateEvent)
 	node.executionTime += time.Since(start)
+	node.lastResult = actions
 	node.pendingActions, err = actionsConcat(node.pendingActions, actions)
 	if err != nil {
 		return nil, err
@@ -245,105 +285,184 @@ func (s *stateMachines) status(event *rpb.RecordedEvent) *status.StateMachine {
 	return node.machine.Status()
 }
 
-func (a *arguments) shouldPrint(event *rpb.RecordedEvent) bool {
-	var eventTypeText string
+// eventTypeName returns the name of the event's type as used by --eventType.
+func eventTypeName(event *rpb.RecordedEvent) string {
 	switch event.StateEvent.Type.(type) {
 	case *pb.StateEvent_Initialize:
-		eventTypeText = "Initialize"
+		return "Initialize"
 	case *pb.StateEvent_LoadEntry:
-		eventTypeText = "LoadEntry"
+		return "LoadEntry"
 	case *pb.StateEvent_CompleteInitialization:
-		eventTypeText = "CompleteInitialization"
+		return "CompleteInitialization"
 	case *pb.StateEvent_Tick:
-		eventTypeText = "Tick"
+		return "Tick"
 	case *pb.StateEvent_Propose:
-		eventTypeText = "Propose"
+		return "Propose"
 	case *pb.StateEvent_AddResults:
-		eventTypeText = "AddResults"
+		return "AddResults"
 	case *pb.StateEvent_AddClientResults:
-		eventTypeText = "AddClientResults"
+		return "AddClientResults"
 	case *pb.StateEvent_ActionsReceived:
-		eventTypeText = "ActionsReceived"
+		return "ActionsReceived"
 	case *pb.StateEvent_ClientActionsReceived:
-		eventTypeText = "ClientActionsReceived"
+		return "ClientActionsReceived"
 	case *pb.StateEvent_Step:
-		eventTypeText = "Step"
+		return "Step"
 	case *pb.StateEvent_Transfer:
-		eventTypeText = "StateTransfer"
+		return "StateTransfer"
 	default:
 		panic(fmt.Sprintf("Unknown event type '%T'", event.StateEvent.Type))
 	}
+}
 
-	if excludeByType(eventTypeText, a.eventTypes, a.notEventTypes) {
+// msgTypeName returns the name of the message's type as used by --stepType.
+func msgTypeName(msg *pb.Msg) string {
+	switch msg.Type.(type) {
+	case *pb.Msg_Preprepare:
+		return "Preprepare"
+	case *pb.Msg_Prepare:
+		return "Prepare"
+	case *pb.Msg_Commit:
+		return "Commit"
+	case *pb.Msg_Checkpoint:
+		return "Checkpoint"
+	case *pb.Msg_Suspect:
+		return "Suspect"
+	case *pb.Msg_EpochChange:
+		return "EpochChange"
+	case *pb.Msg_EpochChangeAck:
+		return "EpochChangeAck"
+	case *pb.Msg_NewEpoch:
+		return "NewEpoch"
+	case *pb.Msg_NewEpochEcho:
+		return "NewEpochEcho"
+	case *pb.Msg_NewEpochReady:
+		return "NewEpochReady"
+	case *pb.Msg_FetchBatch:
+		return "FetchBatch"
+	case *pb.Msg_ForwardBatch:
+		return "ForwardBatch"
+	case *pb.Msg_FetchRequest:
+		return "FetchRequest"
+	case *pb.Msg_ForwardRequest:
+		return "ForwardRequest"
+	case *pb.Msg_RequestAck:
+		return "RequestAck"
+	default:
+		panic("unknown message type")
+	}
+}
+
+func (a *arguments) shouldPrint(event *rpb.RecordedEvent) bool {
+	if excludeByType(eventTypeName(event), a.eventTypes, a.notEventTypes) {
 		return false
 	}
 
-	switch et := event.StateEvent.Type.(type) {
-	case *pb.StateEvent_Initialize:
-	case *pb.StateEvent_LoadEntry:
-	case *pb.StateEvent_CompleteInitialization:
-	case *pb.StateEvent_Tick:
-	case *pb.StateEvent_Propose:
-	case *pb.StateEvent_AddResults:
-	case *pb.StateEvent_AddClientResults:
-	case *pb.StateEvent_ActionsReceived:
-	case *pb.StateEvent_ClientActionsReceived:
-	case *pb.StateEvent_Step:
-		var stepTypeText string
-		switch et.Step.Msg.Type.(type) {
-		case *pb.Msg_Preprepare:
-			stepTypeText = "Preprepare"
-		case *pb.Msg_Prepare:
-			stepTypeText = "Prepare"
-		case *pb.Msg_Commit:
-			stepTypeText = "Commit"
-		case *pb.Msg_Checkpoint:
-			stepTypeText = "Checkpoint"
-		case *pb.Msg_Suspect:
-			stepTypeText = "Suspect"
-		case *pb.Msg_EpochChange:
-			stepTypeText = "EpochChange"
-		case *pb.Msg_EpochChangeAck:
-			stepTypeText = "EpochChangeAck"
-		case *pb.Msg_NewEpoch:
-			stepTypeText = "NewEpoch"
-		case *pb.Msg_NewEpochEcho:
-			stepTypeText = "NewEpochEcho"
-		case *pb.Msg_NewEpochReady:
-			stepTypeText = "NewEpochReady"
-		case *pb.Msg_FetchBatch:
-			stepTypeText = "FetchBatch"
-		case *pb.Msg_ForwardBatch:
-			stepTypeText = "ForwardBatch"
-		case *pb.Msg_FetchRequest:
-			stepTypeText = "FetchRequest"
-		case *pb.Msg_ForwardRequest:
-			stepTypeText = "ForwardRequest"
-		case *pb.Msg_RequestAck:
-			stepTypeText = "RequestAck"
-		default:
-			panic("unknown message type")
-		}
-		if excludeByType(stepTypeText, a.stepTypes, a.notStepTypes) {
+	if step, ok := event.StateEvent.Type.(*pb.StateEvent_Step); ok {
+		if excludeByType(msgTypeName(step.Step.Msg), a.stepTypes, a.notStepTypes) {
 			return false
 		}
-	case *pb.StateEvent_Transfer:
-		eventTypeText = "StateTransfer"
-	default:
-		panic(fmt.Sprintf("Unknown event type '%T'", event.StateEvent.Type))
 	}
 
 	return true
 }
 
+type eventReader interface {
+	ReadEvent() (*rpb.RecordedEvent, error)
+}
+
+// reader returns a reader for the segments in the manifest directory if one
+// is set, or for the input otherwise.
+func (a *arguments) reader() (eventReader, error) {
+	if a.manifestDir == "" {
+		reader, err := eventlog.NewReader(a.input)
+		if err != nil {
+			return nil, errors.WithMessage(err, "bad input file")
+		}
+		return reader, nil
+	}
+
+	segment := a.segment
+	if segment == nil {
+		manifest, err := eventlog.ReadManifest(a.manifestDir)
+		if err != nil {
+			return nil, err
+		}
+		if len(manifest.Segments) == 0 {
+			return nil, errors.Errorf("manifest contains no segments")
+		}
+		segment = &manifest.Segments[0].Number
+	}
+
+	reader, err := eventlog.NewManifestReader(a.manifestDir, *segment)
+	if err != nil {
+		return nil, errors.WithMessage(err, "bad manifest")
+	}
+	return reader, nil
+}
+
+// seek positions the reader at the start index or start time if either was
+// set, returning the number of events skipped.
+func (a *arguments) seek(er eventReader) (uint64, error) {
+	if a.startIndex == nil && a.startTime == nil {
+		return 0, nil
+	}
+
+	reader, ok := er.(*eventlog.Reader)
+	if !ok {
+		return 0, errors.Errorf("cannot seek within a manifest")
+	}
+
+	if a.startTime != nil {
+		index, err := reader.SeekTime(int64(*a.startTime))
+		if err != nil {
+			return 0, errors.WithMessage(err, "could not seek to start time")
+		}
+		return index, nil
+	}
+
+	// Indices are printed starting from 1
+	if *a.startIndex == 0 {
+		return 0, nil
+	}
+	index := *a.startIndex - 1
+	if err := reader.Seek(index); err != nil {
+		return 0, errors.WithMessage(err, "could not seek to start index")
+	}
+	return index, nil
+}
+
 func (a *arguments) execute(output io.Writer) error {
 	defer a.input.Close()
 
 	s := newStateMachines(output, a.logLevel)
 
-	reader, err := eventlog.NewReader(a.input)
+	// For the structured formats, the logs of the state machines are
+	// collected and emitted as part of the record of the current event.
+	var rw *recordWriter
+	var logs []*logRecord
+	if a.format == formatJSON || a.format == formatJSONL {
+		rw = &recordWriter{
+			output: output,
+			lines:  a.format == formatJSONL,
+		}
+		defer rw.close()
+
+		s.newLogger = func(nodeID uint64) statemachine.Logger {
+			return recordLogger{
+				nodeID: nodeID,
+				level:  a.logLevel,
+				logs:   &logs,
+			}
+		}
+	}
+
+	reader, err := a.reader()
 	if err != nil {
-		return errors.WithMessage(err, "bad input file")
+		return err
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
 	}
 
 	statusIndices := map[uint64]struct{}{}
@@ -351,7 +470,11 @@ func (a *arguments) execute(output io.Writer) error {
 		statusIndices[index] = struct{}{}
 	}
 
-	index := uint64(0)
+	index, err := a.seek(reader)
+	if err != nil {
+		return err
+	}
+
 	for {
 		event, err := reader.ReadEvent()
 		if err != nil {
@@ -368,11 +491,42 @@ func (a *arguments) execute(output io.Writer) error {
 			continue
 		}
 
+		if dropped, ok := eventlog.GapMarker(event); ok {
+			if a.interactive {
+				return errors.Errorf("cannot replay log, %d events were dropped at index %d", dropped, index)
+			}
+			if rw != nil {
+				err := rw.write(&record{
+					Index: index,
+					Gap: &gapRecord{
+						NodeID:        event.NodeId,
+						Time:          event.Time,
+						DroppedEvents: dropped,
+					},
+				})
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Fprintf(output, "% 6d [node_id=%d time=%d gap=[dropped_events=%d]]\n", index, event.NodeId, event.Time, dropped)
+			continue
+		}
+
 		_, statusIndex := statusIndices[index]
 
 		// We always print the event if the status index matches,
 		// otherwise the output could be quite confusing
-		if statusIndex || a.shouldPrint(event) {
+		shouldPrint := statusIndex || a.shouldPrint(event)
+
+		if rw != nil {
+			if err := a.writeRecord(rw, s, index, event, shouldPrint, statusIndex, &logs); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if shouldPrint {
 			text, err := textFormat(event, !a.verboseText)
 			if err != nil {
 				return errors.WithMessage(err, "could not marshal event")
@@ -415,6 +569,12 @@ func (a *arguments) execute(output io.Writer) error {
 		}
 
 		for _, nodeID := range nodeIDs {
+			if rw != nil {
+				if err := rw.write(completionRecord(nodeID, s.nodes[nodeID].executionTime)); err != nil {
+					return err
+				}
+				continue
+			}
 			fmt.Fprintf(output, "Node %d successfully completed execution in %v\n", nodeID, s.nodes[nodeID].executionTime)
 		}
 	}
@@ -422,25 +582,272 @@ func (a *arguments) execute(output io.Writer) error {
 	return nil
 }
 
-func parseArgs(args []string) (*arguments, error) {
+// writeRecord applies the event if interactive, and writes a single record
+// containing the event (if it should be printed), as well as the resulting
+// actions, status, and logs.  No record is written if it would be empty.
+func (a *arguments) writeRecord(rw *recordWriter, s *stateMachines, index uint64, event *rpb.RecordedEvent, shouldPrint, statusIndex bool, logs *[]*logRecord) error {
+	var actions *pb.StateEventResult
+	var nodeStatus *status.StateMachine
+	if a.interactive {
+		var err error
+		actions, err = s.apply(event)
+		if err != nil {
+			return err
+		}
+
+		if statusIndex {
+			nodeStatus = s.status(event)
+		}
+	}
+
+	printedEvent := event
+	if !shouldPrint {
+		printedEvent = nil
+	}
+
+	if printedEvent == nil && actions == nil && len(*logs) == 0 {
+		return nil
+	}
+
+	r, err := eventRecord(index, printedEvent, actions, nodeStatus, *logs)
+	if err != nil {
+		return err
+	}
+	*logs = nil
+
+	return rw.write(r)
+}
+
+// parseLogLevel converts the --logLevel flag to a state machine log level,
+// defaulting to info.
+func parseLogLevel(logLevel string) statemachine.LogLevel {
+	switch logLevel {
+	case "debug":
+		return statemachine.LevelDebug
+	case "warn":
+		return statemachine.LevelWarn
+	case "error":
+		return statemachine.LevelError
+	default:
+		return statemachine.LevelInfo
+	}
+}
+
+// command is implemented by the arguments of each mircat subcommand.
+type command interface {
+	execute(output io.Writer) error
+}
+
+func parseArgs(args []string) (command, error) {
 	app := kingpin.New("mircat", "Utility for processing Mir state event logs.")
-	input := app.Flag("input", "The input file to read (defaults to stdin).").Default(os.Stdin.Name()).File()
-	interactive := app.Flag("interactive", "Whether to apply this log to a Mir state machine.").Default("false").Bool()
-	nodeIDs := app.Flag("nodeID", "Report events from this nodeID only (useful for interleaved logs), may be repeated").Uint64List()
-	eventTypes := app.Flag("eventType", "Which event types to report.").Enums(allEventTypes...)
-	notEventTypes := app.Flag("notEventType", "Which eventtypes to exclude. (Cannot combine with --eventTypes)").Enums(allEventTypes...)
-	stepTypes := app.Flag("stepType", "Which step message types to report.").Enums(allMsgTypes...)
-	notStepTypes := app.Flag("notStepType", "Which step message types to exclude. (Cannot combine with --stepTypes)").Enums(allMsgTypes...)
-	verboseText := app.Flag("verboseText", "Whether to be verbose (output full bytes) in the text frmatting.").Default("false").Bool()
-	statusIndices := app.Flag("statusIndex", "Print node status at given index in the log (repeatable).").Uint64List()
-	logLevel := app.Flag("logLevel", "When run in interactive mode, the log level for the state machine with which to output.").Enum("debug", "info", "warn", "error")
-
-	_, err := app.Parse(args)
+
+	events := app.Command("events", "Print, filter, and optionally replay a state event log (the default).").Default()
+	input := events.Flag("input", "The input file to read (defaults to stdin).").Default(os.Stdin.Name()).File()
+	manifestDir := events.Flag("manifest", "A directory of segments written by a rotating recorder to read instead of the input.").ExistingDir()
+	segment := &optionalUint64{}
+	events.Flag("segment", "The segment number in the manifest to begin reading from (defaults to the oldest retained).").SetValue(segment)
+	startIndex := &optionalUint64{}
+	events.Flag("startIndex", "The index of the first event to print, seeks directly to it if the log is indexed.").SetValue(startIndex)
+	startTime := &optionalUint64{}
+	events.Flag("startTime", "Begin printing at the first event recorded at or after this time.").SetValue(startTime)
+	interactive := events.Flag("interactive", "Whether to apply this log to a Mir state machine.").Default("false").Bool()
+	nodeIDs := events.Flag("nodeID", "Report events from this nodeID only (useful for interleaved logs), may be repeated").Uint64List()
+	eventTypes := events.Flag("eventType", "Which event types to report.").Enums(allEventTypes...)
+	notEventTypes := events.Flag("notEventType", "Which eventtypes to exclude. (Cannot combine with --eventTypes)").Enums(allEventTypes...)
+	stepTypes := events.Flag("stepType", "Which step message types to report.").Enums(allMsgTypes...)
+	notStepTypes := events.Flag("notStepType", "Which step message types to exclude. (Cannot combine with --stepTypes)").Enums(allMsgTypes...)
+	verboseText := events.Flag("verboseText", "Whether to be verbose (output full bytes) in the text frmatting.").Default("false").Bool()
+	format := events.Flag("format", "The output format, the json formats emit one record per event including any actions and status.").Default(formatText).Enum(allFormats...)
+	statusIndices := events.Flag("statusIndex", "Print node status at given index in the log (repeatable).").Uint64List()
+	logLevel := events.Flag("logLevel", "When run in interactive mode, the log level for the state machine with which to output.").Enum("debug", "info", "warn", "error")
+
+	check := app.Command("check", "Replay the logs of several nodes and verify that they committed and checkpointed identically.")
+	checkInputs := check.Flag("input", "An input file to read (defaults to stdin), may be repeated, and may contain the interleaved events of multiple nodes.").ExistingFiles()
+
+	stats := app.Command("stats", "Report statistics about the events, requests, epochs, and checkpoints of a state event log.")
+	statsInput := stats.Flag("input", "The input file to read (defaults to stdin).").Default(os.Stdin.Name()).File()
+	statsFormat := stats.Flag("format", "The output format.").Default(formatText).Enum(formatText, formatJSON)
+
+	diagram := app.Command("diagram", "Render the messages exchanged between nodes as a sequence diagram or graph.")
+	diagramInput := diagram.Flag("input", "The input file to read (defaults to stdin).").Default(os.Stdin.Name()).File()
+	diagramFormat := diagram.Flag("format", "The diagram format.").Default(diagramMermaid).Enum(diagramMermaid, diagramPlantUML, diagramDot)
+	diagramSeqNo := &optionalUint64{}
+	diagram.Flag("seqNo", "Include only messages for this sequence number.").SetValue(diagramSeqNo)
+	diagramEpoch := &optionalUint64{}
+	diagram.Flag("epoch", "Include only messages for this epoch.").SetValue(diagramEpoch)
+	diagramStepTypes := diagram.Flag("stepType", "Include only messages of this type (repeatable).").Enums(allMsgTypes...)
+	diagramStart := &optionalUint64{}
+	diagram.Flag("startIndex", "Include only messages sent or received at or after this event index.").SetValue(diagramStart)
+	diagramEnd := &optionalUint64{}
+	diagram.Flag("endIndex", "Include only messages sent or received at or before this event index.").SetValue(diagramEnd)
+
+	verify := app.Command("verify", "Replay a state event log recorded with results, and report the first event whose actions differ from those recorded.")
+	verifyInput := verify.Flag("input", "The input file to read (defaults to stdin).").Default(os.Stdin.Name()).File()
+	verifyVerboseText := verify.Flag("verboseText", "Whether to be verbose (output full bytes) in the text frmatting.").Default("false").Bool()
+	verifyLogLevel := verify.Flag("logLevel", "The log level for the state machine with which to output.").Default("error").Enum("debug", "info", "warn", "error")
+
+	extract := app.Command("extract", "Write the events of some nodes within an index or time range to a new state event log.")
+	extractInput := extract.Flag("input", "The input file to read (defaults to stdin).").Default(os.Stdin.Name()).File()
+	extractOutput := extract.Flag("output", "The file to write the new log to (defaults to stdout).").String()
+	extractNodeIDs := extract.Flag("nodeID", "Extract events from this nodeID only, may be repeated.").Uint64List()
+	extractStartIndex := &optionalUint64{}
+	extract.Flag("startIndex", "The index of the first event to extract.").SetValue(extractStartIndex)
+	extractEndIndex := &optionalUint64{}
+	extract.Flag("endIndex", "The index of the last event to extract.").SetValue(extractEndIndex)
+	extractStartTime := &optionalUint64{}
+	extract.Flag("startTime", "Extract only events recorded at or after this time.").SetValue(extractStartTime)
+	extractEndTime := &optionalUint64{}
+	extract.Flag("endTime", "Extract only events recorded at or before this time.").SetValue(extractEndTime)
+
+	merge := app.Command("merge", "Interleave the events of several state event logs, such as those of each node, into a single log ordered by time.")
+	mergeInputs := merge.Flag("input", "An input file to read, must be repeated for each log to merge.").Required().ExistingFiles()
+	mergeOutput := merge.Flag("output", "The file to write the merged log to (defaults to stdout).").String()
+
+	redact := app.Command("redact", "Write a copy of a state event log with all request payload data removed.")
+	redactInput := redact.Flag("input", "The input file to read (defaults to stdin).").Default(os.Stdin.Name()).File()
+	redactOutput := redact.Flag("output", "The file to write the redacted log to (defaults to stdout).").String()
+
+	debug := app.Command("debug", "Interactively step through a state event log, with breakpoints, reading commands from stdin.")
+	debugInput := debug.Flag("input", "The input file to read.").Required().File()
+	debugVerboseText := debug.Flag("verboseText", "Whether to be verbose (output full bytes) in the text frmatting.").Default("false").Bool()
+	debugLogLevel := debug.Flag("logLevel", "The log level for the state machine with which to output.").Default("info").Enum("debug", "info", "warn", "error")
+
+	wal := app.Command("wal", "Inspect and repair a simplewal write-ahead-log directory.")
+	walDir := wal.Flag("dir", "The simplewal directory to operate on.").Required().ExistingDir()
+	walNodeID := wal.Flag("nodeID", "The ID of the node which wrote the WAL, used when validating.").Default("0").Uint64()
+	walPrintCmd := wal.Command("print", "Print each entry in the WAL.")
+	walVerboseText := walPrintCmd.Flag("verboseText", "Whether to be verbose (output full bytes) in the text frmatting.").Default("false").Bool()
+	walSummaryCmd := wal.Command("summary", "Summarize the epoch and checkpoint structure of the WAL.")
+	walCheckCmd := wal.Command("check", "Validate that the WAL satisfies the invariants required to start a node.")
+	walTruncateCmd := wal.Command("truncate", "Remove entries from the WAL, provided the remaining entries are valid.  The original WAL is retained as a backup.")
+	walBefore := &optionalUint64{}
+	walTruncateCmd.Flag("before", "Remove all entries before this index.").SetValue(walBefore)
+	walAfter := &optionalUint64{}
+	walTruncateCmd.Flag("after", "Remove all entries after this index.").SetValue(walAfter)
+	walDryRun := walTruncateCmd.Flag("dryRun", "Validate the entries which would remain, but do not modify the WAL.").Default("false").Bool()
+
+	cmd, err := app.Parse(args)
 	if err != nil {
 		return nil, err
 	}
 
+	walArgs := &walArguments{
+		dir:         *walDir,
+		nodeID:      *walNodeID,
+		verboseText: *walVerboseText,
+	}
+
+	switch cmd {
+	case diagram.FullCommand():
+		if diagramStart.value != nil && diagramEnd.value != nil && *diagramStart.value > *diagramEnd.value {
+			return nil, errors.Errorf("--startIndex must not exceed --endIndex")
+		}
+		return &diagramArguments{
+			input:      *diagramInput,
+			format:     *diagramFormat,
+			seqNo:      diagramSeqNo.value,
+			epoch:      diagramEpoch.value,
+			msgTypes:   *diagramStepTypes,
+			startIndex: diagramStart.value,
+			endIndex:   diagramEnd.value,
+		}, nil
+	case stats.FullCommand():
+		return &statsArguments{
+			input:  *statsInput,
+			format: *statsFormat,
+		}, nil
+	case extract.FullCommand():
+		switch {
+		case extractStartIndex.value != nil && extractEndIndex.value != nil && *extractStartIndex.value > *extractEndIndex.value:
+			return nil, errors.Errorf("--startIndex must not exceed --endIndex")
+		case extractStartTime.value != nil && extractEndTime.value != nil && *extractStartTime.value > *extractEndTime.value:
+			return nil, errors.Errorf("--startTime must not exceed --endTime")
+		}
+		return &extractArguments{
+			input:      *extractInput,
+			output:     *extractOutput,
+			nodeIDs:    *extractNodeIDs,
+			startIndex: extractStartIndex.value,
+			endIndex:   extractEndIndex.value,
+			startTime:  extractStartTime.value,
+			endTime:    extractEndTime.value,
+		}, nil
+	case merge.FullCommand():
+		mergeArgs := &mergeArguments{
+			output: *mergeOutput,
+		}
+		for _, path := range *mergeInputs {
+			input, err := os.Open(path)
+			if err != nil {
+				mergeArgs.close()
+				return nil, errors.WithMessage(err, "could not open input")
+			}
+			mergeArgs.inputs = append(mergeArgs.inputs, input)
+		}
+		return mergeArgs, nil
+	case redact.FullCommand():
+		return &redactArguments{
+			input:  *redactInput,
+			output: *redactOutput,
+		}, nil
+	case verify.FullCommand():
+		return &verifyArguments{
+			input:    *verifyInput,
+			logLevel: parseLogLevel(*verifyLogLevel),
+			verbose:  *verifyVerboseText,
+		}, nil
+	case debug.FullCommand():
+		return &debugArguments{
+			input:    *debugInput,
+			commands: os.Stdin,
+			logLevel: parseLogLevel(*debugLogLevel),
+			verbose:  *debugVerboseText,
+		}, nil
+	case check.FullCommand():
+		checkArgs := &checkArguments{}
+		for _, path := range *checkInputs {
+			input, err := os.Open(path)
+			if err != nil {
+				checkArgs.close()
+				return nil, errors.WithMessage(err, "could not open input")
+			}
+			checkArgs.inputs = append(checkArgs.inputs, input)
+		}
+		if len(checkArgs.inputs) == 0 {
+			checkArgs.inputs = []io.ReadCloser{os.Stdin}
+		}
+		return checkArgs, nil
+	case walPrintCmd.FullCommand():
+		walArgs.operation = walPrint
+		return walArgs, nil
+	case walSummaryCmd.FullCommand():
+		walArgs.operation = walSummary
+		return walArgs, nil
+	case walCheckCmd.FullCommand():
+		walArgs.operation = walCheck
+		return walArgs, nil
+	case walTruncateCmd.FullCommand():
+		walArgs.operation = walTruncate
+		walArgs.before = walBefore.value
+		walArgs.after = walAfter.value
+		walArgs.dryRun = *walDryRun
+		if (walArgs.before == nil) == (walArgs.after == nil) {
+			return nil, errors.Errorf("must set exactly one of --before and --after")
+		}
+		return walArgs, nil
+	}
+
 	switch {
+	case *manifestDir != "" && (*input).Name() != os.Stdin.Name():
+		return nil, errors.Errorf("cannot set both --input and --manifest")
+	case segment.value != nil && *manifestDir == "":
+		return nil, errors.Errorf("cannot set --segment without --manifest")
+	case startIndex.value != nil && startTime.value != nil:
+		return nil, errors.Errorf("cannot set both --startIndex and --startTime")
+	case (startIndex.value != nil || startTime.value != nil) && *manifestDir != "":
+		return nil, errors.Errorf("cannot set --startIndex or --startTime with --manifest")
+	case (startIndex.value != nil || startTime.value != nil) && *interactive:
+		return nil, errors.Errorf("cannot set --startIndex or --startTime for interactive playback")
 	case *eventTypes != nil && *notEventTypes != nil:
 		return nil, errors.Errorf("cannot set both --eventType and --notEventType")
 	case *stepTypes != nil && *notStepTypes != nil:
@@ -451,30 +858,22 @@ func parseArgs(args []string) (*arguments, error) {
 		return nil, errors.Errorf("cannot set logLevel for non-interactive playback")
 	}
 
-	mirLogLevel := statemachine.LevelInfo
-
-	switch *logLevel {
-	case "debug":
-		mirLogLevel = statemachine.LevelDebug
-	case "info":
-		mirLogLevel = statemachine.LevelInfo
-	case "warn":
-		mirLogLevel = statemachine.LevelWarn
-	case "error":
-		mirLogLevel = statemachine.LevelError
-	}
-
 	return &arguments{
 		input:         *input,
+		manifestDir:   *manifestDir,
+		segment:       segment.value,
+		startIndex:    startIndex.value,
+		startTime:     startTime.value,
 		interactive:   *interactive,
 		nodeIDs:       *nodeIDs,
 		eventTypes:    *eventTypes,
-		logLevel:      mirLogLevel,
+		logLevel:      parseLogLevel(*logLevel),
 		notEventTypes: *notEventTypes,
 		stepTypes:     *stepTypes,
 		notStepTypes:  *notStepTypes,
 		verboseText:   *verboseText,
 		statusIndices: *statusIndices,
+		format:        *format,
 	}, nil
 }
 
@@ -3,36 +3,28 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
+	"encoding/json"
+	"io"
 	"io/ioutil"
+	"os"
+	"strings"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
-	"github.com/IBM/mirbft/pkg/testengine"
+	pb "github.com/IBM/mirbft/mirbftpb"
+	"github.com/IBM/mirbft/pkg/eventlog"
 )
 
-var _ = Describe("Parsing", func() {
-	var (
-		logBytes *bytes.Buffer
-	)
-
-	BeforeEach(func() {
-		logBytes = &bytes.Buffer{}
-		gzWriter := gzip.NewWriter(logBytes)
-		defer gzWriter.Close()
+type walSourceFunc func(forEach func(index uint64, p *pb.Persistent)) error
 
-		recorder := testengine.BasicRecorder(4, 4, 20)
-		recorder.NetworkState.Config.MaxEpochLength = 200000 // XXX this works around a bug in the library for now
-
-		recording, err := recorder.Recording(gzWriter)
-		Expect(err).NotTo(HaveOccurred())
-
-		_, err = recording.DrainClients(5000)
-		Expect(err).NotTo(HaveOccurred())
-	})
+func (wsf walSourceFunc) LoadAll(forEach func(index uint64, p *pb.Persistent)) error {
+	return wsf(forEach)
+}
 
+var _ = Describe("Parsing", func() {
 	It("parses a fully populated command line", func() {
-		args, err := parseArgs([]string{
+		cmd, err := parseArgs([]string{
 			"--input", "main.go",
 			"--interactive",
 			"--nodeID", "1",
@@ -44,8 +36,11 @@ var _ = Describe("Parsing", func() {
 			"--statusIndex", "301",
 			"--statusIndex", "305",
 			"--verboseText",
+			"--format", "jsonl",
 		})
 		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(BeAssignableToTypeOf(&arguments{}))
+		args := cmd.(*arguments)
 		Expect(args.input).NotTo(BeNil())
 		Expect(args.input.Close()).NotTo(HaveOccurred())
 		Expect(args.interactive).To(BeTrue())
@@ -53,6 +48,7 @@ var _ = Describe("Parsing", func() {
 		Expect(args.eventTypes).To(Equal([]string{"Step", "Tick"}))
 		Expect(args.statusIndices).To(Equal([]uint64{301, 305}))
 		Expect(args.verboseText).To(BeTrue())
+		Expect(args.format).To(Equal("jsonl"))
 	})
 
 	When("both event includes and event excludes are present", func() {
@@ -75,6 +71,56 @@ var _ = Describe("Parsing", func() {
 		})
 	})
 
+	It("parses a manifest and segment", func() {
+		cmd, err := parseArgs([]string{
+			"--manifest", ".",
+			"--segment", "3",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		args := cmd.(*arguments)
+		Expect(args.manifestDir).To(Equal("."))
+		Expect(*args.segment).To(Equal(uint64(3)))
+	})
+
+	When("a segment is specified without a manifest", func() {
+		It("returns an error", func() {
+			_, err := parseArgs([]string{
+				"--segment", "3",
+			})
+			Expect(err).To(MatchError("cannot set --segment without --manifest"))
+		})
+	})
+
+	It("parses a start index", func() {
+		cmd, err := parseArgs([]string{
+			"--startIndex", "30",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		args := cmd.(*arguments)
+		Expect(*args.startIndex).To(Equal(uint64(30)))
+		Expect(args.startTime).To(BeNil())
+	})
+
+	When("both a start index and a start time are specified", func() {
+		It("returns an error", func() {
+			_, err := parseArgs([]string{
+				"--startIndex", "30",
+				"--startTime", "500",
+			})
+			Expect(err).To(MatchError("cannot set both --startIndex and --startTime"))
+		})
+	})
+
+	When("a start time is specified for interactive playback", func() {
+		It("returns an error", func() {
+			_, err := parseArgs([]string{
+				"--startTime", "500",
+				"--interactive",
+			})
+			Expect(err).To(MatchError("cannot set --startIndex or --startTime for interactive playback"))
+		})
+	})
+
 	When("status indexes are specified, but interactive is not", func() {
 		It("returns an error", func() {
 			_, err := parseArgs([]string{
@@ -93,19 +139,8 @@ var _ = Describe("Execution", func() {
 	)
 
 	BeforeEach(func() {
-		logBytes = &bytes.Buffer{}
+		logBytes = newBasicLog()
 		output = &bytes.Buffer{}
-		gzWriter := gzip.NewWriter(logBytes)
-		defer gzWriter.Close()
-
-		recorder := testengine.BasicRecorder(4, 4, 20)
-		recorder.NetworkState.Config.MaxEpochLength = 200000 // XXX this works around a bug in the library for now
-
-		recording, err := recorder.Recording(gzWriter)
-		Expect(err).NotTo(HaveOccurred())
-
-		_, err = recording.DrainClients(5000)
-		Expect(err).NotTo(HaveOccurred())
 
 		args = &arguments{
 			input:       ioutil.NopCloser(logBytes),
@@ -116,6 +151,222 @@ var _ = Describe("Execution", func() {
 		}
 	})
 
+	When("the log was written by a rotating recorder", func() {
+		var (
+			dir string
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "mircat-segments")
+			Expect(err).NotTo(HaveOccurred())
+
+			reader, err := eventlog.NewReader(logBytes)
+			Expect(err).NotTo(HaveOccurred())
+
+			// The snapshots are skipped when replaying every segment, so
+			// the entries loaded at startup suffice as the WAL source.  The
+			// recorder is unbuffered, so that the short log still spans
+			// several segments.
+			var eventTime int64
+			var loaded []*pb.StateEvent_PersistedEntry
+			recorder, err := eventlog.NewRotatingRecorder(
+				0,
+				dir,
+				eventlog.TimeSourceOpt(func() int64 { return eventTime }),
+				eventlog.SegmentSizeOpt(0),
+				eventlog.SegmentDurationOpt(500),
+				eventlog.RetainSegmentsOpt(0),
+				eventlog.BufferSizeOpt(0),
+				eventlog.WALSourceOpt(walSourceFunc(func(forEach func(index uint64, p *pb.Persistent)) error {
+					for _, entry := range loaded {
+						forEach(entry.Index, entry.Data)
+					}
+					return nil
+				})),
+			)
+			Expect(err).NotTo(HaveOccurred())
+			for {
+				event, err := reader.ReadEvent()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).NotTo(HaveOccurred())
+				if event.NodeId == 0 {
+					eventTime = event.Time
+					if entry := event.StateEvent.GetLoadEntry(); entry != nil {
+						loaded = append(loaded, entry)
+					}
+					Expect(recorder.Intercept(event.StateEvent)).To(Succeed())
+				}
+			}
+			Expect(recorder.Stop()).To(Succeed())
+
+			args.input = ioutil.NopCloser(&bytes.Buffer{})
+			args.manifestDir = dir
+			args.nodeIDs = []uint64{0}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("replays every segment in order", func() {
+			manifest, err := eventlog.ReadManifest(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(manifest.Segments)).To(BeNumerically(">", 1))
+
+			err = args.execute(output)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.Count(output.String(), "initialize=")).To(Equal(1))
+			Expect(output.String()).To(ContainSubstring("Node 0 successfully completed execution"))
+		})
+	})
+
+	When("the log is indexed", func() {
+		var (
+			file *os.File
+		)
+
+		BeforeEach(func() {
+			var err error
+			file, err = ioutil.TempFile("", "mircat-indexed")
+			Expect(err).NotTo(HaveOccurred())
+
+			reader, err := eventlog.NewReader(logBytes)
+			Expect(err).NotTo(HaveOccurred())
+
+			writer, err := eventlog.NewBlockWriter(file, gzip.DefaultCompression, 4096)
+			Expect(err).NotTo(HaveOccurred())
+			for {
+				event, err := reader.ReadEvent()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).NotTo(HaveOccurred())
+				Expect(writer.Write(event)).To(Succeed())
+			}
+			Expect(writer.Close()).To(Succeed())
+
+			_, err = file.Seek(0, io.SeekStart)
+			Expect(err).NotTo(HaveOccurred())
+
+			args = &arguments{
+				input:      file,
+				nodeIDs:    []uint64{0},
+				eventTypes: []string{"Tick"},
+			}
+		})
+
+		AfterEach(func() {
+			os.Remove(file.Name())
+		})
+
+		It("begins at the start index", func() {
+			startIndex := uint64(3000)
+			args.startIndex = &startIndex
+			err := args.execute(output)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.String()).NotTo(ContainSubstring("node_id=0 time=0 "))
+			Expect(output.String()).To(MatchRegexp(`^ *3\d\d\d \[node_id=0 `))
+		})
+
+		It("begins at the start time", func() {
+			startTime := uint64(1000)
+			args.startTime = &startTime
+			err := args.execute(output)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.String()).To(HavePrefix(" "))
+			Expect(output.String()).To(ContainSubstring("node_id=0 time=1000 "))
+			Expect(output.String()).NotTo(ContainSubstring("node_id=0 time=500 "))
+		})
+	})
+
+	When("the log contains a gap", func() {
+		BeforeEach(func() {
+			flightRecorder, err := eventlog.NewFlightRecorder(0, 2, eventlog.TimeSourceOpt(func() int64 { return 0 }))
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < 3; i++ {
+				Expect(flightRecorder.Intercept(&pb.StateEvent{
+					Type: &pb.StateEvent_Tick{
+						Tick: &pb.StateEvent_TickElapsed{},
+					},
+				})).To(Succeed())
+			}
+			logBytes.Reset()
+			Expect(flightRecorder.Dump(logBytes)).To(Succeed())
+			args.eventTypes = nil
+			args.stepTypes = nil
+		})
+
+		It("prints the gap", func() {
+			args.interactive = false
+			err := args.execute(output)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.String()).To(HavePrefix("     1 [node_id=0 time=0 gap=[dropped_events=1]]\n"))
+		})
+
+		It("cannot be replayed", func() {
+			err := args.execute(output)
+			Expect(err).To(MatchError("cannot replay log, 1 events were dropped at index 1"))
+		})
+	})
+
+	When("the format is jsonl", func() {
+		BeforeEach(func() {
+			args.format = formatJSONL
+			args.interactive = false
+		})
+
+		It("writes one record per line", func() {
+			err := args.execute(output)
+			Expect(err).NotTo(HaveOccurred())
+			lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+			Expect(lines[0]).To(Equal(`{"index":1,"event":{"state_event":{"initialize":{"batch_size":1,"heartbeat_ticks":2,"suspect_ticks":4,"new_epoch_timeout_ticks":8,"buffer_size":5242880}}}}`))
+			for _, line := range lines {
+				r := &record{}
+				Expect(json.Unmarshal([]byte(line), r)).To(Succeed())
+				Expect(r.Event).NotTo(BeNil())
+				Expect(r.Actions).To(BeNil())
+			}
+		})
+	})
+
+	When("the format is json and the playback is interactive", func() {
+		BeforeEach(func() {
+			args.format = formatJSON
+			args.statusIndices = []uint64{7}
+		})
+
+		It("writes an array of records with actions and status", func() {
+			err := args.execute(output)
+			Expect(err).NotTo(HaveOccurred())
+
+			var records []*record
+			Expect(json.Unmarshal(output.Bytes(), &records)).To(Succeed())
+
+			var statuses, actions, completions int
+			for _, r := range records {
+				if r.Status != nil {
+					statuses++
+					Expect(r.Index).To(Equal(uint64(7)))
+					Expect(r.Event).NotTo(BeNil())
+					Expect(r.Status.NodeID).To(Equal(uint64(0)))
+				}
+				if r.Actions != nil {
+					actions++
+				}
+				if r.Completed != nil {
+					completions++
+				}
+			}
+			Expect(statuses).To(Equal(1))
+			Expect(actions).To(BeNumerically(">", 0))
+			Expect(completions).To(Equal(2))
+			Expect(records[len(records)-1].Completed.NodeID).To(Equal(uint64(2)))
+		})
+	})
+
 	It("reads from the source", func() {
 		err := args.execute(output)
 		Expect(err).NotTo(HaveOccurred())
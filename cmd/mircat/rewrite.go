@@ -0,0 +1,318 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	"github.com/IBM/mirbft/pkg/eventlog"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+)
+
+// logWriter writes the events of a new recording, either to a file, or if
+// no path is given, to the command's output.
+type logWriter struct {
+	path     string
+	file     *os.File
+	gzWriter *gzip.Writer
+	written  uint64
+}
+
+func newLogWriter(path string, output io.Writer) (*logWriter, error) {
+	lw := &logWriter{
+		path: path,
+	}
+
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, errors.WithMessage(err, "could not create output")
+		}
+		lw.file = file
+		output = file
+	}
+
+	lw.gzWriter = gzip.NewWriter(output)
+	return lw, nil
+}
+
+func (lw *logWriter) write(event *rpb.RecordedEvent) error {
+	if err := eventlog.WriteRecordedEvent(lw.gzWriter, event); err != nil {
+		return errors.WithMessage(err, "could not write event")
+	}
+	lw.written++
+	return nil
+}
+
+// close flushes the recording, and if it was written to a file, reports the
+// number of events written to the command's output.
+func (lw *logWriter) close(output io.Writer, read uint64) error {
+	if err := lw.gzWriter.Close(); err != nil {
+		return errors.WithMessage(err, "could not flush output")
+	}
+
+	if lw.file == nil {
+		return nil
+	}
+
+	if err := lw.file.Close(); err != nil {
+		return errors.WithMessage(err, "could not close output")
+	}
+
+	fmt.Fprintf(output, "Wrote %d of %d events to %s\n", lw.written, read, lw.path)
+	return nil
+}
+
+// abort discards a partially written recording.
+func (lw *logWriter) abort() {
+	if lw.file == nil {
+		return
+	}
+	lw.file.Close()
+	os.Remove(lw.path)
+}
+
+// extractArguments are the arguments for the 'extract' subcommand, which
+// writes the events of some nodes within an index or time range to a new log.
+type extractArguments struct {
+	input      io.ReadCloser
+	output     string
+	nodeIDs    []uint64
+	startIndex *uint64
+	endIndex   *uint64
+	startTime  *uint64
+	endTime    *uint64
+}
+
+func (ea *extractArguments) selected(index uint64, event *rpb.RecordedEvent) bool {
+	switch {
+	case ea.startIndex != nil && index < *ea.startIndex:
+		return false
+	case ea.startTime != nil && event.Time < int64(*ea.startTime):
+		return false
+	case ea.endTime != nil && event.Time > int64(*ea.endTime):
+		return false
+	case ea.nodeIDs != nil && !uint64SliceContains(ea.nodeIDs, event.NodeId):
+		return false
+	default:
+		return true
+	}
+}
+
+func uint64SliceContains(values []uint64, value uint64) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (ea *extractArguments) execute(output io.Writer) (err error) {
+	defer ea.input.Close()
+
+	reader, err := eventlog.NewReader(ea.input)
+	if err != nil {
+		return errors.WithMessage(err, "bad input file")
+	}
+
+	lw, err := newLogWriter(ea.output, output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			lw.abort()
+		}
+	}()
+
+	index := uint64(0)
+	for ea.endIndex == nil || index < *ea.endIndex {
+		event, err := reader.ReadEvent()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.WithMessage(err, "failed reading input")
+		}
+
+		index++
+
+		if !ea.selected(index, event) {
+			continue
+		}
+
+		if err := lw.write(event); err != nil {
+			return err
+		}
+	}
+
+	return lw.close(output, index)
+}
+
+// mergeArguments are the arguments for the 'merge' subcommand, which
+// interleaves the events of several logs into a single time-ordered log.
+type mergeArguments struct {
+	inputs []io.ReadCloser
+	output string
+}
+
+func (ma *mergeArguments) close() {
+	for _, input := range ma.inputs {
+		input.Close()
+	}
+}
+
+func (ma *mergeArguments) execute(output io.Writer) (err error) {
+	defer ma.close()
+
+	readers := make([]*eventlog.Reader, len(ma.inputs))
+	heads := make([]*rpb.RecordedEvent, len(ma.inputs))
+	next := func(i int) error {
+		event, err := readers[i].ReadEvent()
+		switch {
+		case err == io.EOF:
+			heads[i] = nil
+		case err != nil:
+			return errors.WithMessagef(err, "failed reading input %d", i)
+		default:
+			heads[i] = event
+		}
+		return nil
+	}
+
+	for i, input := range ma.inputs {
+		reader, err := eventlog.NewReader(input)
+		if err != nil {
+			return errors.WithMessagef(err, "bad input file %d", i)
+		}
+		readers[i] = reader
+		if err := next(i); err != nil {
+			return err
+		}
+	}
+
+	lw, err := newLogWriter(ma.output, output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			lw.abort()
+		}
+	}()
+
+	for {
+		// The events of each input remain in their original order,
+		// and simultaneous events are taken from the earlier input.
+		earliest := -1
+		for i, head := range heads {
+			if head != nil && (earliest == -1 || head.Time < heads[earliest].Time) {
+				earliest = i
+			}
+		}
+
+		if earliest == -1 {
+			break
+		}
+
+		if err := lw.write(heads[earliest]); err != nil {
+			return err
+		}
+
+		if err := next(earliest); err != nil {
+			return err
+		}
+	}
+
+	return lw.close(output, lw.written)
+}
+
+// redactArguments are the arguments for the 'redact' subcommand, which
+// removes request payload data from a log.
+type redactArguments struct {
+	input  io.ReadCloser
+	output string
+}
+
+var (
+	forwardRequestDataField = (&pb.ForwardRequest{}).ProtoReflect().Descriptor().Fields().ByName("request_data")
+	requestDataField        = (&pb.Request{}).ProtoReflect().Descriptor().Fields().ByName("data")
+)
+
+// redactRequestData clears the request payload data held anywhere within
+// the message.  The request acks, and therefore digests, are retained, so the
+// redacted log may still be replayed.
+func redactRequestData(m protoreflect.Message) {
+	switch m.Descriptor().FullName() {
+	case forwardRequestDataField.ContainingMessage().FullName():
+		m.Clear(forwardRequestDataField)
+	case requestDataField.ContainingMessage().FullName():
+		m.Clear(requestDataField)
+	}
+
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.Message() == nil || fd.IsMap():
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				redactRequestData(list.Get(i).Message())
+			}
+		default:
+			redactRequestData(v.Message())
+		}
+		return true
+	})
+}
+
+func (ra *redactArguments) execute(output io.Writer) (err error) {
+	defer ra.input.Close()
+
+	reader, err := eventlog.NewReader(ra.input)
+	if err != nil {
+		return errors.WithMessage(err, "bad input file")
+	}
+
+	lw, err := newLogWriter(ra.output, output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			lw.abort()
+		}
+	}()
+
+	index := uint64(0)
+	for {
+		event, err := reader.ReadEvent()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.WithMessage(err, "failed reading input")
+		}
+
+		index++
+
+		redactRequestData(event.ProtoReflect())
+
+		if err := lw.write(event); err != nil {
+			return err
+		}
+	}
+
+	return lw.close(output, index)
+}
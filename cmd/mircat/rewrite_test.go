@@ -0,0 +1,231 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	"github.com/IBM/mirbft/pkg/eventlog"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+)
+
+// readLog returns all of the events of the log.
+func readLog(source io.Reader) []*rpb.RecordedEvent {
+	reader, err := eventlog.NewReader(source)
+	Expect(err).NotTo(HaveOccurred())
+
+	var events []*rpb.RecordedEvent
+	for {
+		event, err := reader.ReadEvent()
+		if err == io.EOF {
+			return events
+		}
+		Expect(err).NotTo(HaveOccurred())
+		events = append(events, event)
+	}
+}
+
+var _ = Describe("Rewrite", func() {
+	var output *bytes.Buffer
+
+	BeforeEach(func() {
+		output = &bytes.Buffer{}
+	})
+
+	It("parses the extract arguments", func() {
+		cmd, err := parseArgs([]string{
+			"extract",
+			"--input", "main.go",
+			"--output", "out.gz",
+			"--nodeID", "1",
+			"--nodeID", "2",
+			"--startTime", "10",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(BeAssignableToTypeOf(&extractArguments{}))
+		ea := cmd.(*extractArguments)
+		Expect(ea.output).To(Equal("out.gz"))
+		Expect(ea.nodeIDs).To(Equal([]uint64{1, 2}))
+		Expect(*ea.startTime).To(Equal(uint64(10)))
+		Expect(ea.endTime).To(BeNil())
+		Expect(ea.input.Close()).To(Succeed())
+
+		_, err = parseArgs([]string{
+			"extract",
+			"--input", "main.go",
+			"--startTime", "10",
+			"--endTime", "5",
+		})
+		Expect(err).To(MatchError("--startTime must not exceed --endTime"))
+	})
+
+	It("parses the merge arguments", func() {
+		cmd, err := parseArgs([]string{
+			"merge",
+			"--input", "main.go",
+			"--input", "check.go",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(BeAssignableToTypeOf(&mergeArguments{}))
+		ma := cmd.(*mergeArguments)
+		Expect(ma.inputs).To(HaveLen(2))
+		Expect(ma.output).To(Equal(""))
+		ma.close()
+	})
+
+	When("a recording is rewritten", func() {
+		var logBytes []byte
+
+		BeforeEach(func() {
+			logBytes = basicLog
+		})
+
+		extract := func(ea *extractArguments) *bytes.Buffer {
+			result := &bytes.Buffer{}
+			ea.input = ioutil.NopCloser(bytes.NewReader(logBytes))
+			Expect(ea.execute(result)).To(Succeed())
+			return result
+		}
+
+		It("extracts the events of a node within an index range", func() {
+			start, end := uint64(100), uint64(400)
+			events := readLog(extract(&extractArguments{
+				nodeIDs:    []uint64{1},
+				startIndex: &start,
+				endIndex:   &end,
+			}))
+			Expect(events).NotTo(BeEmpty())
+
+			var expected []*rpb.RecordedEvent
+			for _, event := range readLog(bytes.NewReader(logBytes))[99:400] {
+				if event.NodeId == 1 {
+					expected = append(expected, event)
+				}
+			}
+			Expect(events).To(HaveLen(len(expected)))
+			for i, event := range events {
+				Expect(proto.Equal(event, expected[i])).To(BeTrue())
+			}
+		})
+
+		It("merges the logs of each node back into a single log", func() {
+			ma := &mergeArguments{}
+			for _, nodeID := range []uint64{3, 2, 1, 0} {
+				nodeLog := extract(&extractArguments{nodeIDs: []uint64{nodeID}})
+				ma.inputs = append(ma.inputs, ioutil.NopCloser(nodeLog))
+			}
+
+			dir, err := ioutil.TempDir("", "mircat-merge")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			ma.output = filepath.Join(dir, "merged.gz")
+
+			Expect(ma.execute(output)).To(Succeed())
+			Expect(output.String()).To(Equal("Wrote 4257 of 4257 events to " + ma.output + "\n"))
+
+			merged, err := os.Open(ma.output)
+			Expect(err).NotTo(HaveOccurred())
+			defer merged.Close()
+			events := readLog(merged)
+			Expect(events).To(HaveLen(4257))
+			for i := 1; i < len(events); i++ {
+				Expect(events[i].Time).To(BeNumerically(">=", events[i-1].Time))
+			}
+
+			merged, err = os.Open(ma.output)
+			Expect(err).NotTo(HaveOccurred())
+			ca := &checkArguments{
+				inputs: []io.ReadCloser{merged},
+			}
+			checkOutput := &bytes.Buffer{}
+			Expect(ca.execute(checkOutput)).To(Succeed())
+			Expect(checkOutput.String()).To(ContainSubstring("4 nodes agree on 80 batches"))
+		})
+	})
+
+	It("redacts request data", func() {
+		ack := &pb.RequestAck{ClientId: 1, ReqNo: 2, Digest: []byte("digest")}
+		input := &bytes.Buffer{}
+		gzWriter := gzip.NewWriter(input)
+		event := &rpb.RecordedEvent{
+			NodeId: 1,
+			StateEvent: &pb.StateEvent{
+				Type: &pb.StateEvent_Step{
+					Step: &pb.StateEvent_InboundMsg{
+						Source: 2,
+						Msg: &pb.Msg{
+							Type: &pb.Msg_ForwardRequest{
+								ForwardRequest: &pb.ForwardRequest{
+									RequestAck:  ack,
+									RequestData: []byte("secret"),
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		event.Result = &pb.StateEventResult{
+			StoreRequests: []*pb.ForwardRequest{{
+				RequestAck:  ack,
+				RequestData: []byte("secret"),
+			}},
+		}
+		Expect(eventlog.WriteRecordedEvent(gzWriter, event)).To(Succeed())
+		Expect(gzWriter.Close()).To(Succeed())
+
+		ra := &redactArguments{
+			input: ioutil.NopCloser(input),
+		}
+		Expect(ra.execute(output)).To(Succeed())
+
+		events := readLog(output)
+		Expect(events).To(HaveLen(1))
+		forward := events[0].StateEvent.Type.(*pb.StateEvent_Step).Step.Msg.Type.(*pb.Msg_ForwardRequest).ForwardRequest
+		Expect(forward.RequestData).To(BeNil())
+		Expect(proto.Equal(forward.RequestAck, ack)).To(BeTrue())
+
+		result := events[0].Result
+		Expect(result).NotTo(BeNil())
+		Expect(result.StoreRequests).To(HaveLen(1))
+		Expect(result.StoreRequests[0].RequestData).To(BeNil())
+		Expect(proto.Equal(result.StoreRequests[0].RequestAck, ack)).To(BeTrue())
+	})
+
+	It("retains gap markers when redacting", func() {
+		input := &bytes.Buffer{}
+		gzWriter := gzip.NewWriter(input)
+		Expect(eventlog.WriteRecordedEvent(gzWriter, &rpb.RecordedEvent{
+			NodeId:  1,
+			Time:    3,
+			Dropped: 7,
+		})).To(Succeed())
+		Expect(gzWriter.Close()).To(Succeed())
+
+		ra := &redactArguments{
+			input: ioutil.NopCloser(input),
+		}
+		Expect(ra.execute(output)).To(Succeed())
+
+		events := readLog(output)
+		Expect(events).To(HaveLen(1))
+		dropped, ok := eventlog.GapMarker(events[0])
+		Expect(ok).To(BeTrue())
+		Expect(dropped).To(Equal(uint64(7)))
+	})
+})
@@ -0,0 +1,453 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	"github.com/IBM/mirbft/pkg/eventlog"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+	"github.com/IBM/mirbft/pkg/statemachine"
+)
+
+// statsArguments are the arguments for the 'stats' subcommand, which
+// replays a log and reports statistics about it.
+type statsArguments struct {
+	input  io.ReadCloser
+	format string
+}
+
+// distribution summarizes a set of samples, for latencies, the units
+// are those of the recorded event times (by default, milliseconds).
+type distribution struct {
+	Count uint64  `json:"count"`
+	Min   int64   `json:"min"`
+	Mean  float64 `json:"mean"`
+	P50   int64   `json:"p50"`
+	P90   int64   `json:"p90"`
+	P99   int64   `json:"p99"`
+	Max   int64   `json:"max"`
+}
+
+func newDistribution(samples []int64) distribution {
+	if len(samples) == 0 {
+		return distribution{}
+	}
+
+	sorted := append([]int64(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	var sum int64
+	for _, sample := range sorted {
+		sum += sample
+	}
+
+	percentile := func(p int) int64 {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+
+	return distribution{
+		Count: uint64(len(sorted)),
+		Min:   sorted[0],
+		Mean:  float64(sum) / float64(len(sorted)),
+		P50:   percentile(50),
+		P90:   percentile(90),
+		P99:   percentile(99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+func (d distribution) String() string {
+	if d.Count == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("count=%d min=%d mean=%.1f p50=%d p90=%d p99=%d max=%d", d.Count, d.Min, d.Mean, d.P50, d.P90, d.P99, d.Max)
+}
+
+type epochStats struct {
+	Number uint64 `json:"number"`
+	Start  int64  `json:"start"`
+	End    *int64 `json:"end,omitempty"`
+	// Duration is the time until the end of the epoch, or until the
+	// end of the log if the epoch is still active.
+	Duration int64  `json:"duration"`
+	Reason   string `json:"end_reason,omitempty"`
+}
+
+type nodeStats struct {
+	NodeID         uint64            `json:"node_id"`
+	EventCounts    map[string]uint64 `json:"event_counts"`
+	MsgCounts      map[string]uint64 `json:"msg_counts"`
+	RequestLatency distribution      `json:"request_latency"`
+	Epochs         []*epochStats     `json:"epochs"`
+	// CheckpointIntervals are the times between successive checkpoints
+	CheckpointIntervals distribution `json:"checkpoint_intervals"`
+	// CheckpointSeqIntervals are the sequences between successive checkpoints
+	CheckpointSeqIntervals distribution `json:"checkpoint_seq_intervals"`
+	// BufferDrops are the messages dropped by the state machine
+	// because its buffers were full, by component.
+	BufferDrops map[string]uint64 `json:"buffer_drops"`
+
+	// The following are used only while accumulating
+	acks             map[requestKey]int64
+	latencies        []int64
+	lastCheckpoint   *checkpointCommit
+	checkpointTimes  []int64
+	checkpointSeqNos []int64
+	localSuspicion   map[uint64]struct{}
+}
+
+type checkpointCommit struct {
+	time  int64
+	seqNo uint64
+}
+
+type statsReport struct {
+	Events uint64 `json:"events"`
+	// RecorderDrops is the number of events the recorder did not record,
+	// as indicated by gap markers.
+	RecorderDrops uint64 `json:"recorder_drops"`
+	// ReplayStopped is the index of the first gap, after which the
+	// statistics derived from replaying the log are incomplete.
+	ReplayStopped  uint64       `json:"replay_stopped,omitempty"`
+	StartTime      int64        `json:"start_time"`
+	EndTime        int64        `json:"end_time"`
+	Nodes          []*nodeStats `json:"nodes"`
+	RequestLatency distribution `json:"request_latency"`
+	BatchSizes     distribution `json:"batch_sizes"`
+
+	nodes        map[uint64]*nodeStats
+	firstAcks    map[requestKey]int64
+	firstCommits map[requestKey]int64
+	batches      map[uint64]int64
+}
+
+// statsLogger counts the messages dropped from the state machine's buffers,
+// discarding all other logs.
+type statsLogger struct {
+	node *nodeStats
+}
+
+func (sl statsLogger) Log(level statemachine.LogLevel, msg string, args ...interface{}) {
+	if msg != "dropping buffered msg" {
+		return
+	}
+
+	component := "unknown"
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] == "component" {
+			component = fmt.Sprint(args[i+1])
+		}
+	}
+	sl.node.BufferDrops[component]++
+}
+
+func (r *statsReport) node(nodeID uint64) *nodeStats {
+	ns, ok := r.nodes[nodeID]
+	if !ok {
+		ns = &nodeStats{
+			NodeID:         nodeID,
+			EventCounts:    map[string]uint64{},
+			MsgCounts:      map[string]uint64{},
+			BufferDrops:    map[string]uint64{},
+			acks:           map[requestKey]int64{},
+			localSuspicion: map[uint64]struct{}{},
+		}
+		r.nodes[nodeID] = ns
+	}
+	return ns
+}
+
+func (r *statsReport) ack(ns *nodeStats, time int64, ack *pb.RequestAck) {
+	key := requestKey{
+		clientID: ack.ClientId,
+		reqNo:    ack.ReqNo,
+	}
+
+	if _, ok := ns.acks[key]; !ok {
+		ns.acks[key] = time
+	}
+
+	if _, ok := r.firstAcks[key]; !ok {
+		r.firstAcks[key] = time
+	}
+}
+
+// persisted updates the epochs of the node for an entry written to,
+// or loaded from, its WAL.
+func (ns *nodeStats) persisted(time int64, entry *pb.Persistent) {
+	var active *epochStats
+	if len(ns.Epochs) > 0 && ns.Epochs[len(ns.Epochs)-1].End == nil {
+		active = ns.Epochs[len(ns.Epochs)-1]
+	}
+
+	end := func(reason string) {
+		if active == nil {
+			return
+		}
+		active.End = &time
+		active.Reason = reason
+	}
+
+	switch d := entry.Type.(type) {
+	case *pb.Persistent_NEntry:
+		number := d.NEntry.EpochConfig.Number
+		for _, epoch := range ns.Epochs {
+			if epoch.Number == number {
+				// Re-loaded on restart
+				return
+			}
+		}
+		end(fmt.Sprintf("superseded by epoch %d", number))
+		ns.Epochs = append(ns.Epochs, &epochStats{
+			Number: number,
+			Start:  time,
+		})
+	case *pb.Persistent_Suspect:
+		ns.localSuspicion[d.Suspect.Epoch] = struct{}{}
+	case *pb.Persistent_FEntry:
+		if active != nil && active.Number == d.FEntry.EndsEpochConfig.Number {
+			end("ended gracefully")
+		}
+	case *pb.Persistent_ECEntry:
+		if active == nil || active.Number >= d.ECEntry.EpochNumber {
+			return
+		}
+		if _, ok := ns.localSuspicion[active.Number]; ok {
+			end(fmt.Sprintf("suspected leader, epoch change to %d", d.ECEntry.EpochNumber))
+		} else {
+			end(fmt.Sprintf("joined epoch change to %d", d.ECEntry.EpochNumber))
+		}
+	}
+}
+
+func (r *statsReport) actions(ns *nodeStats, time int64, actions *pb.StateEventResult) {
+	for _, write := range actions.WriteAhead {
+		if write.Data != nil {
+			ns.persisted(time, write.Data)
+		}
+	}
+
+	for _, commit := range actions.Commits {
+		if commit.Batch == nil {
+			if ns.lastCheckpoint != nil && commit.SeqNo > ns.lastCheckpoint.seqNo {
+				ns.checkpointTimes = append(ns.checkpointTimes, time-ns.lastCheckpoint.time)
+				ns.checkpointSeqNos = append(ns.checkpointSeqNos, int64(commit.SeqNo-ns.lastCheckpoint.seqNo))
+			}
+			if ns.lastCheckpoint == nil || commit.SeqNo > ns.lastCheckpoint.seqNo {
+				ns.lastCheckpoint = &checkpointCommit{time: time, seqNo: commit.SeqNo}
+			}
+			continue
+		}
+
+		if _, ok := r.batches[commit.Batch.SeqNo]; !ok {
+			r.batches[commit.Batch.SeqNo] = int64(len(commit.Batch.Requests))
+		}
+
+		for _, request := range commit.Batch.Requests {
+			key := requestKey{
+				clientID: request.ClientId,
+				reqNo:    request.ReqNo,
+			}
+
+			if ackTime, ok := ns.acks[key]; ok {
+				ns.latencies = append(ns.latencies, time-ackTime)
+				// Only count the first commit, not re-commits
+				delete(ns.acks, key)
+			}
+
+			if _, ok := r.firstCommits[key]; !ok {
+				r.firstCommits[key] = time
+			}
+		}
+	}
+}
+
+func (r *statsReport) event(s *stateMachines, event *rpb.RecordedEvent) error {
+	if r.Events == 0 {
+		r.StartTime = event.Time
+	}
+	r.Events++
+	r.EndTime = event.Time
+
+	if dropped, ok := eventlog.GapMarker(event); ok {
+		// The state machines cannot be replayed past a gap, so
+		// only the event counts are accurate from here on.
+		r.RecorderDrops += dropped
+		if r.ReplayStopped == 0 {
+			r.ReplayStopped = r.Events
+		}
+		return nil
+	}
+
+	ns := r.node(event.NodeId)
+	ns.EventCounts[eventTypeName(event)]++
+
+	switch et := event.StateEvent.Type.(type) {
+	case *pb.StateEvent_Propose:
+		r.ack(ns, event.Time, et.Propose.Request)
+	case *pb.StateEvent_LoadEntry:
+		ns.persisted(event.Time, et.LoadEntry.Data)
+	case *pb.StateEvent_Step:
+		ns.MsgCounts[msgTypeName(et.Step.Msg)]++
+		if ack, ok := et.Step.Msg.Type.(*pb.Msg_RequestAck); ok {
+			r.ack(ns, event.Time, ack.RequestAck)
+		}
+	}
+
+	if r.ReplayStopped != 0 {
+		return nil
+	}
+
+	actions, err := s.apply(event)
+	if err != nil {
+		return err
+	}
+
+	if actions != nil {
+		r.actions(ns, event.Time, actions)
+	}
+
+	return nil
+}
+
+// finish computes the summary statistics once all events are processed.
+func (r *statsReport) finish() {
+	for _, ns := range r.nodes {
+		ns.RequestLatency = newDistribution(ns.latencies)
+		ns.CheckpointIntervals = newDistribution(ns.checkpointTimes)
+		ns.CheckpointSeqIntervals = newDistribution(ns.checkpointSeqNos)
+		for _, epoch := range ns.Epochs {
+			if epoch.End == nil {
+				epoch.Duration = r.EndTime - epoch.Start
+			} else {
+				epoch.Duration = *epoch.End - epoch.Start
+			}
+		}
+		r.Nodes = append(r.Nodes, ns)
+	}
+	sort.Slice(r.Nodes, func(i, j int) bool {
+		return r.Nodes[i].NodeID < r.Nodes[j].NodeID
+	})
+
+	var latencies []int64
+	for key, commitTime := range r.firstCommits {
+		if ackTime, ok := r.firstAcks[key]; ok {
+			latencies = append(latencies, commitTime-ackTime)
+		}
+	}
+	r.RequestLatency = newDistribution(latencies)
+
+	var batchSizes []int64
+	for _, size := range r.batches {
+		batchSizes = append(batchSizes, size)
+	}
+	r.BatchSizes = newDistribution(batchSizes)
+}
+
+// sortedCounts formats the counts as 'name=count' in order of name.
+func sortedCounts(counts map[string]uint64) string {
+	var names []string
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%d", name, counts[name]))
+	}
+
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, " ")
+}
+
+func (r *statsReport) writeText(output io.Writer) {
+	fmt.Fprintf(output, "Events: %d from time %d through %d\n", r.Events, r.StartTime, r.EndTime)
+	fmt.Fprintf(output, "Request latency: %s\n", r.RequestLatency)
+	fmt.Fprintf(output, "Batch sizes: %s\n", r.BatchSizes)
+	if r.RecorderDrops > 0 {
+		fmt.Fprintf(output, "Events dropped by the recorder: %d, replay stopped at index %d\n", r.RecorderDrops, r.ReplayStopped)
+	}
+
+	for _, ns := range r.Nodes {
+		fmt.Fprintf(output, "\nNode %d\n", ns.NodeID)
+		fmt.Fprintf(output, "  Events: %s\n", sortedCounts(ns.EventCounts))
+		fmt.Fprintf(output, "  Messages: %s\n", sortedCounts(ns.MsgCounts))
+		fmt.Fprintf(output, "  Request latency: %s\n", ns.RequestLatency)
+		fmt.Fprintf(output, "  Checkpoint intervals: %s\n", ns.CheckpointIntervals)
+		fmt.Fprintf(output, "  Checkpoint seq_no intervals: %s\n", ns.CheckpointSeqIntervals)
+		fmt.Fprintf(output, "  Buffer drops: %s\n", sortedCounts(ns.BufferDrops))
+		for _, epoch := range ns.Epochs {
+			if epoch.End == nil {
+				fmt.Fprintf(output, "  Epoch %d: started=%d duration=%d (active)\n", epoch.Number, epoch.Start, epoch.Duration)
+				continue
+			}
+			fmt.Fprintf(output, "  Epoch %d: started=%d duration=%d (%s)\n", epoch.Number, epoch.Start, epoch.Duration, epoch.Reason)
+		}
+	}
+}
+
+func (sa *statsArguments) execute(output io.Writer) error {
+	defer sa.input.Close()
+
+	reader, err := eventlog.NewReader(sa.input)
+	if err != nil {
+		return errors.WithMessage(err, "bad input file")
+	}
+
+	r := &statsReport{
+		nodes:        map[uint64]*nodeStats{},
+		firstAcks:    map[requestKey]int64{},
+		firstCommits: map[requestKey]int64{},
+		batches:      map[uint64]int64{},
+	}
+
+	s := newStateMachines(output, statemachine.LevelWarn)
+	s.newLogger = func(nodeID uint64) statemachine.Logger {
+		return statsLogger{node: r.node(nodeID)}
+	}
+
+	for {
+		event, err := reader.ReadEvent()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.WithMessage(err, "failed reading input")
+		}
+
+		if err := r.event(s, event); err != nil {
+			return err
+		}
+	}
+
+	r.finish()
+
+	if sa.format == formatText {
+		r.writeText(output)
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.WithMessage(err, "could not marshal stats")
+	}
+	fmt.Fprintf(output, "%s\n", data)
+	return nil
+}
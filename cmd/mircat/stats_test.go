@@ -0,0 +1,134 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+)
+
+var _ = Describe("Stats", func() {
+	var (
+		logBytes *bytes.Buffer
+		output   *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		logBytes = newBasicLog()
+		output = &bytes.Buffer{}
+	})
+
+	It("parses the arguments", func() {
+		cmd, err := parseArgs([]string{
+			"stats",
+			"--input", "main.go",
+			"--format", "json",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(BeAssignableToTypeOf(&statsArguments{}))
+		sa := cmd.(*statsArguments)
+		Expect(sa.format).To(Equal(formatJSON))
+		Expect(sa.input.Close()).To(Succeed())
+	})
+
+	It("reports statistics as text", func() {
+		sa := &statsArguments{
+			input:  ioutil.NopCloser(logBytes),
+			format: formatText,
+		}
+		Expect(sa.execute(output)).To(Succeed())
+		Expect(output.String()).To(MatchRegexp(`^Events: \d+ from time 0 through \d+\n`))
+		Expect(output.String()).To(ContainSubstring("Batch sizes: count=80 min=1 mean=1.0 "))
+		Expect(output.String()).To(MatchRegexp(`\nNode 3\n  Events: ActionsReceived=\d+ `))
+		Expect(output.String()).To(MatchRegexp(`  Epoch 1: started=\d+ duration=\d+ \(active\)\n`))
+	})
+
+	It("reports statistics as json", func() {
+		sa := &statsArguments{
+			input:  ioutil.NopCloser(logBytes),
+			format: formatJSON,
+		}
+		Expect(sa.execute(output)).To(Succeed())
+
+		report := &statsReport{}
+		Expect(json.Unmarshal(output.Bytes(), report)).To(Succeed())
+		Expect(report.Nodes).To(HaveLen(4))
+		Expect(report.RequestLatency.Count).To(Equal(uint64(80)))
+		Expect(report.BatchSizes.Count).To(Equal(uint64(80)))
+		for _, ns := range report.Nodes {
+			Expect(ns.EventCounts["Initialize"]).To(Equal(uint64(1)))
+			Expect(ns.MsgCounts["Commit"]).To(BeNumerically(">", 0))
+			Expect(ns.RequestLatency.Count).To(Equal(uint64(80)))
+			Expect(ns.CheckpointSeqIntervals.Min).To(Equal(int64(20)))
+			Expect(ns.Epochs).NotTo(BeEmpty())
+		}
+	})
+
+	It("computes distributions", func() {
+		d := newDistribution([]int64{5, 1, 3, 2, 4})
+		Expect(d).To(Equal(distribution{
+			Count: 5,
+			Min:   1,
+			Mean:  3,
+			P50:   3,
+			P90:   4,
+			P99:   4,
+			Max:   5,
+		}))
+		Expect(newDistribution(nil).String()).To(Equal("none"))
+	})
+
+	It("determines why epochs ended", func() {
+		ns := (&statsReport{nodes: map[uint64]*nodeStats{}}).node(0)
+		nEntry := func(number uint64) *pb.Persistent {
+			return &pb.Persistent{
+				Type: &pb.Persistent_NEntry{
+					NEntry: &pb.NEntry{
+						EpochConfig: &pb.EpochConfig{Number: number},
+					},
+				},
+			}
+		}
+		ecEntry := func(number uint64) *pb.Persistent {
+			return &pb.Persistent{
+				Type: &pb.Persistent_ECEntry{
+					ECEntry: &pb.ECEntry{EpochNumber: number},
+				},
+			}
+		}
+
+		ns.persisted(10, nEntry(1))
+		ns.persisted(20, &pb.Persistent{
+			Type: &pb.Persistent_Suspect{
+				Suspect: &pb.Suspect{Epoch: 1},
+			},
+		})
+		ns.persisted(25, ecEntry(2))
+		ns.persisted(30, nEntry(2))
+		ns.persisted(40, ecEntry(3))
+		ns.persisted(50, nEntry(3))
+		ns.persisted(60, &pb.Persistent{
+			Type: &pb.Persistent_FEntry{
+				FEntry: &pb.FEntry{
+					EndsEpochConfig: &pb.EpochConfig{Number: 3},
+				},
+			},
+		})
+
+		Expect(ns.Epochs).To(HaveLen(3))
+		Expect(ns.Epochs[0].Reason).To(Equal("suspected leader, epoch change to 2"))
+		Expect(*ns.Epochs[0].End).To(Equal(int64(25)))
+		Expect(ns.Epochs[1].Reason).To(Equal("joined epoch change to 3"))
+		Expect(ns.Epochs[2].Reason).To(Equal("ended gracefully"))
+	})
+})
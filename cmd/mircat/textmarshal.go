@@ -32,6 +32,13 @@ func textFormat(msg proto.Message, shortBytes bool) (string, error) {
 	return te.result.String(), nil
 }
 
+// recordingFields are the fields of a RecordedEvent which describe the
+// recording rather than the event, and so are only shown when set.
+var recordingFields = map[pref.FullName]struct{}{
+	"recorderpb.RecordedEvent.dropped": {},
+	"recorderpb.RecordedEvent.result":  {},
+}
+
 type textEncoder struct {
 	shortBytes bool
 	result     *bytes.Buffer
@@ -56,10 +63,18 @@ func (te *textEncoder) marshalMessage(m pref.Message) error {
 		if od := fd.ContainingOneof(); od != nil {
 			fd = m.WhichOneof(od)
 			i += od.Fields().Len()
+			if fd == nil {
+				// The oneof is unset, as for the data of a truncating write.
+				continue
+			}
 		} else {
 			i++
 		}
 
+		if _, ok := recordingFields[fd.FullName()]; ok && !m.Has(fd) {
+			continue
+		}
+
 		name := fd.Name()
 		// Use type name for group field name.
 		if fd.Kind() == pref.GroupKind {
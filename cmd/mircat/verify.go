@@ -0,0 +1,118 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	"github.com/IBM/mirbft/pkg/eventlog"
+	"github.com/IBM/mirbft/pkg/statemachine"
+)
+
+// verifyArguments are the arguments for the 'verify' subcommand, which
+// replays a log recorded with results against the current state machine
+// and reports the first event whose actions differ from those recorded.
+type verifyArguments struct {
+	input    io.ReadCloser
+	logLevel statemachine.LogLevel
+	verbose  bool
+}
+
+// resultLines renders the result as indented JSON, split into lines for
+// diffing.
+func resultLines(result *pb.StateEventResult) ([]string, error) {
+	data, err := protoJSON(result)
+	if err != nil {
+		return nil, err
+	}
+
+	indented := &bytes.Buffer{}
+	if err := json.Indent(indented, data, "", "  "); err != nil {
+		return nil, err
+	}
+
+	return strings.Split(indented.String(), "\n"), nil
+}
+
+func (va *verifyArguments) execute(output io.Writer) error {
+	defer va.input.Close()
+
+	reader, err := eventlog.NewReader(va.input)
+	if err != nil {
+		return errors.WithMessage(err, "bad input file")
+	}
+
+	s := newStateMachines(output, va.logLevel)
+
+	var index, verified uint64
+	for {
+		event, err := reader.ReadEvent()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.WithMessage(err, "failed reading input")
+		}
+
+		index++
+
+		if dropped, ok := eventlog.GapMarker(event); ok {
+			return errors.Errorf("cannot replay log, %d events were dropped at index %d", dropped, index)
+		}
+
+		if _, err := s.apply(event); err != nil {
+			return err
+		}
+
+		recorded := event.Result
+		if recorded == nil {
+			continue
+		}
+
+		produced := s.nodes[event.NodeId].lastResult
+		if proto.Equal(recorded, produced) {
+			verified++
+			continue
+		}
+
+		text, err := textFormat(event, !va.verbose)
+		if err != nil {
+			return errors.WithMessage(err, "could not marshal event")
+		}
+		fmt.Fprintf(output, "Actions diverge at event %d:\n% 6d %s\n", index, index, text)
+
+		recordedLines, err := resultLines(recorded)
+		if err != nil {
+			return errors.WithMessage(err, "could not marshal recorded result")
+		}
+		producedLines, err := resultLines(produced)
+		if err != nil {
+			return errors.WithMessage(err, "could not marshal produced result")
+		}
+		fmt.Fprintf(output, "Recorded (-) versus produced (+) actions:\n")
+		for _, line := range lineDiff(recordedLines, producedLines) {
+			fmt.Fprintf(output, "%s\n", line)
+		}
+
+		return errors.Errorf("actions diverge from the recording at event %d after %d events verified", index, verified)
+	}
+
+	if verified == 0 {
+		return errors.Errorf("log of %d events contains no recorded results, it must be recorded with eventlog.RecordResultsOpt", index)
+	}
+
+	fmt.Fprintf(output, "Verified the actions of %d of %d events\n", verified, index)
+	return nil
+}
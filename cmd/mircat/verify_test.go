@@ -0,0 +1,107 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	"github.com/IBM/mirbft/pkg/eventlog"
+	"github.com/IBM/mirbft/pkg/statemachine"
+)
+
+var _ = Describe("Verify", func() {
+	var (
+		logBytes *bytes.Buffer
+		output   *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		logBytes = newBasicLog()
+		output = &bytes.Buffer{}
+	})
+
+	// withResults rewrites the log with the result of each event attached,
+	// as the recorder would, passing each result through mangle.
+	withResults := func(mangle func(index uint64, result *pb.StateEventResult)) *bytes.Buffer {
+		reader, err := eventlog.NewReader(logBytes)
+		Expect(err).NotTo(HaveOccurred())
+
+		result := &bytes.Buffer{}
+		gzWriter := gzip.NewWriter(result)
+		defer gzWriter.Close()
+
+		s := newStateMachines(ioutil.Discard, statemachine.LevelError)
+		index := uint64(0)
+		for {
+			event, err := reader.ReadEvent()
+			if err == io.EOF {
+				return result
+			}
+			Expect(err).NotTo(HaveOccurred())
+			index++
+
+			_, err = s.apply(event)
+			Expect(err).NotTo(HaveOccurred())
+			actions := s.nodes[event.NodeId].lastResult
+			mangle(index, actions)
+			event.Result = actions
+			Expect(eventlog.WriteRecordedEvent(gzWriter, event)).To(Succeed())
+		}
+	}
+
+	It("parses the arguments", func() {
+		cmd, err := parseArgs([]string{
+			"verify",
+			"--input", "main.go",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(BeAssignableToTypeOf(&verifyArguments{}))
+		va := cmd.(*verifyArguments)
+		Expect(va.logLevel).To(Equal(statemachine.LevelError))
+		Expect(va.input.Close()).To(Succeed())
+	})
+
+	It("verifies a log whose actions are reproduced", func() {
+		va := &verifyArguments{
+			input:    ioutil.NopCloser(withResults(func(uint64, *pb.StateEventResult) {})),
+			logLevel: statemachine.LevelError,
+		}
+		Expect(va.execute(output)).To(Succeed())
+		Expect(output.String()).To(MatchRegexp(`^Verified the actions of (\d+) of (\d+) events\n$`))
+	})
+
+	It("reports the first event whose actions diverge", func() {
+		va := &verifyArguments{
+			input: ioutil.NopCloser(withResults(func(index uint64, result *pb.StateEventResult) {
+				if index >= 100 && len(result.Send) > 0 {
+					result.Send[0].Targets = append(result.Send[0].Targets, 7)
+				}
+			})),
+			logLevel: statemachine.LevelError,
+		}
+		err := va.execute(output)
+		Expect(err).To(MatchError(MatchRegexp(`^actions diverge from the recording at event \d+ after \d+ events verified$`)))
+		Expect(output.String()).To(MatchRegexp(`^Actions diverge at event \d+:\n *\d+ \[node_id=`))
+		Expect(output.String()).To(ContainSubstring("Recorded (-) versus produced (+) actions:\n"))
+		Expect(output.String()).To(MatchRegexp(`\n- *"7"\n`))
+	})
+
+	It("rejects a log recorded without results", func() {
+		va := &verifyArguments{
+			input:    ioutil.NopCloser(logBytes),
+			logLevel: statemachine.LevelError,
+		}
+		Expect(va.execute(output)).To(MatchError(MatchRegexp(`^log of \d+ events contains no recorded results`)))
+	})
+})
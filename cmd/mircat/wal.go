@@ -0,0 +1,492 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	"github.com/pkg/errors"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	"github.com/IBM/mirbft/pkg/simplewal"
+	"github.com/IBM/mirbft/pkg/statemachine"
+)
+
+type walOperation int
+
+const (
+	walPrint walOperation = iota
+	walSummary
+	walCheck
+	walTruncate
+)
+
+// walArguments are the arguments for the 'wal' subcommands, which
+// operate on a simplewal directory rather than on an event log.
+type walArguments struct {
+	operation   walOperation
+	dir         string
+	nodeID      uint64
+	verboseText bool
+
+	// For walTruncate, exactly one of before and after is set.
+	before *uint64
+	after  *uint64
+	dryRun bool
+}
+
+type walEntry struct {
+	index uint64
+	entry *pb.Persistent
+}
+
+func loadWAL(wal *simplewal.WAL) ([]walEntry, error) {
+	var entries []walEntry
+	err := wal.LoadAll(func(index uint64, p *pb.Persistent) {
+		entries = append(entries, walEntry{
+			index: index,
+			entry: p,
+		})
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "could not load WAL")
+	}
+
+	return entries, nil
+}
+
+func (wa *walArguments) execute(output io.Writer) error {
+	if wa.operation == walTruncate {
+		return wa.truncate(output)
+	}
+
+	entries, err := readWAL(wa.dir)
+	if err != nil {
+		return err
+	}
+
+	switch wa.operation {
+	case walPrint:
+		for _, e := range entries {
+			text, err := textFormat(e.entry, !wa.verboseText)
+			if err != nil {
+				return errors.WithMessagef(err, "could not marshal entry at index %d", e.index)
+			}
+
+			fmt.Fprintf(output, "% 6d %s\n", e.index, text)
+		}
+		return nil
+	case walSummary:
+		walSummarize(entries, output)
+		return nil
+	default:
+		return wa.check(entries, output)
+	}
+}
+
+func readWAL(dir string) ([]walEntry, error) {
+	wal, err := simplewal.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer wal.Close()
+
+	return loadWAL(wal)
+}
+
+// truncate validates the entries which would remain after the truncation, and
+// only if they are valid, truncates a copy of the WAL which then replaces the
+// original.  The original WAL is retained alongside as a backup.
+func (wa *walArguments) truncate(output io.Writer) error {
+	entries, err := readWAL(wa.dir)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		return errors.Errorf("WAL is empty, nothing to truncate")
+	}
+
+	var index uint64
+	var remaining []walEntry
+	if wa.before != nil {
+		index = *wa.before
+		fmt.Fprintf(output, "Removing all entries before index %d\n", index)
+		for _, e := range entries {
+			if e.index >= index {
+				remaining = append(remaining, e)
+			}
+		}
+	} else {
+		index = *wa.after
+		fmt.Fprintf(output, "Removing all entries after index %d\n", index)
+		for _, e := range entries {
+			if e.index <= index {
+				remaining = append(remaining, e)
+			}
+		}
+	}
+
+	firstIndex, lastIndex := entries[0].index, entries[len(entries)-1].index
+	if index < firstIndex || index > lastIndex {
+		return errors.Errorf("index %d is outside of the WAL, which contains indexes %d through %d", index, firstIndex, lastIndex)
+	}
+
+	if err := wa.check(remaining, output); err != nil {
+		return errors.WithMessage(err, "refusing to truncate WAL")
+	}
+
+	if wa.dryRun {
+		fmt.Fprintf(output, "Dry run, would remove %d of %d entries, WAL not modified\n", len(entries)-len(remaining), len(entries))
+		return nil
+	}
+
+	backupDir, err := wa.replaceTruncated()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(output, "Removed %d of %d entries, original WAL retained at %s\n", len(entries)-len(remaining), len(entries), backupDir)
+	return nil
+}
+
+// replaceTruncated truncates a copy of the WAL, then swaps it into place of the
+// original, which is moved aside, and whose new location is returned.
+func (wa *walArguments) replaceTruncated() (string, error) {
+	dir := filepath.Clean(wa.dir)
+	tmpDir, err := ioutil.TempDir(filepath.Dir(dir), filepath.Base(dir)+".truncate-")
+	if err != nil {
+		return "", errors.WithMessage(err, "could not create directory for truncated WAL")
+	}
+
+	if err := wa.truncateCopy(dir, tmpDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", err
+	}
+
+	backupDir := fmt.Sprintf("%s.%s.bak", dir, time.Now().Format("20060102T150405.000000000"))
+	if err := os.Rename(dir, backupDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", errors.WithMessage(err, "could not move original WAL aside")
+	}
+
+	if err := os.Rename(tmpDir, dir); err != nil {
+		if restoreErr := os.Rename(backupDir, dir); restoreErr != nil {
+			return "", errors.WithMessagef(err, "could not move truncated WAL into place, and could not restore original WAL from %s: %s", backupDir, restoreErr)
+		}
+		os.RemoveAll(tmpDir)
+		return "", errors.WithMessage(err, "could not move truncated WAL into place")
+	}
+
+	return backupDir, nil
+}
+
+// truncateCopy copies the WAL segment files from srcDir to dstDir, and then
+// applies the truncation to the copy.
+func (wa *walArguments) truncateCopy(srcDir, dstDir string) error {
+	files, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		return errors.WithMessage(err, "could not list WAL directory")
+	}
+
+	for _, file := range files {
+		if !file.Mode().IsRegular() {
+			return errors.Errorf("unexpected non-regular file '%s' in WAL directory", file.Name())
+		}
+
+		if err := copyFile(filepath.Join(srcDir, file.Name()), filepath.Join(dstDir, file.Name()), file.Mode()); err != nil {
+			return err
+		}
+	}
+
+	wal, err := simplewal.Open(dstDir)
+	if err != nil {
+		return err
+	}
+	defer wal.Close()
+
+	if wa.before != nil {
+		err = wal.Truncate(*wa.before)
+	} else {
+		err = wal.TruncateBack(*wa.after)
+	}
+	if err != nil {
+		return errors.WithMessage(err, "could not truncate WAL")
+	}
+
+	if err := wal.Sync(); err != nil {
+		return errors.WithMessage(err, "could not sync WAL")
+	}
+
+	return errors.WithMessage(wal.Close(), "could not close WAL")
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.WithMessagef(err, "could not open '%s'", src)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return errors.WithMessagef(err, "could not create '%s'", dst)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return errors.WithMessagef(err, "could not copy '%s'", src)
+	}
+
+	if err := out.Sync(); err != nil {
+		return errors.WithMessagef(err, "could not sync '%s'", dst)
+	}
+
+	return out.Close()
+}
+
+// walSummarize prints one line for every entry which affects the epoch or
+// checkpoint structure of the log, while the runs of QEntries and PEntries
+// between them are collapsed into a single line.
+func walSummarize(entries []walEntry, output io.Writer) {
+	if len(entries) == 0 {
+		fmt.Fprintf(output, "WAL is empty\n")
+		return
+	}
+
+	fmt.Fprintf(output, "WAL contains %d entries from index %d through %d\n", len(entries), entries[0].index, entries[len(entries)-1].index)
+
+	var runStart, runEnd, lowSeqNo, highSeqNo uint64
+	var qEntries, pEntries int
+	flushRun := func() {
+		if qEntries+pEntries == 0 {
+			return
+		}
+		fmt.Fprintf(output, "% 6d-%d QEntries=%d PEntries=%d seq_nos=%d-%d\n", runStart, runEnd, qEntries, pEntries, lowSeqNo, highSeqNo)
+		qEntries, pEntries = 0, 0
+	}
+
+	addToRun := func(index, seqNo uint64) {
+		if qEntries+pEntries == 0 {
+			runStart, lowSeqNo, highSeqNo = index, seqNo, seqNo
+		}
+		runEnd = index
+		if seqNo < lowSeqNo {
+			lowSeqNo = seqNo
+		}
+		if seqNo > highSeqNo {
+			highSeqNo = seqNo
+		}
+	}
+
+	for _, e := range entries {
+		switch d := e.entry.Type.(type) {
+		case *pb.Persistent_QEntry:
+			addToRun(e.index, d.QEntry.SeqNo)
+			qEntries++
+			continue
+		case *pb.Persistent_PEntry:
+			addToRun(e.index, d.PEntry.SeqNo)
+			pEntries++
+			continue
+		}
+
+		flushRun()
+
+		switch d := e.entry.Type.(type) {
+		case *pb.Persistent_CEntry:
+			fmt.Fprintf(output, "% 6d CEntry seq_no=%d nodes=%d clients=%d pending_reconfigurations=%d\n", e.index, d.CEntry.SeqNo, len(d.CEntry.NetworkState.Config.Nodes), len(d.CEntry.NetworkState.Clients), len(d.CEntry.NetworkState.PendingReconfigurations))
+		case *pb.Persistent_NEntry:
+			fmt.Fprintf(output, "% 6d NEntry epoch=%d seq_no=%d leaders=%v\n", e.index, d.NEntry.EpochConfig.Number, d.NEntry.SeqNo, d.NEntry.EpochConfig.Leaders)
+		case *pb.Persistent_FEntry:
+			fmt.Fprintf(output, "% 6d FEntry ends_epoch=%d\n", e.index, d.FEntry.EndsEpochConfig.Number)
+		case *pb.Persistent_ECEntry:
+			fmt.Fprintf(output, "% 6d ECEntry epoch=%d\n", e.index, d.ECEntry.EpochNumber)
+		case *pb.Persistent_TEntry:
+			fmt.Fprintf(output, "% 6d TEntry seq_no=%d\n", e.index, d.TEntry.SeqNo)
+		case *pb.Persistent_Suspect:
+			fmt.Fprintf(output, "% 6d Suspect epoch=%d\n", e.index, d.Suspect.Epoch)
+		default:
+			fmt.Fprintf(output, "% 6d unknown entry type %T\n", e.index, e.entry.Type)
+		}
+	}
+
+	flushRun()
+}
+
+// walViolations checks the log for the structural properties the state
+// machine relies upon when it is reinitialized from the log, returning a
+// description of each violation.
+func walViolations(entries []walEntry) []string {
+	var violations []string
+	violationf := func(format string, args ...interface{}) {
+		violations = append(violations, fmt.Sprintf(format, args...))
+	}
+
+	if len(entries) == 0 {
+		return []string{"WAL is empty"}
+	}
+
+	var lastCEntry *pb.CEntry
+	for i, e := range entries {
+		if i > 0 && e.index != entries[i-1].index+1 {
+			violationf("index %d: WAL indexes out of order, expected %d", e.index, entries[i-1].index+1)
+		}
+
+		switch d := e.entry.Type.(type) {
+		case *pb.Persistent_CEntry:
+			if d.CEntry.NetworkState == nil || d.CEntry.NetworkState.Config == nil {
+				violationf("index %d: CEntry for seq_no %d has no network state", e.index, d.CEntry.SeqNo)
+			}
+			if lastCEntry != nil && d.CEntry.SeqNo <= lastCEntry.SeqNo {
+				violationf("index %d: CEntry seq_no %d does not exceed previous CEntry seq_no %d", e.index, d.CEntry.SeqNo, lastCEntry.SeqNo)
+			}
+			lastCEntry = d.CEntry
+		case *pb.Persistent_FEntry:
+			if lastCEntry == nil {
+				violationf("index %d: FEntry without a preceding CEntry", e.index)
+			}
+		case *pb.Persistent_NEntry, *pb.Persistent_QEntry, *pb.Persistent_PEntry, *pb.Persistent_ECEntry, *pb.Persistent_TEntry, *pb.Persistent_Suspect:
+		default:
+			violationf("index %d: unsupported log entry type '%T'", e.index, e.entry.Type)
+		}
+	}
+
+	switch {
+	case lastCEntry == nil:
+		violationf("no CEntry in log, cannot determine the network state")
+	case entries[0].entry.GetCEntry() == nil && entries[0].entry.GetNEntry() == nil:
+		violationf("index %d: log must begin with a CEntry or NEntry, but begins with %T", entries[0].index, entries[0].entry.Type)
+	}
+
+	var lastNEntry *pb.NEntry
+	var lastFEntry *pb.FEntry
+	for _, e := range recoveredEntries(entries) {
+		switch d := e.entry.Type.(type) {
+		case *pb.Persistent_NEntry:
+			lastNEntry = d.NEntry
+		case *pb.Persistent_FEntry:
+			lastFEntry = d.FEntry
+		}
+	}
+
+	switch {
+	case lastNEntry == nil && lastFEntry == nil:
+		violationf("no NEntry or FEntry in log, cannot determine the active or last epoch")
+	case lastNEntry != nil && lastFEntry != nil && lastNEntry.EpochConfig.Number <= lastFEntry.EndsEpochConfig.Number:
+		violationf("last NEntry epoch %d must be greater than last FEntry epoch %d", lastNEntry.EpochConfig.Number, lastFEntry.EndsEpochConfig.Number)
+	}
+
+	return violations
+}
+
+// recoveredEntries returns the suffix of the entries which the state machine
+// retains when it loads the log.  Each FEntry causes the log to be truncated to
+// the most recent CEntry, exactly as the state machine would have truncated it
+// after the epoch ended (see StateMachine.recoverLog), so a WAL written before
+// that truncation was applied is evaluated as it will actually be loaded.
+func recoveredEntries(entries []walEntry) []walEntry {
+	head := 0
+	var lastCEntry *pb.CEntry
+	for i, e := range entries {
+		switch d := e.entry.Type.(type) {
+		case *pb.Persistent_CEntry:
+			lastCEntry = d.CEntry
+		case *pb.Persistent_FEntry:
+			if lastCEntry == nil {
+				continue
+			}
+
+			for j := head; j <= i; j++ {
+				if c := entries[j].entry.GetCEntry(); c != nil && c.SeqNo >= lastCEntry.SeqNo {
+					head = j
+					break
+				}
+				if n := entries[j].entry.GetNEntry(); n != nil && n.SeqNo > lastCEntry.SeqNo {
+					head = j
+					break
+				}
+			}
+		}
+	}
+
+	return entries[head:]
+}
+
+// walReplay loads the entries into a fresh state machine, exactly as a Node
+// would at startup, and returns an error if the state machine panics.
+func (wa *walArguments) walReplay(entries []walEntry, output io.Writer) (err error) {
+	sm := &statemachine.StateMachine{
+		Logger: namedLogger{
+			name:   fmt.Sprintf("node%d", wa.nodeID),
+			output: output,
+			level:  statemachine.LevelWarn,
+		},
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("state machine panic-ed while loading WAL:\n\n%s\n\n%s", r, debug.Stack())
+		}
+	}()
+
+	sm.ApplyEvent(&pb.StateEvent{
+		Type: &pb.StateEvent_Initialize{
+			Initialize: &pb.StateEvent_InitialParameters{
+				Id:                   wa.nodeID,
+				BatchSize:            1,
+				HeartbeatTicks:       2,
+				SuspectTicks:         4,
+				NewEpochTimeoutTicks: 8,
+				BufferSize:           5 * 1024 * 1024,
+			},
+		},
+	})
+
+	for _, e := range entries {
+		sm.ApplyEvent(&pb.StateEvent{
+			Type: &pb.StateEvent_LoadEntry{
+				LoadEntry: &pb.StateEvent_PersistedEntry{
+					Index: e.index,
+					Data:  e.entry,
+				},
+			},
+		})
+	}
+
+	sm.ApplyEvent(&pb.StateEvent{
+		Type: &pb.StateEvent_CompleteInitialization{
+			CompleteInitialization: &pb.StateEvent_LoadCompleted{},
+		},
+	})
+
+	return nil
+}
+
+func (wa *walArguments) check(entries []walEntry, output io.Writer) error {
+	violations := walViolations(entries)
+	for _, violation := range violations {
+		fmt.Fprintf(output, "violation: %s\n", violation)
+	}
+
+	if len(violations) > 0 {
+		return errors.Errorf("WAL failed validation with %d violations", len(violations))
+	}
+
+	if err := wa.walReplay(entries, output); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(output, "WAL with %d entries is valid\n", len(entries))
+	return nil
+}
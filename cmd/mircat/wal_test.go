@@ -0,0 +1,270 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	"github.com/IBM/mirbft/pkg/simplewal"
+	"github.com/IBM/mirbft/pkg/testengine"
+)
+
+// writeWAL writes the entries to a new simplewal at dir.  A new simplewal must
+// begin at index 1, so the entries are renumbered from 1, preserving their order.
+func writeWAL(dir string, entries []walEntry) {
+	wal, err := simplewal.Open(dir)
+	Expect(err).NotTo(HaveOccurred())
+	defer wal.Close()
+
+	for i, e := range entries {
+		Expect(wal.Write(uint64(i+1), e.entry)).To(Succeed())
+	}
+	Expect(wal.Sync()).To(Succeed())
+}
+
+var _ = Describe("WAL", func() {
+	var (
+		tmpDir      string
+		walDir      string
+		firstIndex  uint64
+		lastIndex   uint64
+		cEntryIndex uint64
+		output      *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "mircat-wal")
+		Expect(err).NotTo(HaveOccurred())
+		walDir = filepath.Join(tmpDir, "wal")
+
+		output = &bytes.Buffer{}
+
+		// The recorded WAL has been truncated at stable checkpoints.
+		var entries []walEntry
+		basicRecording.Nodes[0].WAL.LoadAll(func(index uint64, p *pb.Persistent) {
+			entries = append(entries, walEntry{index: index, entry: p})
+		})
+		writeWAL(walDir, entries)
+
+		firstIndex, lastIndex, cEntryIndex = 1, uint64(len(entries)), 0
+		for i, e := range entries {
+			if e.entry.GetCEntry() != nil {
+				cEntryIndex = uint64(i + 1)
+				break
+			}
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	parse := func(args ...string) *walArguments {
+		cmd, err := parseArgs(append([]string{"wal", "--dir", walDir}, args...))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(BeAssignableToTypeOf(&walArguments{}))
+		return cmd.(*walArguments)
+	}
+
+	printed := func() string {
+		output := &bytes.Buffer{}
+		Expect(parse("print").execute(output)).To(Succeed())
+		return output.String()
+	}
+
+	backups := func() []string {
+		matches, err := filepath.Glob(walDir + ".*")
+		Expect(err).NotTo(HaveOccurred())
+		return matches
+	}
+
+	It("prints each entry", func() {
+		Expect(parse("print").execute(output)).To(Succeed())
+		Expect(output.String()).To(HavePrefix("% 6d [", firstIndex))
+		Expect(output.String()).To(ContainSubstring("% 6d [c_entry=[seq_no=", cEntryIndex))
+	})
+
+	It("summarizes the epoch and checkpoint structure", func() {
+		Expect(parse("summary").execute(output)).To(Succeed())
+		Expect(output.String()).To(HavePrefix("WAL contains "))
+		Expect(output.String()).To(ContainSubstring("QEntries="))
+		Expect(output.String()).To(MatchRegexp(`(?m)^ +\d+ CEntry seq_no=\d+ nodes=4 clients=4 pending_reconfigurations=0$`))
+	})
+
+	It("validates the WAL", func() {
+		Expect(parse("check").execute(output)).To(Succeed())
+		Expect(output.String()).To(MatchRegexp(`WAL with \d+ entries is valid`))
+	})
+
+	When("the WAL is truncated to a valid prefix of the log", func() {
+		BeforeEach(func() {
+			// The WAL begins with the NEntry of the active epoch, which
+			// precedes the CEntry it was truncated to.
+			Expect(cEntryIndex).To(BeNumerically(">", firstIndex))
+		})
+
+		It("replaces the WAL and retains the original", func() {
+			original := printed()
+
+			err := parse("truncate", "--before", strconv.FormatUint(cEntryIndex, 10)).execute(output)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("is valid\n"))
+			Expect(output.String()).To(MatchRegexp(`Removed \d+ of \d+ entries, original WAL retained at `))
+
+			Expect(printed()).To(HavePrefix("% 6d [c_entry=[seq_no=", cEntryIndex))
+
+			Expect(backups()).To(HaveLen(1))
+			backup, err := parseArgs([]string{"wal", "--dir", backups()[0], "print"})
+			Expect(err).NotTo(HaveOccurred())
+			backupOutput := &bytes.Buffer{}
+			Expect(backup.execute(backupOutput)).To(Succeed())
+			Expect(backupOutput.String()).To(Equal(original))
+		})
+
+		It("does not modify the WAL in a dry run", func() {
+			original := printed()
+
+			err := parse("truncate", "--dryRun", "--before", strconv.FormatUint(cEntryIndex, 10)).execute(output)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.String()).To(ContainSubstring("Dry run, would remove 1 of "))
+
+			Expect(printed()).To(Equal(original))
+			Expect(backups()).To(BeEmpty())
+		})
+	})
+
+	When("the WAL would be truncated to only a checkpoint", func() {
+		BeforeEach(func() {
+			err := parse("truncate", "--before", strconv.FormatUint(cEntryIndex, 10)).execute(output)
+			Expect(err).NotTo(HaveOccurred())
+			output.Reset()
+		})
+
+		It("refuses to truncate, reporting that there is no epoch", func() {
+			original := printed()
+
+			err := parse("truncate", "--after", strconv.FormatUint(cEntryIndex, 10)).execute(output)
+			Expect(err).To(MatchError("refusing to truncate WAL: WAL failed validation with 1 violations"))
+			Expect(output.String()).To(ContainSubstring("violation: no NEntry or FEntry in log, cannot determine the active or last epoch\n"))
+
+			Expect(printed()).To(Equal(original))
+			Expect(backups()).To(HaveLen(1))
+		})
+	})
+
+	It("refuses to truncate outside of the WAL", func() {
+		err := parse("truncate", "--after", strconv.FormatUint(lastIndex+1, 10)).execute(output)
+		Expect(err).To(MatchError(HavePrefix("index " + strconv.FormatUint(lastIndex+1, 10) + " is outside of the WAL")))
+	})
+
+	It("requires exactly one truncation point", func() {
+		_, err := parseArgs([]string{"wal", "--dir", walDir, "truncate"})
+		Expect(err).To(MatchError("must set exactly one of --before and --after"))
+
+		_, err = parseArgs([]string{"wal", "--dir", walDir, "truncate", "--before", "3", "--after", "5"})
+		Expect(err).To(MatchError("must set exactly one of --before and --after"))
+	})
+})
+
+var _ = Describe("WAL with a gracefully ended epoch", func() {
+	var (
+		tmpDir      string
+		truncated   []walEntry
+		untruncated []walEntry
+		endedEpoch  uint64
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "mircat-wal-graceful")
+		Expect(err).NotTo(HaveOccurred())
+		truncated, untruncated = nil, nil
+
+		recorder := testengine.BasicRecorder(4, 4, 200)
+		recording, err := recorder.Recording(gzip.NewWriter(ioutil.Discard))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Step until node 0 gracefully ends its first epoch, which it does
+		// at the planned expiration.  Every entry ever appended is kept,
+		// to reconstruct the WAL as it would be had the truncations which
+		// accompany the end of the epoch not yet been applied.
+		appended := map[uint64]*pb.Persistent{}
+		for i := 0; truncated == nil; i++ {
+			Expect(i).To(BeNumerically("<", 200000), "node 0 did not end an epoch")
+			Expect(recording.Step()).To(Succeed())
+
+			var entries []walEntry
+			var fEntry *pb.FEntry
+			recording.Nodes[0].WAL.LoadAll(func(index uint64, p *pb.Persistent) {
+				appended[index] = p
+				entries = append(entries, walEntry{index: index, entry: p})
+				// The initial WAL ends epoch 0, so look for a later epoch.
+				if p.GetFEntry() != nil && p.GetFEntry().EndsEpochConfig.Number > 0 {
+					fEntry = p.GetFEntry()
+				}
+			})
+
+			if fEntry != nil {
+				truncated = entries
+				endedEpoch = fEntry.EndsEpochConfig.Number
+			}
+		}
+
+		for index := uint64(1); appended[index] != nil; index++ {
+			untruncated = append(untruncated, walEntry{index: index, entry: appended[index]})
+		}
+		Expect(len(untruncated)).To(BeNumerically(">", len(truncated)))
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	check := func(entries []walEntry) (string, error) {
+		walDir := filepath.Join(tmpDir, "wal")
+		writeWAL(walDir, entries)
+		cmd, err := parseArgs([]string{"wal", "--dir", walDir, "check"})
+		Expect(err).NotTo(HaveOccurred())
+		output := &bytes.Buffer{}
+		err = cmd.execute(output)
+		return output.String(), err
+	}
+
+	It("accepts the truncated WAL", func() {
+		output, err := check(truncated)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(MatchRegexp(`WAL with \d+ entries is valid`))
+	})
+
+	It("accepts the WAL before it is truncated", func() {
+		// The NEntry of the ended epoch is still in the log, and so
+		// is not newer than the FEntry, but as the state machine
+		// truncates the log at the FEntry when loading, it is ignored.
+		var nEntry *pb.NEntry
+		for _, e := range untruncated {
+			if e.entry.GetNEntry() != nil {
+				nEntry = e.entry.GetNEntry()
+			}
+		}
+		Expect(nEntry).NotTo(BeNil())
+		Expect(nEntry.EpochConfig.Number).To(Equal(endedEpoch))
+
+		output, err := check(untruncated)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(MatchRegexp(`WAL with \d+ entries is valid`))
+	})
+})
@@ -0,0 +1,60 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/IBM/mirbft/pkg/testengine"
+)
+
+// exploreArguments are the arguments for the 'explore' subcommand.
+type exploreArguments struct {
+	scenario      string
+	seed          int64
+	seeds         int
+	parallel      int
+	timeout       int
+	progressTicks int
+	output        string
+}
+
+func (ea *exploreArguments) explorer() *testengine.Explorer {
+	scenario := scenarios[ea.scenario].build
+	return &testengine.Explorer{
+		Name: ea.scenario,
+		Scenario: func(seed int64) *testengine.Recorder {
+			recorder := scenario(seed)
+			recorder.ProgressTicks = ea.progressTicks
+			return recorder
+		},
+		FirstSeed:   ea.seed,
+		Seeds:       ea.seeds,
+		Parallelism: ea.parallel,
+		Timeout:     ea.timeout,
+		OutputDir:   ea.output,
+		ReproCommand: func(seed int64) string {
+			return fmt.Sprintf("mirsim explore --scenario %s --seed %d --seeds 1 --timeout %d --progressTicks %d --output %s", ea.scenario, seed, ea.timeout, ea.progressTicks, ea.output)
+		},
+	}
+}
+
+func (ea *exploreArguments) execute(output io.Writer) error {
+	failures, err := ea.explorer().Explore(output)
+	if err != nil {
+		return err
+	}
+
+	if len(failures) > 0 {
+		return errors.Errorf("%d of %d seeds failed", len(failures), ea.seeds)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Explore", func() {
+	It("parses the explore arguments", func() {
+		cmd, err := parseArgs([]string{
+			"explore",
+			"--scenario", "partition",
+			"--seed", "100",
+			"--seeds", "10",
+			"--parallel", "3",
+			"--progressTicks", "40",
+			"--output", "failures",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(Equal(&exploreArguments{
+			scenario:      "partition",
+			seed:          100,
+			seeds:         10,
+			parallel:      3,
+			timeout:       100000,
+			progressTicks: 40,
+			output:        "failures",
+		}))
+
+		_, err = parseArgs([]string{"explore", "--scenario", "unknown"})
+		Expect(err).To(HaveOccurred())
+
+		_, err = parseArgs([]string{"explore", "--scenario", "basic", "--seeds", "0"})
+		Expect(err).To(MatchError("--seeds must be at least 1"))
+	})
+
+	It("builds a distinct recorder for each seed of each scenario", func() {
+		for _, name := range scenarioNames() {
+			build := scenarios[name].build
+			Expect(build(1)).NotTo(BeIdenticalTo(build(1)))
+			Expect(build(1).RecorderNodeConfigs).To(HaveLen(4))
+		}
+	})
+
+	When("exploring", func() {
+		var outputDir string
+
+		BeforeEach(func() {
+			var err error
+			outputDir, err = ioutil.TempDir("", "mirsim")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(outputDir)
+		})
+
+		It("succeeds when every seed passes", func() {
+			output := &bytes.Buffer{}
+			ea := &exploreArguments{
+				scenario: "basic",
+				seeds:    2,
+				parallel: 2,
+				timeout:  50000,
+				output:   outputDir,
+			}
+			Expect(ea.execute(output)).To(Succeed())
+			Expect(output.String()).To(Equal("Explored 2 seeds of scenario basic, 0 failed\n"))
+		})
+
+		It("reports the failing seeds with a command to reproduce them", func() {
+			output := &bytes.Buffer{}
+			ea := &exploreArguments{
+				scenario:      "basic",
+				seed:          5,
+				seeds:         1,
+				parallel:      1,
+				timeout:       50000,
+				progressTicks: 1,
+				output:        outputDir,
+			}
+			Expect(ea.execute(output)).To(MatchError("1 of 1 seeds failed"))
+			logPath := filepath.Join(outputDir, "basic-5.eventlog")
+			Expect(output.String()).To(ContainSubstring("  event log: " + logPath + "\n"))
+			Expect(output.String()).To(ContainSubstring("  reproduce: mirsim explore --scenario basic --seed 5 --seeds 1 --timeout 50000 --progressTicks 1 --output " + outputDir + "\n"))
+			Expect(logPath).To(BeARegularFile())
+		})
+	})
+})
@@ -0,0 +1,158 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// mirsim is a package for running simulated Mir networks via the testengine.
+// Via the 'explore' subcommand, it runs a scenario over many random seeds in
+// parallel, checking the safety and liveness invariants of each run, and writes
+// the event log of any failing seed to disk, along with a command to reproduce
+// it.  Via the 'minimize' subcommand, it searches for the smallest variant of a
+// failing seed which still fails the same way.  Via the 'run' subcommand, it
+// runs a scenario described by a YAML or JSON file, checking that its outcome is
+// as the file expects.  Via the 'perf' subcommand, it estimates the throughput
+// and request latency of a network in virtual time, comparing every combination
+// of the node counts, bucket counts, batch sizes, and client loads given.  The
+// event logs written may be inspected with mircat.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// command is implemented by the arguments of each mirsim subcommand.
+type command interface {
+	execute(output io.Writer) error
+}
+
+func parseArgs(args []string) (command, error) {
+	app := kingpin.New("mirsim", "Utility for running simulated Mir networks.")
+
+	explore := app.Command("explore", "Run a scenario over a range of random seeds, reporting the seeds which fail.")
+	exploreScenario := explore.Flag("scenario", "The built-in scenario to run, one of: "+scenarioHelp()+".").Required().Enum(scenarioNames()...)
+	exploreSeed := explore.Flag("seed", "The first seed to run.").Default("0").Int64()
+	exploreSeeds := explore.Flag("seeds", "The number of consecutive seeds to run.").Default("1000").Int()
+	exploreParallel := explore.Flag("parallel", "The number of seeds to run concurrently.").Default(fmt.Sprintf("%d", runtime.NumCPU())).Int()
+	exploreTimeout := explore.Flag("timeout", "The number of events after which a run which has not delivered all requests fails.").Default("100000").Int()
+	exploreProgressTicks := explore.Flag("progressTicks", "The number of ticks a node may observe without any request committing before the run fails (0 disables the check).").Default("0").Int()
+	exploreOutput := explore.Flag("output", "The directory to write the event logs of failing seeds to.").Default("mirsim-failures").String()
+
+	minimize := app.Command("minimize", "Reduce the faults and requests of a failing seed, writing the event log of the smallest variant which fails the same way.")
+	minimizeScenario := minimize.Flag("scenario", "The built-in scenario to run, one of: "+scenarioHelp()+".").Required().Enum(scenarioNames()...)
+	minimizeSeed := minimize.Flag("seed", "The failing seed.").Required().Int64()
+	minimizeTimeout := minimize.Flag("timeout", "The number of events after which a run which has not delivered all requests fails.").Default("100000").Int()
+	minimizeProgressTicks := minimize.Flag("progressTicks", "The number of ticks a node may observe without any request committing before the run fails (0 disables the check).").Default("0").Int()
+	minimizeMaxRuns := minimize.Flag("maxRuns", "The maximum number of runs to perform (0 is unlimited).").Default("0").Int()
+	minimizeOutput := minimize.Flag("output", "The file to write the event log of the smallest failing variant to.").Required().String()
+
+	run := app.Command("run", "Run a scenario described by a YAML or JSON file, checking its outcome against the expectations of the file.")
+	runFile := run.Flag("file", "The scenario file to run.").Required().ExistingFile()
+	runOutput := run.Flag("output", "The file to write the event log of the run to.").Required().String()
+
+	perf := app.Command("perf", "Estimate the throughput and request latency of a network in virtual time, for every combination of the given parameters.")
+	perfFile := perf.Flag("file", "A scenario file describing the network, the runtime parameters of its nodes, and its clients, any faults of which also apply (defaults to four nodes and four clients).").ExistingFile()
+	perfNodes := perf.Flag("nodes", "The number of nodes, may be repeated.").Ints()
+	perfBuckets := perf.Flag("buckets", "The number of buckets, with five sequences per bucket in each checkpoint interval, may be repeated.").Ints()
+	perfBatchSizes := perf.Flag("batchSize", "The number of requests per batch, may be repeated.").Ints()
+	perfClients := perf.Flag("clients", "The number of clients, may be repeated.").Ints()
+	perfRequests := perf.Flag("requests", "The number of requests each client sends.").Uint64()
+	perfRequestIntervals := perf.Flag("requestInterval", "The time between each client's requests, 0 to send as fast as the clients' windows allow, may be repeated.").Ints()
+	perfTimeout := perf.Flag("timeout", "The number of events after which a configuration which has not committed all requests fails (defaults to the timeout of the scenario).").Default("0").Int()
+
+	cmd, err := app.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cmd {
+	case explore.FullCommand():
+		switch {
+		case *exploreSeeds < 1:
+			return nil, errors.Errorf("--seeds must be at least 1")
+		case *exploreParallel < 1:
+			return nil, errors.Errorf("--parallel must be at least 1")
+		}
+		return &exploreArguments{
+			scenario:      *exploreScenario,
+			seed:          *exploreSeed,
+			seeds:         *exploreSeeds,
+			parallel:      *exploreParallel,
+			timeout:       *exploreTimeout,
+			progressTicks: *exploreProgressTicks,
+			output:        *exploreOutput,
+		}, nil
+	case minimize.FullCommand():
+		return &minimizeArguments{
+			scenario:      *minimizeScenario,
+			seed:          *minimizeSeed,
+			timeout:       *minimizeTimeout,
+			progressTicks: *minimizeProgressTicks,
+			maxRuns:       *minimizeMaxRuns,
+			output:        *minimizeOutput,
+		}, nil
+	case run.FullCommand():
+		return &runArguments{
+			file:   *runFile,
+			output: *runOutput,
+		}, nil
+	case perf.FullCommand():
+		for flag, values := range map[string][]int{
+			"nodes":     *perfNodes,
+			"buckets":   *perfBuckets,
+			"batchSize": *perfBatchSizes,
+			"clients":   *perfClients,
+		} {
+			for _, value := range values {
+				if value < 1 {
+					return nil, errors.Errorf("--%s must be at least 1", flag)
+				}
+			}
+		}
+		for _, requestInterval := range *perfRequestIntervals {
+			if requestInterval < 0 {
+				return nil, errors.Errorf("--requestInterval must not be negative")
+			}
+		}
+		return &perfArguments{
+			file:             *perfFile,
+			nodes:            *perfNodes,
+			buckets:          *perfBuckets,
+			batchSizes:       *perfBatchSizes,
+			clients:          *perfClients,
+			requests:         *perfRequests,
+			requestIntervals: *perfRequestIntervals,
+			timeout:          *perfTimeout,
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown command %s", cmd)
+	}
+}
+
+func scenarioHelp() string {
+	var descriptions []string
+	for _, name := range scenarioNames() {
+		descriptions = append(descriptions, fmt.Sprintf("'%s' (%s)", name, strings.TrimSuffix(scenarios[name].description, ".")))
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+func main() {
+	kingpin.Version("0.0.1")
+	args, err := parseArgs(os.Args[1:])
+	if err != nil {
+		kingpin.Fatalf("failed to parse arguments, %s, try --help", err)
+	}
+	err = args.execute(os.Stdout)
+	if err != nil {
+		fmt.Println("")
+		kingpin.Fatalf("%s", err)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/IBM/mirbft/pkg/testengine"
+)
+
+// minimizeArguments are the arguments for the 'minimize' subcommand.
+type minimizeArguments struct {
+	scenario      string
+	seed          int64
+	timeout       int
+	progressTicks int
+	maxRuns       int
+	output        string
+}
+
+func (ma *minimizeArguments) minimizer(progress io.Writer) *testengine.Minimizer {
+	scenario := scenarios[ma.scenario].build
+	return &testengine.Minimizer{
+		Recorder: func() *testengine.Recorder {
+			recorder := scenario(ma.seed)
+			recorder.RandomSeed = ma.seed
+			recorder.ProgressTicks = ma.progressTicks
+			return recorder
+		},
+		Timeout:  ma.timeout,
+		MaxRuns:  ma.maxRuns,
+		Progress: progress,
+	}
+}
+
+func (ma *minimizeArguments) execute(output io.Writer) (err error) {
+	file, err := os.Create(ma.output)
+	if err != nil {
+		return errors.WithMessage(err, "could not create output")
+	}
+	defer func() {
+		file.Close()
+		if err != nil {
+			os.Remove(ma.output)
+		}
+	}()
+
+	result, err := ma.minimizer(output).Minimize(file)
+	if err != nil {
+		return errors.WithMessagef(err, "could not minimize seed %d of scenario %s", ma.seed, ma.scenario)
+	}
+
+	fmt.Fprintf(output, "Minimized to %d events after %d runs, failing with: %s\n", result.Events, result.Runs, result.Err)
+
+	var faults []int
+	for i := range result.Reduction.Faults {
+		faults = append(faults, i)
+	}
+	sort.Ints(faults)
+	for _, i := range faults {
+		fault := result.Reduction.Faults[i]
+		fmt.Fprintf(output, "  fault %d applies from %d until %d\n", i, fault.Start, fault.End)
+	}
+
+	for i, total := range result.Reduction.Totals {
+		fmt.Fprintf(output, "  client %d sends %d requests\n", i, total)
+	}
+
+	fmt.Fprintf(output, "Wrote the event log to %s\n", ma.output)
+
+	return nil
+}
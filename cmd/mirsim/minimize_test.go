@@ -0,0 +1,89 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/IBM/mirbft/pkg/testengine"
+)
+
+var _ = Describe("Minimize", func() {
+	It("parses the minimize arguments", func() {
+		cmd, err := parseArgs([]string{
+			"minimize",
+			"--scenario", "crash",
+			"--seed", "7",
+			"--maxRuns", "20",
+			"--output", "min.eventlog",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(Equal(&minimizeArguments{
+			scenario: "crash",
+			seed:     7,
+			timeout:  100000,
+			maxRuns:  20,
+			output:   "min.eventlog",
+		}))
+
+		_, err = parseArgs([]string{"minimize", "--scenario", "crash", "--output", "min.eventlog"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	When("minimizing", func() {
+		var outputDir string
+
+		BeforeEach(func() {
+			var err error
+			outputDir, err = ioutil.TempDir("", "mirsim")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(outputDir)
+		})
+
+		It("writes the event log of the smallest failing variant", func() {
+			output := &bytes.Buffer{}
+			ma := &minimizeArguments{
+				scenario:      "basic",
+				seed:          3,
+				timeout:       50000,
+				progressTicks: 1,
+				output:        filepath.Join(outputDir, "min.eventlog"),
+			}
+			Expect(ma.execute(output)).To(Succeed())
+			Expect(output.String()).To(ContainSubstring("reduced client 0 to 10 requests"))
+			Expect(output.String()).To(ContainSubstring("  client 0 sends 0 requests\n"))
+			Expect(output.String()).To(HaveSuffix("Wrote the event log to " + ma.output + "\n"))
+
+			logFile, err := os.Open(ma.output)
+			Expect(err).NotTo(HaveOccurred())
+			defer logFile.Close()
+			eventLog, err := testengine.ReadEventLog(logFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(eventLog.List.Len()).NotTo(BeZero())
+		})
+
+		It("does not leave an event log behind when the seed passes", func() {
+			ma := &minimizeArguments{
+				scenario: "basic",
+				seed:     3,
+				timeout:  50000,
+				output:   filepath.Join(outputDir, "min.eventlog"),
+			}
+			Expect(ma.execute(&bytes.Buffer{})).To(MatchError("could not minimize seed 3 of scenario basic: scenario does not fail"))
+			Expect(ma.output).NotTo(BeAnExistingFile())
+		})
+	})
+})
@@ -0,0 +1,171 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+
+	"github.com/IBM/mirbft/pkg/testengine"
+)
+
+// defaultPerfScenario is measured when no scenario file is given.
+const defaultPerfScenario = `
+nodes: 4
+clients: {count: 4, requests: 100}
+`
+
+// perfArguments are the arguments for the 'perf' subcommand.  Each of the
+// repeatable parameters which is given overrides the scenario, and every
+// combination of them is measured.
+type perfArguments struct {
+	file             string
+	nodes            []int
+	buckets          []int
+	batchSizes       []int
+	clients          []int
+	requests         uint64
+	requestIntervals []int
+	timeout          int
+}
+
+// perfConfig is a single combination of the repeatable parameters.
+type perfConfig struct {
+	nodes           int
+	buckets         int
+	batchSize       int
+	clients         int
+	requestInterval int
+}
+
+// configs returns every combination of the repeatable parameters, with the
+// values of the scenario for any parameter which is not given.
+func (pa *perfArguments) configs(spec *testengine.ScenarioSpec) []perfConfig {
+	orDefault := func(values []int, value int) []int {
+		if len(values) == 0 {
+			return []int{value}
+		}
+		return values
+	}
+
+	var configs []perfConfig
+	for _, nodes := range orDefault(pa.nodes, spec.Nodes) {
+		// Zero buckets retains the network configuration of the scenario
+		for _, buckets := range orDefault(pa.buckets, 0) {
+			for _, batchSize := range orDefault(pa.batchSizes, int(spec.InitialParameters.BatchSize)) {
+				for _, clients := range orDefault(pa.clients, spec.Clients.Count) {
+					for _, requestInterval := range orDefault(pa.requestIntervals, spec.Clients.RequestInterval) {
+						configs = append(configs, perfConfig{
+							nodes:           nodes,
+							buckets:         buckets,
+							batchSize:       batchSize,
+							clients:         clients,
+							requestInterval: requestInterval,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	return configs
+}
+
+// apply returns a copy of the scenario with the configuration's parameters.
+// Setting the number of buckets also sets the checkpoint interval and the
+// maximum epoch length, in proportion, as for the standard network state.
+func (pc perfConfig) apply(base *testengine.ScenarioSpec, requests uint64) *testengine.ScenarioSpec {
+	spec := *base
+	spec.Nodes = pc.nodes
+	spec.InitialParameters.BatchSize = uint32(pc.batchSize)
+	spec.Clients.Count = pc.clients
+	spec.Clients.RequestInterval = pc.requestInterval
+	if requests != 0 {
+		spec.Clients.Requests = requests
+	}
+
+	if pc.buckets != 0 {
+		buckets := int32(pc.buckets)
+		checkpointInterval := buckets * 5
+		maxEpochLength := uint64(checkpointInterval) * 10
+		spec.Network.NumberOfBuckets = &buckets
+		spec.Network.CheckpointInterval = &checkpointInterval
+		spec.Network.MaxEpochLength = &maxEpochLength
+	}
+
+	return &spec
+}
+
+func (pa *perfArguments) execute(output io.Writer) error {
+	var spec *testengine.ScenarioSpec
+	var err error
+	if pa.file != "" {
+		spec, err = testengine.ReadScenarioSpec(pa.file)
+	} else {
+		spec, err = testengine.ParseScenarioSpec([]byte(defaultPerfScenario))
+	}
+	if err != nil {
+		return err
+	}
+
+	if pa.timeout != 0 {
+		spec.Timeout = pa.timeout
+	}
+
+	tw := tabwriter.NewWriter(output, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "nodes\tbuckets\tbatch\tclients\tinterval\trequests\treq/s\tp50\tp90\tp99\tmax\tKB/s sent\t\n")
+
+	var failures []string
+	for i, config := range pa.configs(spec) {
+		buckets := config.buckets
+		switch {
+		case buckets != 0:
+		case spec.Network.NumberOfBuckets != nil:
+			buckets = int(*spec.Network.NumberOfBuckets)
+		default:
+			// As for the standard network state
+			buckets = config.nodes
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t", config.nodes, buckets, config.batchSize, config.clients, config.requestInterval)
+
+		report, err := config.apply(spec, pa.requests).Measure()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("Configuration %d failed: %s", i+1, err))
+			fmt.Fprintf(tw, "failed (%d)\t\t\t\t\t\t\t\n", i+1)
+			continue
+		}
+
+		fmt.Fprintf(tw, "%d\t%.1f\t%d\t%d\t%d\t%d\t%.1f\t\n",
+			report.Requests,
+			report.Throughput,
+			report.LatencyP50,
+			report.LatencyP90,
+			report.LatencyP99,
+			report.LatencyMax,
+			report.MaxSendRate/1000,
+		)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return errors.WithMessage(err, "could not write report")
+	}
+
+	fmt.Fprintf(output, "Latencies are in milliseconds, from when a client sends a request until f+1 nodes commit it.\n")
+
+	if failures != nil {
+		fmt.Fprintf(output, "\n")
+		for _, failure := range failures {
+			fmt.Fprintf(output, "%s\n", failure)
+		}
+		return errors.Errorf("%d configurations failed", len(failures))
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Perf", func() {
+	It("parses the perf arguments", func() {
+		cmd, err := parseArgs([]string{
+			"perf",
+			"--file", "../../pkg/testengine/testdata/scenarios/basic.yaml",
+			"--nodes", "4",
+			"--nodes", "7",
+			"--batchSize", "20",
+			"--requests", "50",
+			"--requestInterval", "10",
+			"--timeout", "5000",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(Equal(&perfArguments{
+			file:             "../../pkg/testengine/testdata/scenarios/basic.yaml",
+			nodes:            []int{4, 7},
+			batchSizes:       []int{20},
+			requests:         50,
+			requestIntervals: []int{10},
+			timeout:          5000,
+		}))
+	})
+
+	It("measures every combination of the parameters", func() {
+		output := &bytes.Buffer{}
+		pa := &perfArguments{
+			batchSizes: []int{1, 20},
+			buckets:    []int{1, 4},
+			requests:   20,
+		}
+		Expect(pa.execute(output)).To(Succeed())
+
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		Expect(lines).To(HaveLen(6))
+		Expect(strings.Fields(lines[0])).To(Equal([]string{
+			"nodes", "buckets", "batch", "clients", "interval", "requests",
+			"req/s", "p50", "p90", "p99", "max", "KB/s", "sent",
+		}))
+		for i, config := range [][]string{
+			{"4", "1", "1", "4", "0", "80"},
+			{"4", "1", "20", "4", "0", "80"},
+			{"4", "4", "1", "4", "0", "80"},
+			{"4", "4", "20", "4", "0", "80"},
+		} {
+			Expect(strings.Fields(lines[i+1])).To(HaveLen(12))
+			Expect(strings.Fields(lines[i+1])[:6]).To(Equal(config))
+		}
+		Expect(lines[5]).To(HavePrefix("Latencies are in milliseconds"))
+	})
+
+	It("rejects empty networks", func() {
+		_, err := parseArgs([]string{"perf", "--nodes", "4", "--nodes", "0"})
+		Expect(err).To(MatchError("--nodes must be at least 1"))
+	})
+
+	It("reports the configurations which fail", func() {
+		outputDir, err := ioutil.TempDir("", "mirsim")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(outputDir)
+
+		file := filepath.Join(outputDir, "slow.yaml")
+		err = ioutil.WriteFile(file, []byte("nodes: 4\nclients: {count: 4, requests: 20}\ntimeout: 2500\n"), 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		output := &bytes.Buffer{}
+		pa := &perfArguments{
+			file:       file,
+			batchSizes: []int{20, 1},
+		}
+		Expect(pa.execute(output)).To(MatchError("1 configurations failed"))
+		Expect(output.String()).To(ContainSubstring("failed (2)"))
+		Expect(output.String()).To(ContainSubstring("Configuration 2 failed: timed out after 2500 events"))
+	})
+})
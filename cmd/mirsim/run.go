@@ -0,0 +1,55 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/IBM/mirbft/pkg/testengine"
+)
+
+// runArguments are the arguments for the 'run' subcommand.
+type runArguments struct {
+	file   string
+	output string
+}
+
+func (ra *runArguments) execute(output io.Writer) error {
+	spec, err := testengine.ReadScenarioSpec(ra.file)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(ra.output)
+	if err != nil {
+		return errors.WithMessage(err, "could not create output")
+	}
+	defer file.Close()
+
+	result, err := spec.Run(file)
+	if result == nil {
+		return errors.WithMessagef(err, "could not run scenario %s", ra.file)
+	}
+
+	recording := result.Recording
+	if result.Err != nil {
+		fmt.Fprintf(output, "Scenario %s failed after %d events at time %d: %s\n", spec.Name, recording.EventIndex, recording.EventLog.FakeTime, result.Err)
+	} else {
+		fmt.Fprintf(output, "Scenario %s delivered all requests after %d events at time %d\n", spec.Name, recording.EventIndex, recording.EventLog.FakeTime)
+	}
+	fmt.Fprintf(output, "Wrote the event log to %s\n", ra.output)
+
+	if err != nil {
+		return errors.WithMessagef(err, "scenario %s did not meet its expectations", spec.Name)
+	}
+
+	return nil
+}
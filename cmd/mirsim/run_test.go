@@ -0,0 +1,85 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/IBM/mirbft/pkg/testengine"
+)
+
+var _ = Describe("Run", func() {
+	var (
+		outputDir string
+		output    *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		var err error
+		outputDir, err = ioutil.TempDir("", "mirsim")
+		Expect(err).NotTo(HaveOccurred())
+
+		output = &bytes.Buffer{}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(outputDir)
+	})
+
+	It("parses the run arguments", func() {
+		cmd, err := parseArgs([]string{
+			"run",
+			"--file", "../../pkg/testengine/testdata/scenarios/basic.yaml",
+			"--output", "basic.eventlog",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(Equal(&runArguments{
+			file:   "../../pkg/testengine/testdata/scenarios/basic.yaml",
+			output: "basic.eventlog",
+		}))
+
+		_, err = parseArgs([]string{"run", "--file", filepath.Join(outputDir, "missing.yaml"), "--output", "basic.eventlog"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("runs the scenario and writes its event log", func() {
+		ra := &runArguments{
+			file:   "../../pkg/testengine/testdata/scenarios/stall.yaml",
+			output: filepath.Join(outputDir, "stall.eventlog"),
+		}
+		Expect(ra.execute(output)).To(Succeed())
+		Expect(output.String()).To(MatchRegexp("^Scenario stall failed after [0-9]+ events at time [0-9]+: invariant violated"))
+		Expect(output.String()).To(HaveSuffix("Wrote the event log to " + ra.output + "\n"))
+
+		logFile, err := os.Open(ra.output)
+		Expect(err).NotTo(HaveOccurred())
+		defer logFile.Close()
+		eventLog, err := testengine.ReadEventLog(logFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(eventLog.List.Len()).NotTo(BeZero())
+	})
+
+	It("fails when the outcome is not as expected", func() {
+		ra := &runArguments{
+			file:   filepath.Join(outputDir, "scenario.yaml"),
+			output: filepath.Join(outputDir, "scenario.eventlog"),
+		}
+		err := ioutil.WriteFile(ra.file, []byte("name: quick\nnodes: 1\nclients: {count: 1, requests: 5}\nexpect: {events: 1}\n"), 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = ra.execute(output)
+		Expect(err).To(MatchError(MatchRegexp("^scenario quick did not meet its expectations: expected 1 events, but the scenario executed [0-9]+$")))
+		Expect(output.String()).To(ContainSubstring("Scenario quick delivered all requests after"))
+		Expect(ra.output).To(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,176 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/IBM/mirbft/pkg/testengine"
+)
+
+// scenario is a built-in scenario, which derives the faults it injects, and
+// when, from the seed of each run.
+type scenario struct {
+	description string
+	build       func(seed int64) *testengine.Recorder
+}
+
+var scenarios = map[string]scenario{
+	"basic": {
+		description: "A four node network with no faults.",
+		build: func(seed int64) *testengine.Recorder {
+			return basicRecorder()
+		},
+	},
+	"lossy": {
+		description: "A four node network which drops, duplicates, and delays some messages.",
+		build: func(seed int64) *testengine.Recorder {
+			return withFaults(seed, lossyFault)
+		},
+	},
+	"partition": {
+		description: "A four node network which is partitioned in two for a time.",
+		build: func(seed int64) *testengine.Recorder {
+			return withFaults(seed, partitionFault)
+		},
+	},
+	"crash": {
+		description: "A four node network in which one node crashes and restarts.",
+		build: func(seed int64) *testengine.Recorder {
+			return withFaults(seed, crashFault)
+		},
+	},
+	"byzantine": {
+		description: "A four node network in which one node misbehaves.",
+		build: func(seed int64) *testengine.Recorder {
+			return withFaults(seed, byzantineFault)
+		},
+	},
+	"skewed": {
+		description: "A four node network whose nodes tick at different rates, drift, pause, and have slow disks.",
+		build: func(seed int64) *testengine.Recorder {
+			recorder := basicRecorder()
+			skew(rand.New(rand.NewSource(seed)), recorder)
+			return recorder
+		},
+	},
+	"mixed": {
+		description: "A four node network with a random mix of the above faults.",
+		build: func(seed int64) *testengine.Recorder {
+			return withFaults(seed, lossyFault, partitionFault, crashFault, byzantineFault)
+		},
+	},
+}
+
+func scenarioNames() []string {
+	var names []string
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func basicRecorder() *testengine.Recorder {
+	recorder := testengine.BasicRecorder(4, 4, 20)
+	return recorder
+}
+
+// skew randomly varies the tick rate, clock drift, pauses, and disk speed of
+// each node.
+func skew(r *rand.Rand, recorder *testengine.Recorder) {
+	for _, nodeConfig := range recorder.RecorderNodeConfigs {
+		runtimeParms := nodeConfig.RuntimeParms
+		runtimeParms.TickInterval = 250 + r.Intn(500)
+		runtimeParms.TickDrift = r.Intn(runtimeParms.TickInterval / 4)
+		if r.Intn(2) == 0 {
+			runtimeParms.TickStallPercent = 1 + r.Intn(10)
+			runtimeParms.TickStallDuration = r.Intn(2000)
+		}
+		if r.Intn(2) == 0 {
+			runtimeParms.PersistLatency = r.Intn(200)
+			runtimeParms.PersistBandwidth = 1 + r.Intn(100)
+		}
+	}
+}
+
+// fault returns a mangler to apply to the recording, chosen randomly.
+type fault func(r *rand.Rand, recorder *testengine.Recorder) testengine.Mangler
+
+// withFaults returns a basic recorder with the given faults applied.  If there
+// is more than one fault, each is applied only half of the time.
+func withFaults(seed int64, faults ...fault) *testengine.Recorder {
+	r := rand.New(rand.NewSource(seed))
+	recorder := basicRecorder()
+
+	var schedule testengine.FaultSchedule
+	for _, fault := range faults {
+		if len(faults) > 1 && r.Intn(2) == 0 {
+			continue
+		}
+		schedule = append(schedule, testengine.ScheduledFault{
+			Fault: fault(r, recorder),
+		})
+	}
+
+	if len(schedule) > 0 {
+		recorder.Mangler = schedule
+	}
+
+	return recorder
+}
+
+func lossyFault(r *rand.Rand, recorder *testengine.Recorder) testengine.Mangler {
+	switch r.Intn(3) {
+	case 0:
+		return testengine.For(testengine.MatchMsgs().AtPercent(1 + r.Intn(5))).Drop()
+	case 1:
+		return testengine.For(testengine.MatchMsgs().AtPercent(1 + r.Intn(75))).Duplicate(1 + r.Intn(500))
+	default:
+		return testengine.For(testengine.MatchMsgs()).Jitter(1 + r.Intn(1000))
+	}
+}
+
+func partitionFault(r *rand.Rand, recorder *testengine.Recorder) testengine.Mangler {
+	var groups [2][]uint64
+	for i := range recorder.RecorderNodeConfigs {
+		group := r.Intn(2)
+		groups[group] = append(groups[group], uint64(i))
+	}
+
+	start := int64(r.Intn(10000))
+	end := start + 1000 + int64(r.Intn(20000))
+	return testengine.Between(start, end).Partition(groups[0], groups[1])
+}
+
+func crashFault(r *rand.Rand, recorder *testengine.Recorder) testengine.Mangler {
+	node := uint64(r.Intn(len(recorder.RecorderNodeConfigs)))
+	seqNo := uint64(recorder.NetworkState.Config.CheckpointInterval) * uint64(1+r.Intn(3))
+	return testengine.For(
+		testengine.MatchMsgs().ToNode(node).FromSelf().OfTypeCheckpoint().WithSequence(seqNo),
+	).CrashAndRestartAfter(int64(r.Intn(1000)), recorder.RecorderNodeConfigs[node].InitParms)
+}
+
+func byzantineFault(r *rand.Rand, recorder *testengine.Recorder) testengine.Mangler {
+	node := uint64(r.Intn(len(recorder.RecorderNodeConfigs)))
+	mangling := testengine.For(testengine.MatchMsgs().FromNode(node))
+	switch r.Intn(6) {
+	case 0:
+		return mangling.Equivocate(uint64(r.Intn(len(recorder.RecorderNodeConfigs))))
+	case 1:
+		return mangling.CorruptDigests()
+	case 2:
+		return mangling.ForgeCheckpoints()
+	case 3:
+		return mangling.MalformEpochChanges()
+	case 4:
+		return mangling.ForgeNewEpochs()
+	default:
+		return mangling.SpamAcks(1 + r.Intn(10))
+	}
+}
@@ -44,7 +44,8 @@ type Config struct {
 	// EventInterceptor, if set, has its Intercept method invoked each time the
 	// state machine undergoes some mutation.  This allows for additional
 	// external insight into the state machine, but comes at a performance cost
-	// and would generally not be enabled outside of a test or debug setting.
+	// and would generally not be enabled outside of a test or debug setting,
+	// except via the non-blocking or flight recorder modes of pkg/eventlog.
 	EventInterceptor EventInterceptor
 }
 
@@ -59,3 +60,15 @@ type EventInterceptor interface {
 	// state machine halts.
 	Intercept(s *pb.StateEvent) error
 }
+
+// ResultInterceptor may optionally be implemented by an EventInterceptor
+// which additionally wishes to observe the actions the state machine
+// produces for each state event, for instance, to detect behavioral
+// changes between versions of the state machine.
+type ResultInterceptor interface {
+	// InterceptResult is invoked after each state event passed to
+	// Intercept has been applied to the state machine, with the
+	// result of applying it.  If InterceptResult returns an error,
+	// the state machine halts.
+	InterceptResult(s *pb.StateEvent, r *pb.StateEventResult) error
+}
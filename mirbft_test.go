@@ -12,6 +12,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime/debug"
@@ -309,6 +310,63 @@ var _ = Describe("StressyTest", func() {
 	)
 })
 
+// RequestStoreGC runs a network to completion and then inspects the request
+// stores, verifying that requests which committed before the final stable
+// checkpoints were removed, rather than retained forever.
+var _ = Describe("RequestStoreGC", func() {
+	It("removes requests which committed prior to a stable checkpoint", func() {
+		testConfig := &TestConfig{
+			NodeCount:          4,
+			CheckpointInterval: 20,
+			MsgCount:           200,
+		}
+
+		doneC := make(chan struct{})
+		network := CreateNetwork(testConfig, doneC)
+		defer os.RemoveAll(filepath.Dir(network.TestReplicas[0].TmpDir))
+
+		nodeStatusesC := make(chan []*NodeStatus, 1)
+		go func() {
+			nodeStatusesC <- network.Run()
+		}()
+
+		for _, replica := range network.TestReplicas {
+			committed := 0
+			for committed < testConfig.MsgCount {
+				entry := &pb.QEntry{}
+				Eventually(replica.Log.CommitC, 10*time.Second).Should(Receive(&entry))
+				committed += len(entry.Requests)
+			}
+		}
+
+		close(doneC)
+		<-nodeStatusesC
+
+		for i, replica := range network.TestReplicas {
+			By(fmt.Sprintf("inspecting the request store of node %d", i))
+			reqStore, err := reqstore.Open(filepath.Join(replica.TmpDir, "reqstore"))
+			Expect(err).NotTo(HaveOccurred())
+
+			var allocations []uint64
+			err = reqStore.Allocations(0, 0, math.MaxUint64, func(reqNo uint64, _ []byte) {
+				allocations = append(allocations, reqNo)
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			requests := 0
+			err = reqStore.Requests(0, 0, math.MaxUint64, func(*pb.RequestAck, []byte) {
+				requests++
+			})
+			Expect(err).NotTo(HaveOccurred())
+			reqStore.Close()
+
+			Expect(allocations).NotTo(ContainElement(uint64(0)))
+			Expect(len(allocations)).To(BeNumerically("<", testConfig.MsgCount))
+			Expect(requests).To(BeNumerically("<", testConfig.MsgCount))
+		}
+	})
+})
+
 type TestReplica struct {
 	Config              *mirbft.Config
 	InitialNetworkState *pb.NetworkState
@@ -390,11 +448,12 @@ func (tr *TestReplica) Run() (*status.StateMachine, error) {
 	}()
 
 	processor := &mirbft.Processor{
-		Node:   node,
-		Link:   tr.FakeTransport.Link(node.Config.ID),
-		Hasher: crypto.SHA256,
-		Log:    tr.Log,
-		WAL:    wal,
+		Node:         node,
+		Link:         tr.FakeTransport.Link(node.Config.ID),
+		Hasher:       crypto.SHA256,
+		Log:          tr.Log,
+		WAL:          wal,
+		RequestStore: reqStore,
 	}
 
 	clientProcessor := &mirbft.ClientProcessor{
@@ -406,13 +465,32 @@ func (tr *TestReplica) Run() (*status.StateMachine, error) {
 	expectedProposalCount := tr.FakeClient.MsgCount
 	Expect(expectedProposalCount).NotTo(Equal(0))
 
+	// sleep waits for the given duration, returning false if the
+	// replica is shutting down in the meantime.
+	sleep := func(d time.Duration) bool {
+		select {
+		case <-time.After(d):
+			return true
+		case <-node.Err():
+			return false
+		case <-tr.DoneC:
+			return false
+		}
+	}
+
+	// The proposer and client processing go routines both write to the
+	// request store, so they must exit before it is closed.
+	proposerDoneC := make(chan struct{})
 	go func() {
 		defer GinkgoRecover()
+		defer close(proposerDoneC)
 		client := clientProcessor.Client(0)
 		for {
 			nextReqNo, err := client.NextReqNo()
 			if err == mirbft.ErrClientNotExist {
-				time.Sleep(20 * time.Millisecond)
+				if !sleep(20 * time.Millisecond) {
+					return
+				}
 				continue
 			}
 
@@ -423,12 +501,19 @@ func (tr *TestReplica) Run() (*status.StateMachine, error) {
 				Expect(err).NotTo(HaveOccurred())
 			}
 
-			time.Sleep(10 * time.Millisecond)
+			if !sleep(10 * time.Millisecond) {
+				return
+			}
 		}
 	}()
+	defer func() {
+		<-proposerDoneC
+	}()
 
 	// TODO, don't pre-allocate all of the requests, do it in the go routine
+	clientProcessorDoneC := make(chan struct{})
 	go func() {
+		defer close(clientProcessorDoneC)
 		for {
 			var err error
 			select {
@@ -461,6 +546,9 @@ func (tr *TestReplica) Run() (*status.StateMachine, error) {
 			}
 		}
 	}()
+	defer func() {
+		<-clientProcessorDoneC
+	}()
 
 	var process func(*mirbft.Actions) *mirbft.ActionResults
 
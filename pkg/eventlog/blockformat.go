@@ -0,0 +1,439 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package eventlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+)
+
+// The indexed format is a sequence of gzip members, each containing a block of
+// size prefixed events, followed by empty gzip members whose header extra fields
+// carry the block index, followed by a final empty member whose extra field
+// locates the index.  Because gzip readers concatenate members, and empty members
+// contribute no data, the indexed format is readable as an ordinary event log.
+//
+// The extra field subfield IDs identify the index chunks and the locator.
+var (
+	indexSubfieldID   = [2]byte{'M', 'I'}
+	locatorSubfieldID = [2]byte{'M', 'L'}
+)
+
+const (
+	indexFormatVersion = 1
+
+	// maxSubfieldData is the most data a single extra subfield may carry, as the
+	// entire extra field is limited to 65535 bytes, including the subfield header.
+	maxSubfieldData = 65535 - 4
+
+	// locatorSearchSize is the number of trailing bytes searched for the locator.
+	locatorSearchSize = 256
+)
+
+// DefaultBlockSize is the approximate number of uncompressed bytes in each
+// block of an indexed event log when not overridden.
+const DefaultBlockSize = 256 * 1024
+
+type indexedFormatOpt int
+
+// IndexedFormatOpt causes the recorder to write the indexed event log format,
+// which may be efficiently seeked by a Reader, using blocks of the given
+// approximate uncompressed size (or DefaultBlockSize if zero).  Logs in the
+// indexed format remain readable by readers which do not understand it.  Note,
+// the index is only written once the recorder stops, so the log of a recorder
+// which does not stop cleanly may only be read sequentially.
+func IndexedFormatOpt(blockSize int) RecorderOpt {
+	return indexedFormatOpt(blockSize)
+}
+
+// BlockIndex describes a single block of an indexed event log.
+type BlockIndex struct {
+	// Offset is the byte offset of the block within the log.
+	Offset uint64
+
+	// FirstEvent is the number of the first event in the block, counting from zero.
+	FirstEvent uint64
+
+	// Events is the number of events in the block.
+	Events uint64
+
+	// FirstTime and LastTime are the times of the first and last events in the block.
+	FirstTime int64
+	LastTime  int64
+
+	// NodeIDs are the distinct node IDs of the events in the block, in order of appearance.
+	NodeIDs []uint64
+
+	// EventTypes is a bitmask of the event types in the block, where each
+	// bit is the field number of the event type in the StateEvent oneof.
+	EventTypes uint64
+}
+
+// HasEventType returns whether the block contains an event of the type with the
+// given StateEvent oneof field number.
+func (bi *BlockIndex) HasEventType(fieldNumber int) bool {
+	return bi.EventTypes&(1<<uint(fieldNumber)) != 0
+}
+
+func (bi *BlockIndex) add(event *rpb.RecordedEvent) {
+	if bi.Events == 0 {
+		bi.FirstTime = event.Time
+	}
+	bi.Events++
+	bi.LastTime = event.Time
+
+	found := false
+	for _, nodeID := range bi.NodeIDs {
+		if nodeID == event.NodeId {
+			found = true
+			break
+		}
+	}
+	if !found {
+		bi.NodeIDs = append(bi.NodeIDs, event.NodeId)
+	}
+
+	if od := event.StateEvent.ProtoReflect().Descriptor().Oneofs().ByName("type"); od != nil {
+		if fd := event.StateEvent.ProtoReflect().WhichOneof(od); fd != nil && fd.Number() < 64 {
+			bi.EventTypes |= 1 << uint(fd.Number())
+		}
+	}
+}
+
+func encodeIndex(index []BlockIndex) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	result := &bytes.Buffer{}
+	putUvarint := func(value uint64) {
+		result.Write(buf[:binary.PutUvarint(buf, value)])
+	}
+	putVarint := func(value int64) {
+		result.Write(buf[:binary.PutVarint(buf, value)])
+	}
+
+	putUvarint(indexFormatVersion)
+	putUvarint(uint64(len(index)))
+	for _, bi := range index {
+		putUvarint(bi.Offset)
+		putUvarint(bi.FirstEvent)
+		putUvarint(bi.Events)
+		putVarint(bi.FirstTime)
+		putVarint(bi.LastTime)
+		putUvarint(bi.EventTypes)
+		putUvarint(uint64(len(bi.NodeIDs)))
+		for _, nodeID := range bi.NodeIDs {
+			putUvarint(nodeID)
+		}
+	}
+
+	return result.Bytes()
+}
+
+func decodeIndex(data []byte) ([]BlockIndex, error) {
+	reader := bytes.NewReader(data)
+	var err error
+	getUvarint := func() uint64 {
+		if err != nil {
+			return 0
+		}
+		var value uint64
+		value, err = binary.ReadUvarint(reader)
+		return value
+	}
+	getVarint := func() int64 {
+		if err != nil {
+			return 0
+		}
+		var value int64
+		value, err = binary.ReadVarint(reader)
+		return value
+	}
+
+	if version := getUvarint(); err == nil && version != indexFormatVersion {
+		return nil, errors.Errorf("unsupported index version %d", version)
+	}
+
+	count := getUvarint()
+	var index []BlockIndex
+	for i := uint64(0); i < count && err == nil; i++ {
+		bi := BlockIndex{
+			Offset:     getUvarint(),
+			FirstEvent: getUvarint(),
+			Events:     getUvarint(),
+			FirstTime:  getVarint(),
+			LastTime:   getVarint(),
+			EventTypes: getUvarint(),
+		}
+		nodeCount := getUvarint()
+		for j := uint64(0); j < nodeCount && err == nil; j++ {
+			bi.NodeIDs = append(bi.NodeIDs, getUvarint())
+		}
+		index = append(index, bi)
+	}
+
+	if err != nil {
+		return nil, errors.WithMessage(err, "could not decode index")
+	}
+
+	return index, nil
+}
+
+func extraSubfield(id [2]byte, data []byte) []byte {
+	extra := make([]byte, 4, 4+len(data))
+	extra[0], extra[1] = id[0], id[1]
+	binary.LittleEndian.PutUint16(extra[2:], uint16(len(data)))
+	return append(extra, data...)
+}
+
+func parseExtraSubfield(id [2]byte, extra []byte) ([]byte, bool) {
+	for len(extra) >= 4 {
+		length := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+length {
+			return nil, false
+		}
+		if extra[0] == id[0] && extra[1] == id[1] {
+			return extra[4 : 4+length], true
+		}
+		extra = extra[4+length:]
+	}
+	return nil, false
+}
+
+type countingWriter struct {
+	dest  io.Writer
+	count int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.dest.Write(p)
+	cw.count += int64(n)
+	return n, err
+}
+
+// BlockWriter writes recorded events in the indexed event log format.
+// Close must be invoked to write the index.
+type BlockWriter struct {
+	counter   *countingWriter
+	blockSize int
+
+	gzWriter   *gzip.Writer
+	blockBytes int
+	current    *BlockIndex
+	index      []BlockIndex
+	events     uint64
+}
+
+// NewBlockWriter creates a BlockWriter which compresses blocks with the given
+// gzip compression level, beginning a new block once the current block contains
+// at least blockSize uncompressed bytes.
+func NewBlockWriter(dest io.Writer, compressionLevel, blockSize int) (*BlockWriter, error) {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+
+	counter := &countingWriter{dest: dest}
+	gzWriter, err := gzip.NewWriterLevel(counter, compressionLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlockWriter{
+		counter:   counter,
+		blockSize: blockSize,
+		gzWriter:  gzWriter,
+	}, nil
+}
+
+// Write appends the event to the current block.
+func (bw *BlockWriter) Write(event *rpb.RecordedEvent) error {
+	if bw.current == nil {
+		bw.current = &BlockIndex{
+			Offset:     uint64(bw.counter.count),
+			FirstEvent: bw.events,
+		}
+		bw.blockBytes = 0
+		bw.gzWriter.Reset(bw.counter)
+	}
+
+	if err := writeSizePrefixedProto(bw.gzWriter, event); err != nil {
+		return err
+	}
+
+	bw.current.add(event)
+	bw.events++
+	bw.blockBytes += proto.Size(event)
+
+	if bw.blockBytes >= bw.blockSize {
+		return bw.closeBlock()
+	}
+
+	return nil
+}
+
+func (bw *BlockWriter) closeBlock() error {
+	if bw.current == nil {
+		return nil
+	}
+
+	if err := bw.gzWriter.Close(); err != nil {
+		return errors.WithMessage(err, "could not close block")
+	}
+
+	bw.index = append(bw.index, *bw.current)
+	bw.current = nil
+	return nil
+}
+
+func (bw *BlockWriter) writeEmptyMember(extra []byte) error {
+	bw.gzWriter.Reset(bw.counter)
+	bw.gzWriter.Header = gzip.Header{
+		Extra: extra,
+		OS:    255, // unknown, the default
+	}
+	return bw.gzWriter.Close()
+}
+
+// Close completes the final block, then writes the index.
+func (bw *BlockWriter) Close() error {
+	if err := bw.closeBlock(); err != nil {
+		return err
+	}
+
+	indexOffset := uint64(bw.counter.count)
+	indexData := encodeIndex(bw.index)
+	chunks := uint64(0)
+	for len(indexData) > 0 || chunks == 0 {
+		size := len(indexData)
+		if size > maxSubfieldData {
+			size = maxSubfieldData
+		}
+
+		if err := bw.writeEmptyMember(extraSubfield(indexSubfieldID, indexData[:size])); err != nil {
+			return errors.WithMessage(err, "could not write index")
+		}
+
+		indexData = indexData[size:]
+		chunks++
+	}
+
+	locator := make([]byte, 16)
+	binary.BigEndian.PutUint64(locator, indexOffset)
+	binary.BigEndian.PutUint64(locator[8:], chunks)
+	if err := bw.writeEmptyMember(extraSubfield(locatorSubfieldID, locator)); err != nil {
+		return errors.WithMessage(err, "could not write index locator")
+	}
+
+	return nil
+}
+
+// blockStreamWriter adapts the BlockWriter to the recorder.
+type blockStreamWriter struct {
+	*BlockWriter
+}
+
+func (bsw blockStreamWriter) write(event *rpb.RecordedEvent) error {
+	return bsw.Write(event)
+}
+
+func (bsw blockStreamWriter) close() error {
+	return bsw.Close()
+}
+
+// readIndex attempts to load the index from the end of the source.  If the
+// source is not in the indexed format, it returns a nil index and no error.
+func readIndex(source io.ReadSeeker) ([]BlockIndex, error) {
+	size, err := source.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	tailSize := int64(locatorSearchSize)
+	if size < tailSize {
+		tailSize = size
+	}
+
+	if _, err := source.Seek(size-tailSize, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	tail := make([]byte, tailSize)
+	if _, err := io.ReadFull(source, tail); err != nil {
+		return nil, errors.WithMessage(err, "could not read log tail")
+	}
+
+	locator, ok := findLocator(tail)
+	if !ok {
+		return nil, nil
+	}
+
+	indexOffset := binary.BigEndian.Uint64(locator)
+	chunks := binary.BigEndian.Uint64(locator[8:])
+
+	if _, err := source.Seek(int64(indexOffset), io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	bufReader := bufio.NewReader(source)
+	var indexData []byte
+	for i := uint64(0); i < chunks; i++ {
+		gzReader, err := gzip.NewReader(bufReader)
+		if err != nil {
+			return nil, errors.WithMessage(err, "could not read index chunk")
+		}
+		gzReader.Multistream(false)
+
+		chunk, ok := parseExtraSubfield(indexSubfieldID, gzReader.Header.Extra)
+		if !ok {
+			return nil, errors.Errorf("index chunk %d is missing", i)
+		}
+		indexData = append(indexData, chunk...)
+
+		if _, err := io.Copy(ioutil.Discard, gzReader); err != nil {
+			return nil, errors.WithMessage(err, "could not read index chunk")
+		}
+	}
+
+	return decodeIndex(indexData)
+}
+
+// findLocator searches backwards through the tail of the log for the final
+// gzip member carrying the locator subfield.
+func findLocator(tail []byte) ([]byte, bool) {
+	for i := len(tail) - 4; i >= 0; i-- {
+		// Look for the gzip magic, deflate method, and FEXTRA flag
+		if tail[i] != 0x1f || tail[i+1] != 0x8b || tail[i+2] != 8 || tail[i+3]&0x04 == 0 {
+			continue
+		}
+
+		gzReader, err := gzip.NewReader(bytes.NewReader(tail[i:]))
+		if err != nil {
+			continue
+		}
+		gzReader.Multistream(false)
+
+		locator, ok := parseExtraSubfield(locatorSubfieldID, gzReader.Header.Extra)
+		if !ok || len(locator) != 16 {
+			continue
+		}
+
+		if data, err := ioutil.ReadAll(gzReader); err != nil || len(data) != 0 {
+			continue
+		}
+
+		return locator, true
+	}
+
+	return nil, false
+}
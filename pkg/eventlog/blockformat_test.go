@@ -0,0 +1,183 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package eventlog_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/IBM/mirbft/pkg/eventlog"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+)
+
+const eventCount = 1000
+
+// numberedEvent returns a tick event whose time is twice its number.
+func numberedEvent(number int) *rpb.RecordedEvent {
+	return &rpb.RecordedEvent{
+		NodeId:     uint64(number % 3),
+		Time:       int64(2 * number),
+		StateEvent: tickEvent,
+	}
+}
+
+var _ = Describe("Indexed format", func() {
+	var (
+		data []byte
+	)
+
+	BeforeEach(func() {
+		output := &bytes.Buffer{}
+		writer, err := eventlog.NewBlockWriter(output, gzip.BestSpeed, 1024)
+		Expect(err).NotTo(HaveOccurred())
+		for i := 0; i < eventCount; i++ {
+			Expect(writer.Write(numberedEvent(i))).To(Succeed())
+		}
+		Expect(writer.Close()).To(Succeed())
+		data = output.Bytes()
+	})
+
+	readNext := func(reader *eventlog.Reader) int64 {
+		event, err := reader.ReadEvent()
+		Expect(err).NotTo(HaveOccurred())
+		return event.Time / 2
+	}
+
+	It("can be read sequentially by a non-seeking reader", func() {
+		reader, err := eventlog.NewReader(bytes.NewBuffer(data))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reader.Index()).To(BeNil())
+
+		for i := 0; i < eventCount; i++ {
+			Expect(readNext(reader)).To(Equal(int64(i)))
+		}
+
+		_, err = reader.ReadEvent()
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	It("can be read by a standard gzip reader", func() {
+		gzReader, err := gzip.NewReader(bytes.NewReader(data))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = io.Copy(&bytes.Buffer{}, gzReader)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("loads the index", func() {
+		reader, err := eventlog.NewReader(bytes.NewReader(data))
+		Expect(err).NotTo(HaveOccurred())
+
+		index := reader.Index()
+		Expect(len(index)).To(BeNumerically(">", 1))
+		Expect(index[0].FirstEvent).To(Equal(uint64(0)))
+		Expect(index[0].Offset).To(Equal(uint64(0)))
+		Expect(index[0].NodeIDs).To(Equal([]uint64{0, 1, 2}))
+		Expect(index[0].HasEventType(9)).To(BeTrue())  // tick
+		Expect(index[0].HasEventType(8)).To(BeFalse()) // step
+
+		total := uint64(0)
+		for i, bi := range index {
+			Expect(bi.FirstEvent).To(Equal(total))
+			Expect(bi.FirstTime).To(Equal(int64(2 * total)))
+			total += bi.Events
+			Expect(bi.LastTime).To(Equal(int64(2 * (total - 1))))
+			if i > 0 {
+				Expect(bi.Offset).To(BeNumerically(">", index[i-1].Offset))
+			}
+		}
+		Expect(total).To(Equal(uint64(eventCount)))
+	})
+
+	It("seeks forwards and backwards", func() {
+		reader, err := eventlog.NewReader(bytes.NewReader(data))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(reader.Seek(700)).To(Succeed())
+		Expect(readNext(reader)).To(Equal(int64(700)))
+		Expect(readNext(reader)).To(Equal(int64(701)))
+
+		Expect(reader.Seek(3)).To(Succeed())
+		Expect(readNext(reader)).To(Equal(int64(3)))
+
+		Expect(reader.Seek(eventCount - 1)).To(Succeed())
+		Expect(readNext(reader)).To(Equal(int64(eventCount - 1)))
+		_, err = reader.ReadEvent()
+		Expect(err).To(Equal(io.EOF))
+
+		Expect(reader.Seek(eventCount + 1)).To(MatchError("cannot seek to event 1001, log contains only 1000 events"))
+	})
+
+	It("seeks by time", func() {
+		reader, err := eventlog.NewReader(bytes.NewReader(data))
+		Expect(err).NotTo(HaveOccurred())
+
+		eventNumber, err := reader.SeekTime(901)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(eventNumber).To(Equal(uint64(451)))
+		Expect(readNext(reader)).To(Equal(int64(451)))
+
+		eventNumber, err = reader.SeekTime(20)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(eventNumber).To(Equal(uint64(10)))
+		Expect(readNext(reader)).To(Equal(int64(10)))
+	})
+
+	When("the log is in the original format", func() {
+		BeforeEach(func() {
+			output := &bytes.Buffer{}
+			gzWriter := gzip.NewWriter(output)
+			for i := 0; i < eventCount; i++ {
+				Expect(eventlog.WriteRecordedEvent(gzWriter, numberedEvent(i))).To(Succeed())
+			}
+			Expect(gzWriter.Close()).To(Succeed())
+			data = output.Bytes()
+		})
+
+		It("seeks by re-reading the log", func() {
+			reader, err := eventlog.NewReader(bytes.NewReader(data))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reader.Index()).To(BeNil())
+
+			Expect(reader.Seek(700)).To(Succeed())
+			Expect(readNext(reader)).To(Equal(int64(700)))
+
+			Expect(reader.Seek(3)).To(Succeed())
+			Expect(readNext(reader)).To(Equal(int64(3)))
+		})
+
+		It("may only seek forwards if the source is not seekable", func() {
+			reader, err := eventlog.NewReader(bytes.NewBuffer(data))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(reader.Seek(700)).To(Succeed())
+			Expect(readNext(reader)).To(Equal(int64(700)))
+			Expect(reader.Seek(3)).To(MatchError("cannot seek backwards to event 3 in an unseekable source"))
+		})
+	})
+
+	It("is written by the recorder when requested", func() {
+		output := &bytes.Buffer{}
+		recorder := eventlog.NewRecorder(
+			1,
+			output,
+			eventlog.TimeSourceOpt(func() int64 { return 2 }),
+			eventlog.IndexedFormatOpt(0),
+		)
+		Expect(recorder.Intercept(tickEvent)).To(Succeed())
+		Expect(recorder.Intercept(tickEvent)).To(Succeed())
+		Expect(recorder.Stop()).To(Succeed())
+
+		reader, err := eventlog.NewReader(bytes.NewReader(output.Bytes()))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reader.Index()).To(HaveLen(1))
+		Expect(reader.Index()[0].Events).To(Equal(uint64(2)))
+	})
+})
@@ -0,0 +1,160 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package eventlog
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+	"github.com/IBM/mirbft/pkg/status"
+)
+
+// FlightRecorder is an implementation of the mirbft.EventInterceptor
+// interface which retains only the most recent events in memory, and writes
+// them only on request, typically after the node has exited with an error.
+// Because it never performs I/O while intercepting, it is suitable for
+// use in production.  Since the retained events generally begin mid-stream,
+// a dump cannot be replayed against a state machine, but it is useful for
+// understanding what the node was doing leading up to a failure.
+type FlightRecorder struct {
+	nodeID           uint64
+	timeSource       func() int64
+	compressionLevel int
+	sampler          sampler
+
+	mutex  sync.Mutex
+	events []eventTime
+
+	// total is the number of events intercepted, so the oldest
+	// retained event is at index total % len(events).
+	total uint64
+}
+
+// NewFlightRecorder creates a flight recorder which retains the most recent
+// size events, which must be at least one.  Of the recorder options, only
+// TimeSourceOpt, CompressionLevelOpt, and SampleOpt are applicable.
+func NewFlightRecorder(nodeID uint64, size int, opts ...RecorderOpt) (*FlightRecorder, error) {
+	if size < 1 {
+		return nil, errors.Errorf("flight recorder must retain at least one event, got size %d", size)
+	}
+
+	r := newRecorder(nodeID, opts)
+	return &FlightRecorder{
+		nodeID:           nodeID,
+		timeSource:       r.timeSource,
+		compressionLevel: r.compressionLevel,
+		sampler:          r.sampler,
+		events:           make([]eventTime, size),
+	}, nil
+}
+
+// Intercept records the event, overwriting the oldest retained event
+// if the buffer is full.  It never returns an error.
+func (fr *FlightRecorder) Intercept(event *pb.StateEvent) error {
+	if fr.sampler.skip(event) {
+		return nil
+	}
+
+	et := eventTime{
+		event: event,
+		time:  fr.timeSource(),
+	}
+
+	fr.mutex.Lock()
+	defer fr.mutex.Unlock()
+	fr.events[fr.total%uint64(len(fr.events))] = et
+	fr.total++
+	return nil
+}
+
+// Dump writes the retained events to dest in the standard log format.  If
+// older events have been discarded, the log begins with a gap marker
+// indicating how many.
+func (fr *FlightRecorder) Dump(dest io.Writer) error {
+	fr.mutex.Lock()
+	size := uint64(len(fr.events))
+	var events []eventTime
+	if fr.total <= size {
+		events = append(events, fr.events[:fr.total]...)
+	} else {
+		start := fr.total % size
+		events = append(events, fr.events[start:]...)
+		events = append(events, fr.events[:start]...)
+	}
+	total := fr.total
+	fr.mutex.Unlock()
+
+	gzWriter, err := gzip.NewWriterLevel(dest, fr.compressionLevel)
+	if err != nil {
+		return err
+	}
+
+	if total > size {
+		gap := newGapMarker(fr.nodeID, events[0].time, total-size)
+		if err := WriteRecordedEvent(gzWriter, gap); err != nil {
+			return errors.WithMessage(err, "error serializing to stream")
+		}
+	}
+
+	for _, et := range events {
+		err := WriteRecordedEvent(gzWriter, &rpb.RecordedEvent{
+			NodeId:     fr.nodeID,
+			Time:       et.time,
+			StateEvent: et.event,
+		})
+		if err != nil {
+			return errors.WithMessage(err, "error serializing to stream")
+		}
+	}
+
+	return errors.WithMessage(gzWriter.Close(), "error closing output")
+}
+
+// ExitingNode is the subset of the methods of *mirbft.Node required to
+// detect that the node has exited.
+type ExitingNode interface {
+	Err() <-chan struct{}
+	Status(ctx context.Context) (*status.StateMachine, error)
+}
+
+// DumpOnError blocks until the node exits.  If the node exited with an error
+// other than one of ignoreErrs (typically mirbft.ErrStopped), the retained
+// events are dumped to a new file at path.  It is intended to be invoked in
+// its own go routine immediately after the node is started.
+func (fr *FlightRecorder) DumpOnError(node ExitingNode, path string, ignoreErrs ...error) error {
+	<-node.Err()
+
+	_, exitErr := node.Status(context.Background())
+	if exitErr == nil {
+		return nil
+	}
+
+	for _, ignoreErr := range ignoreErrs {
+		if exitErr == ignoreErr {
+			return nil
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return errors.WithMessage(err, "could not create flight recorder dump")
+	}
+	defer file.Close()
+
+	if err := fr.Dump(file); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
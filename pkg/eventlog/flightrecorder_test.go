@@ -0,0 +1,140 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package eventlog_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/IBM/mirbft"
+	"github.com/IBM/mirbft/pkg/eventlog"
+	"github.com/IBM/mirbft/pkg/status"
+)
+
+// exitedNode is a node which has already exited with exitErr.
+type exitedNode struct {
+	exitErr error
+}
+
+func (en exitedNode) Err() <-chan struct{} {
+	errC := make(chan struct{})
+	close(errC)
+	return errC
+}
+
+func (en exitedNode) Status(ctx context.Context) (*status.StateMachine, error) {
+	return &status.StateMachine{}, en.exitErr
+}
+
+var _ = Describe("FlightRecorder", func() {
+	var (
+		eventTime      int64
+		flightRecorder *eventlog.FlightRecorder
+		output         *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		eventTime = 0
+		output = &bytes.Buffer{}
+		var err error
+		flightRecorder, err = eventlog.NewFlightRecorder(
+			3,
+			5,
+			eventlog.TimeSourceOpt(func() int64 { eventTime++; return eventTime }),
+		)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	readTimes := func(source io.Reader) []int64 {
+		reader, err := eventlog.NewReader(source)
+		Expect(err).NotTo(HaveOccurred())
+
+		var times []int64
+		for {
+			event, err := reader.ReadEvent()
+			if err == io.EOF {
+				return times
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(event.NodeId).To(Equal(uint64(3)))
+			if dropped, ok := eventlog.GapMarker(event); ok {
+				times = append(times, -int64(dropped))
+				continue
+			}
+			times = append(times, event.Time)
+		}
+	}
+
+	It("dumps all events when the buffer has not filled", func() {
+		for i := 0; i < 3; i++ {
+			Expect(flightRecorder.Intercept(tickEvent)).To(Succeed())
+		}
+
+		Expect(flightRecorder.Dump(output)).To(Succeed())
+		Expect(readTimes(output)).To(Equal([]int64{1, 2, 3}))
+	})
+
+	It("dumps only the most recent events, preceded by a gap", func() {
+		for i := 0; i < 12; i++ {
+			Expect(flightRecorder.Intercept(tickEvent)).To(Succeed())
+		}
+
+		Expect(flightRecorder.Dump(output)).To(Succeed())
+		Expect(readTimes(output)).To(Equal([]int64{-7, 8, 9, 10, 11, 12}))
+	})
+
+	It("requires room for at least one event", func() {
+		_, err := eventlog.NewFlightRecorder(3, 0)
+		Expect(err).To(MatchError("flight recorder must retain at least one event, got size 0"))
+	})
+
+	When("the node exits", func() {
+		var (
+			dir string
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "flightrecorder")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(flightRecorder.Intercept(tickEvent)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("dumps the events if the node failed", func() {
+			path := filepath.Join(dir, "dump.gz")
+			err := flightRecorder.DumpOnError(exitedNode{exitErr: fmt.Errorf("fake-error")}, path, mirbft.ErrStopped)
+			Expect(err).NotTo(HaveOccurred())
+
+			file, err := os.Open(path)
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close()
+			Expect(readTimes(file)).To(Equal([]int64{1}))
+		})
+
+		It("does not dump the events if the node was stopped", func() {
+			path := filepath.Join(dir, "dump.gz")
+			err := flightRecorder.DumpOnError(exitedNode{exitErr: mirbft.ErrStopped}, path, mirbft.ErrStopped)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = os.Stat(path)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+})
@@ -13,7 +13,9 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -78,6 +80,97 @@ func BufferSizeOpt(size int) RecorderOpt {
 	return bufferSizeOpt(size)
 }
 
+type nonBlockingOpt struct{}
+
+// NonBlockingOpt indicates that rather than blocking the state machine when
+// the buffer is full, the recorder should drop the event.  The number of
+// consecutive events dropped is recorded in the log via a gap marker event
+// (see GapMarker) inserted before the next event which fits in the buffer.
+// Note that a log with gaps can no longer be replayed against a state machine,
+// but unlike the default recorder, may be safely enabled in production.
+func NonBlockingOpt() RecorderOpt {
+	return nonBlockingOpt{}
+}
+
+type recordResultsOpt struct{}
+
+// RecordResultsOpt indicates that in addition to each state event, the
+// recorder should record the result the state machine produced when applying
+// it (see RecordedEvent.Result).  This makes the log substantially larger,
+// but allows verifying that a later version of the state machine produces
+// the same actions given the same events.  The results are only available
+// when the recorder is used as the EventInterceptor of a mir node, which
+// invokes InterceptResult after applying each event.
+func RecordResultsOpt() RecorderOpt {
+	return recordResultsOpt{}
+}
+
+type sampleOpt struct {
+	eventType reflect.Type
+	every     uint64
+}
+
+// SampleOpt reduces the number of events recorded of a particular type, so
+// that only one in every 'every' events of this type is recorded.  If every
+// is zero, then no events of this type are recorded.  The event type is
+// specified by an instance of the state event type wrapper, for instance,
+// to exclude all ticks:
+//
+//	SampleOpt(&pb.StateEvent_Tick{}, 0)
+//
+// Unlike events dropped by a non-blocking recorder, events excluded by
+// sampling are not noted via gap markers.  Like a log with gaps however, a
+// sampled log can no longer be replayed against a state machine.
+func SampleOpt(eventType interface{}, every uint64) RecorderOpt {
+	return sampleOpt{
+		eventType: reflect.TypeOf(eventType),
+		every:     every,
+	}
+}
+
+// sampler tracks the events seen of each sampled type.
+type sampler map[reflect.Type]*sampleCount
+
+type sampleCount struct {
+	every uint64
+	seen  uint64
+}
+
+// skip returns whether the event should be excluded from the log.
+func (s sampler) skip(event *pb.StateEvent) bool {
+	count, ok := s[reflect.TypeOf(event.Type)]
+	if !ok {
+		return false
+	}
+
+	if count.every == 0 {
+		return true
+	}
+
+	count.seen++
+	return (count.seen-1)%count.every != 0
+}
+
+// newGapMarker returns an event with no state event, indicating that
+// dropped events were not recorded.
+func newGapMarker(nodeID uint64, time int64, dropped uint64) *rpb.RecordedEvent {
+	return &rpb.RecordedEvent{
+		NodeId:  nodeID,
+		Time:    time,
+		Dropped: dropped,
+	}
+}
+
+// GapMarker returns the number of events which were dropped and true if the
+// event is a gap marker, or false if this is an ordinary state event.
+func GapMarker(event *rpb.RecordedEvent) (uint64, bool) {
+	if event.StateEvent != nil {
+		return 0, false
+	}
+
+	return event.Dropped, true
+}
+
 // Recorder is intended to be used as an imlementation of the
 // mirbft.EventInterceptor interface.  It receives state events,
 // serializes them, compresses them, and writes them to a stream.
@@ -86,15 +179,56 @@ type Recorder struct {
 	timeSource        func() int64
 	compressionLevel  int
 	retainRequestData bool
+	indexed           bool
+	blockSize         int
+	nonBlocking       bool
+	recordResults     bool
+	sampler           sampler
+	rotation          *rotation
 	eventC            chan eventTime
 	doneC             chan struct{}
 	exitC             chan struct{}
 
 	exitErr      error
 	exitErrMutex sync.Mutex
+
+	// pendingDropped is the number of events dropped since the last
+	// event was enqueued, it is only accessed by Intercept.
+	pendingDropped uint64
+
+	// awaitingResult is an intercepted event which will be enqueued
+	// once its result is known, it is only accessed by Intercept,
+	// InterceptResult, and Stop.
+	awaitingResult *eventTime
+
+	// dropped is the total number of events dropped, it must be
+	// accessed atomically.
+	dropped uint64
 }
 
 func NewRecorder(nodeID uint64, dest io.Writer, opts ...RecorderOpt) *Recorder {
+	i := newRecorder(nodeID, opts)
+
+	go i.run(func() (eventWriter, error) {
+		if i.indexed {
+			blockWriter, err := NewBlockWriter(dest, i.compressionLevel, i.blockSize)
+			if err != nil {
+				return nil, err
+			}
+			return blockStreamWriter{BlockWriter: blockWriter}, nil
+		}
+
+		gzWriter, err := gzip.NewWriterLevel(dest, i.compressionLevel)
+		if err != nil {
+			return nil, err
+		}
+		return &streamWriter{gzWriter: gzWriter}, nil
+	})
+
+	return i
+}
+
+func newRecorder(nodeID uint64, opts []RecorderOpt) *Recorder {
 	startTime := time.Now()
 
 	i := &Recorder{
@@ -103,6 +237,7 @@ func NewRecorder(nodeID uint64, dest io.Writer, opts ...RecorderOpt) *Recorder {
 			return time.Since(startTime).Milliseconds()
 		},
 		compressionLevel: DefaultCompressionLevel,
+		sampler:          sampler{},
 		eventC:           make(chan eventTime, DefaultBufferSize),
 		doneC:            make(chan struct{}),
 		exitC:            make(chan struct{}),
@@ -118,41 +253,194 @@ func NewRecorder(nodeID uint64, dest io.Writer, opts ...RecorderOpt) *Recorder {
 			i.compressionLevel = int(v)
 		case bufferSizeOpt:
 			i.eventC = make(chan eventTime, v)
+		case indexedFormatOpt:
+			i.indexed = true
+			i.blockSize = int(v)
+		case nonBlockingOpt:
+			i.nonBlocking = true
+		case recordResultsOpt:
+			i.recordResults = true
+		case sampleOpt:
+			i.sampler[v.eventType] = &sampleCount{every: v.every}
 		}
 	}
 
-	go i.run(dest)
-
 	return i
 }
 
+// eventWriter serializes recorded events to the recorder's destination.
+type eventWriter interface {
+	write(event *rpb.RecordedEvent) error
+	close() error
+}
+
+// streamWriter writes all events to a single gzip stream.
+type streamWriter struct {
+	gzWriter *gzip.Writer
+}
+
+func (sw *streamWriter) write(event *rpb.RecordedEvent) error {
+	return WriteRecordedEvent(sw.gzWriter, event)
+}
+
+func (sw *streamWriter) close() error {
+	return sw.gzWriter.Close()
+}
+
 type eventTime struct {
 	event *pb.StateEvent
 	time  int64
+
+	// dropped is non-zero for gap markers, in which case event is nil.
+	dropped uint64
+
+	// result is the result of applying the event, if recorded.
+	result *pb.StateEventResult
+
+	// snapshot is non-nil for the markers at which a rotating recorder
+	// begins a new segment, in which case event is nil.
+	snapshot []*pb.StateEvent
 }
 
 // Intercept takes an event and enqueues it into the event buffer.
-// If there is no room in the buffer, it blocks.  If draining the buffer
+// If there is no room in the buffer, it blocks, unless the recorder is
+// non-blocking, in which case the event is dropped.  If draining the buffer
 // to the output stream has completed (successfully or otherwise), Intercept
 // returns an error.
 func (i *Recorder) Intercept(event *pb.StateEvent) error {
-	select {
-	case i.eventC <- eventTime{
+	if i.awaitingResult != nil {
+		// The previous event's result never arrived, so record
+		// the event without it.
+		et := *i.awaitingResult
+		i.awaitingResult = nil
+		if err := i.enqueue(et); err != nil {
+			return err
+		}
+	}
+
+	if i.rotation != nil && event.GetInitialize() != nil {
+		i.rotation.initialize = event
+	}
+
+	if i.sampler.skip(event) {
+		return nil
+	}
+
+	et := eventTime{
 		event: event,
 		time:  i.timeSource(),
-	}:
+	}
+
+	if i.recordResults {
+		i.awaitingResult = &et
+		return nil
+	}
+
+	return i.enqueue(et)
+}
+
+// InterceptResult records the result of applying the most recently
+// intercepted event, along with the event itself.  If the recorder was not
+// created with RecordResultsOpt, it does nothing.
+func (i *Recorder) InterceptResult(event *pb.StateEvent, result *pb.StateEventResult) error {
+	if i.awaitingResult == nil || i.awaitingResult.event != event {
+		// The event was excluded by sampling, or results are
+		// not being recorded.
 		return nil
+	}
+
+	et := *i.awaitingResult
+	et.result = result
+	i.awaitingResult = nil
+	return i.enqueue(et)
+}
+
+// enqueue places the event into the event buffer, blocking or dropping
+// the event if there is no room, according to the recorder's mode.  For
+// rotating recorders, it then begins a new segment if one is due.
+func (i *Recorder) enqueue(et eventTime) error {
+	enqueued, err := i.send(et)
+	if err != nil || !enqueued || i.rotation == nil {
+		return err
+	}
+
+	return i.rotateIfDue(et)
+}
+
+// send places the event into the event buffer, and returns whether it
+// was enqueued, or dropped by a non-blocking recorder.
+func (i *Recorder) send(et eventTime) (bool, error) {
+	if !i.nonBlocking {
+		select {
+		case i.eventC <- et:
+			return true, nil
+		case <-i.exitC:
+			return false, i.getExitErr()
+		}
+	}
+
+	if i.pendingDropped > 0 {
+		select {
+		case i.eventC <- eventTime{time: et.time, dropped: i.pendingDropped}:
+			i.pendingDropped = 0
+		case <-i.exitC:
+			return false, i.getExitErr()
+		default:
+			i.drop()
+			return false, nil
+		}
+	}
+
+	select {
+	case i.eventC <- et:
+		return true, nil
 	case <-i.exitC:
-		i.exitErrMutex.Lock()
-		defer i.exitErrMutex.Unlock()
-		return i.exitErr
+		return false, i.getExitErr()
+	default:
+		i.drop()
+		return false, nil
 	}
 }
 
+func (i *Recorder) drop() {
+	i.pendingDropped++
+	atomic.AddUint64(&i.dropped, 1)
+}
+
+// Dropped returns the total number of events which a non-blocking
+// recorder has dropped because its buffer was full.
+func (i *Recorder) Dropped() uint64 {
+	return atomic.LoadUint64(&i.dropped)
+}
+
+func (i *Recorder) getExitErr() error {
+	i.exitErrMutex.Lock()
+	defer i.exitErrMutex.Unlock()
+	return i.exitErr
+}
+
 // Stop must be invoked to release the resources associated with this
 // Interceptor, and should only be invoked after the mir node has completely
 // exited.  The returned error
 func (i *Recorder) Stop() error {
+	if i.awaitingResult != nil {
+		select {
+		case i.eventC <- *i.awaitingResult:
+			i.awaitingResult = nil
+		case <-i.exitC:
+		}
+	}
+
+	if i.pendingDropped > 0 {
+		// Record the events dropped after the last successful
+		// Intercept, there is no longer any contention for the buffer.
+		select {
+		case i.eventC <- eventTime{time: i.timeSource(), dropped: i.pendingDropped}:
+			i.pendingDropped = 0
+		case <-i.exitC:
+		}
+	}
+
 	close(i.doneC)
 	<-i.exitC
 	i.exitErrMutex.Lock()
@@ -165,7 +453,7 @@ func (i *Recorder) Stop() error {
 
 var errStopped = fmt.Errorf("interceptor stopped at caller request")
 
-func (i *Recorder) run(dest io.Writer) (exitErr error) {
+func (i *Recorder) run(newWriter func() (eventWriter, error)) (exitErr error) {
 	defer func() {
 		i.exitErrMutex.Lock()
 		i.exitErr = exitErr
@@ -173,17 +461,30 @@ func (i *Recorder) run(dest io.Writer) (exitErr error) {
 		close(i.exitC)
 	}()
 
-	gzWriter, err := gzip.NewWriterLevel(dest, i.compressionLevel)
+	writer, err := newWriter()
 	if err != nil {
 		return err
 	}
-	defer gzWriter.Close()
+	defer func() {
+		if err := writer.close(); err != nil && exitErr == errStopped {
+			exitErr = errors.WithMessage(err, "error closing output")
+		}
+	}()
 
 	write := func(eventTime eventTime) error {
-		return WriteRecordedEvent(gzWriter, &rpb.RecordedEvent{
+		if eventTime.snapshot != nil {
+			return writer.(*segmentWriter).rotate(eventTime.time, eventTime.snapshot)
+		}
+
+		if eventTime.dropped > 0 {
+			return writer.write(newGapMarker(i.nodeID, eventTime.time, eventTime.dropped))
+		}
+
+		return writer.write(&rpb.RecordedEvent{
 			NodeId:     i.nodeID,
 			Time:       eventTime.time,
 			StateEvent: eventTime.event,
+			Result:     eventTime.result,
 		})
 	}
 
@@ -232,26 +533,68 @@ func writeSizePrefixedProto(dest io.Writer, msg proto.Message) error {
 	return nil
 }
 
+// Reader reads the events of a log in either the original (single gzip stream)
+// format, or the indexed format.  If the source is seekable, then the reader
+// may seek to a particular event, or time, efficiently when the log is
+// indexed, or by re-reading the log otherwise.
 type Reader struct {
 	buffer   *bytes.Buffer
 	gzReader *gzip.Reader
 	source   *bufio.Reader
+
+	// seeker is the original source, if it is seekable
+	seeker io.ReadSeeker
+	index  []BlockIndex
+
+	// next is the number of the next event to be read
+	next uint64
+
+	// peeked is an event which has been read, but not yet returned
+	peeked *rpb.RecordedEvent
 }
 
 func NewReader(source io.Reader) (*Reader, error) {
+	r := &Reader{
+		buffer: &bytes.Buffer{},
+	}
+
+	if seeker, ok := source.(io.ReadSeeker); ok {
+		index, err := readIndex(seeker)
+		if err == nil {
+			// Note, we simply treat any source which we fail to seek
+			// (such as a pipe on stdin) as unseekable.
+			_, err = seeker.Seek(0, io.SeekStart)
+		}
+		if err == nil {
+			r.seeker = seeker
+			r.index = index
+		}
+	}
+
 	gzReader, err := gzip.NewReader(source)
 	if err != nil {
 		return nil, errors.WithMessage(err, "could not read source as a gzip stream")
 	}
 
-	return &Reader{
-		buffer:   &bytes.Buffer{},
-		gzReader: gzReader,
-		source:   bufio.NewReader(gzReader),
-	}, nil
+	r.gzReader = gzReader
+	r.source = bufio.NewReader(gzReader)
+	return r, nil
+}
+
+// Index returns the block index of the log, or nil if the log is not in the
+// indexed format, or the source is not seekable.
+func (r *Reader) Index() []BlockIndex {
+	return r.index
 }
 
 func (r *Reader) ReadEvent() (*rpb.RecordedEvent, error) {
+	if r.peeked != nil {
+		re := r.peeked
+		r.peeked = nil
+		r.next++
+		return re, nil
+	}
+
 	re := &rpb.RecordedEvent{}
 	err := readSizePrefixedProto(r.source, re, r.buffer)
 	if err == io.EOF {
@@ -262,10 +605,100 @@ func (r *Reader) ReadEvent() (*rpb.RecordedEvent, error) {
 		return nil, errors.WithMessage(err, "error reading event")
 	}
 	r.buffer.Reset()
+	r.next++
 
 	return re, nil
 }
 
+// rewind positions the underlying reader at the given byte offset, which
+// must be the start of a gzip member, containing the given event number.
+func (r *Reader) rewind(offset, eventNumber uint64) error {
+	if _, err := r.seeker.Seek(int64(offset), io.SeekStart); err != nil {
+		return errors.WithMessage(err, "could not seek source")
+	}
+
+	if err := r.gzReader.Reset(bufio.NewReader(r.seeker)); err != nil {
+		return errors.WithMessage(err, "could not read source as a gzip stream")
+	}
+
+	r.source.Reset(r.gzReader)
+	r.buffer.Reset()
+	r.peeked = nil
+	r.next = eventNumber
+	return nil
+}
+
+// Seek positions the reader such that the next event read is the event of the
+// given number, counting from zero.  If the log is not indexed, and the event
+// precedes the current position, the source must be seekable.
+func (r *Reader) Seek(eventNumber uint64) error {
+	switch {
+	case len(r.index) > 0:
+		block := r.index[0]
+		for _, bi := range r.index {
+			if bi.FirstEvent > eventNumber {
+				break
+			}
+			block = bi
+		}
+
+		if eventNumber < r.next || r.next < block.FirstEvent {
+			if err := r.rewind(block.Offset, block.FirstEvent); err != nil {
+				return err
+			}
+		}
+	case eventNumber < r.next:
+		if r.seeker == nil {
+			return errors.Errorf("cannot seek backwards to event %d in an unseekable source", eventNumber)
+		}
+		if err := r.rewind(0, 0); err != nil {
+			return err
+		}
+	}
+
+	for r.next < eventNumber {
+		if _, err := r.ReadEvent(); err != nil {
+			if err == io.EOF {
+				return errors.Errorf("cannot seek to event %d, log contains only %d events", eventNumber, r.next)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SeekTime positions the reader such that the next event read is the first
+// event whose time is at least the given time, and returns the number of
+// that event.  The event times are assumed to be non-decreasing.
+func (r *Reader) SeekTime(time int64) (uint64, error) {
+	eventNumber := uint64(0)
+	for _, bi := range r.index {
+		if bi.LastTime >= time {
+			eventNumber = bi.FirstEvent
+			break
+		}
+		eventNumber = bi.FirstEvent + bi.Events
+	}
+
+	if err := r.Seek(eventNumber); err != nil {
+		return 0, err
+	}
+
+	for {
+		event, err := r.ReadEvent()
+		if err != nil {
+			return 0, err
+		}
+
+		if event.Time >= time {
+			r.peeked = event
+			r.next--
+			return r.next, nil
+		}
+	}
+}
+
 func readSizePrefixedProto(reader *bufio.Reader, msg proto.Message, buffer *bytes.Buffer) error {
 	l, err := binary.ReadVarint(reader)
 	if err != nil {
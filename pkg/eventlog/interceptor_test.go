@@ -8,6 +8,7 @@ package eventlog_test
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 
 	. "github.com/onsi/ginkgo"
@@ -49,9 +50,167 @@ var _ = Describe("Recorder", func() {
 		Expect(output.Len()).To(Equal(46))
 	})
 
-	// TODO, add tests with write failures, write blocking, etc. generate mock
+	When("the recorder is non-blocking", func() {
+		var (
+			writer *blockingWriter
+		)
+
+		BeforeEach(func() {
+			writer = &blockingWriter{
+				output:   output,
+				startedC: make(chan struct{}),
+				releaseC: make(chan struct{}),
+			}
+		})
+
+		It("drops events which do not fit in the buffer and records the gap", func() {
+			var eventTime int64
+			interceptor := eventlog.NewRecorder(
+				1,
+				writer,
+				eventlog.TimeSourceOpt(func() int64 { eventTime++; return eventTime }),
+				eventlog.BufferSizeOpt(2),
+				eventlog.NonBlockingOpt(),
+			)
+
+			Expect(interceptor.Intercept(tickEvent)).To(Succeed())
+			<-writer.startedC
+			for i := 0; i < 5; i++ {
+				Expect(interceptor.Intercept(tickEvent)).To(Succeed())
+			}
+			Expect(interceptor.Dropped()).To(Equal(uint64(3)))
+
+			close(writer.releaseC)
+			Expect(interceptor.Stop()).To(Succeed())
+
+			reader, err := eventlog.NewReader(output)
+			Expect(err).NotTo(HaveOccurred())
+			for _, expectedTime := range []int64{1, 2, 3} {
+				event, err := reader.ReadEvent()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(event.Time).To(Equal(expectedTime))
+				_, ok := eventlog.GapMarker(event)
+				Expect(ok).To(BeFalse())
+			}
+
+			event, err := reader.ReadEvent()
+			Expect(err).NotTo(HaveOccurred())
+			dropped, ok := eventlog.GapMarker(event)
+			Expect(ok).To(BeTrue())
+			Expect(dropped).To(Equal(uint64(3)))
+			Expect(event.NodeId).To(Equal(uint64(1)))
+
+			_, err = reader.ReadEvent()
+			Expect(err).To(Equal(io.EOF))
+		})
+	})
+
+	It("samples the selected event types", func() {
+		interceptor := eventlog.NewRecorder(
+			1,
+			output,
+			eventlog.SampleOpt(&pb.StateEvent_Tick{}, 3),
+			eventlog.SampleOpt(&pb.StateEvent_Propose{}, 0),
+		)
+		for i := 0; i < 7; i++ {
+			Expect(interceptor.Intercept(tickEvent)).To(Succeed())
+			Expect(interceptor.Intercept(proposeEvent)).To(Succeed())
+			Expect(interceptor.Intercept(actionsReceivedEvent)).To(Succeed())
+		}
+		Expect(interceptor.Stop()).To(Succeed())
+
+		counts := readEventTypes(output)
+		Expect(counts).To(Equal(map[string]int{
+			"*mirbftpb.StateEvent_Tick":            3,
+			"*mirbftpb.StateEvent_ActionsReceived": 7,
+		}))
+	})
+
+	It("records the results of events", func() {
+		interceptor := eventlog.NewRecorder(
+			1,
+			output,
+			eventlog.RecordResultsOpt(),
+			eventlog.SampleOpt(&pb.StateEvent_Tick{}, 0),
+		)
+		result := &pb.StateEventResult{
+			Hash: []*pb.StateEventResult_HashRequest{{Data: [][]byte{[]byte("data")}}},
+		}
+
+		Expect(interceptor.Intercept(proposeEvent)).To(Succeed())
+		Expect(interceptor.InterceptResult(proposeEvent, result)).To(Succeed())
+		Expect(interceptor.Intercept(tickEvent)).To(Succeed())
+		Expect(interceptor.InterceptResult(tickEvent, &pb.StateEventResult{})).To(Succeed())
+		Expect(interceptor.Intercept(actionsReceivedEvent)).To(Succeed())
+		Expect(interceptor.Stop()).To(Succeed())
+
+		reader, err := eventlog.NewReader(output)
+		Expect(err).NotTo(HaveOccurred())
+
+		event, err := reader.ReadEvent()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proto.Equal(event.StateEvent, proposeEvent)).To(BeTrue())
+		Expect(proto.Equal(event.Result, result)).To(BeTrue())
+
+		event, err = reader.ReadEvent()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proto.Equal(event.StateEvent, actionsReceivedEvent)).To(BeTrue())
+		Expect(event.Result).To(BeNil())
+
+		_, err = reader.ReadEvent()
+		Expect(err).To(Equal(io.EOF))
+	})
 })
 
+var (
+	proposeEvent = &pb.StateEvent{
+		Type: &pb.StateEvent_Propose{
+			Propose: &pb.StateEvent_Proposal{
+				Request: &pb.RequestAck{ClientId: 1, ReqNo: 1},
+			},
+		},
+	}
+
+	actionsReceivedEvent = &pb.StateEvent{
+		Type: &pb.StateEvent_ActionsReceived{
+			ActionsReceived: &pb.StateEvent_Ready{},
+		},
+	}
+)
+
+// readEventTypes returns the number of events of each type in the log.
+func readEventTypes(source io.Reader) map[string]int {
+	reader, err := eventlog.NewReader(source)
+	Expect(err).NotTo(HaveOccurred())
+
+	counts := map[string]int{}
+	for {
+		event, err := reader.ReadEvent()
+		if err == io.EOF {
+			return counts
+		}
+		Expect(err).NotTo(HaveOccurred())
+		counts[fmt.Sprintf("%T", event.StateEvent.Type)]++
+	}
+}
+
+// blockingWriter blocks its first write until released.
+type blockingWriter struct {
+	output   io.Writer
+	started  bool
+	startedC chan struct{}
+	releaseC chan struct{}
+}
+
+func (bw *blockingWriter) Write(data []byte) (int, error) {
+	if !bw.started {
+		bw.started = true
+		close(bw.startedC)
+		<-bw.releaseC
+	}
+	return bw.output.Write(data)
+}
+
 var _ = Describe("Reader", func() {
 
 	var (
@@ -0,0 +1,525 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package eventlog
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+)
+
+// ManifestFileName is the name of the manifest within a segment directory.
+const ManifestFileName = "manifest.json"
+
+// DefaultSegmentSize is the approximate number of compressed bytes after
+// which a rotating recorder begins a new segment, when not overridden.
+const DefaultSegmentSize = 64 * 1024 * 1024
+
+// DefaultRetainSegments is the number of segments a rotating recorder
+// retains on disk, when not overridden.
+const DefaultRetainSegments = 8
+
+type segmentSizeOpt int64
+
+// SegmentSizeOpt overrides the default segment size of a rotating recorder.
+// Because the output is compressed in blocks, the size is approximate.
+// A size of zero disables size based rotation.
+func SegmentSizeOpt(size int64) RecorderOpt {
+	return segmentSizeOpt(size)
+}
+
+type segmentDurationOpt int64
+
+// SegmentDurationOpt causes a rotating recorder to begin a new segment once
+// the given duration has elapsed since the segment began.  The duration is
+// measured in the units of the time source (by default, milliseconds).
+func SegmentDurationOpt(duration int64) RecorderOpt {
+	return segmentDurationOpt(duration)
+}
+
+type retainSegmentsOpt int
+
+// RetainSegmentsOpt overrides the default number of segments which a
+// rotating recorder retains.  Once a new segment begins, the oldest
+// segments beyond this count are deleted.  A count of zero retains every segment.
+func RetainSegmentsOpt(count int) RecorderOpt {
+	return retainSegmentsOpt(count)
+}
+
+// WALSource is the source of the persisted entries used to construct the
+// snapshot at the start of each segment.  It is satisfied by the
+// mirbft.WALStorage interface, and typically, should be the WAL of the node.
+type WALSource interface {
+	LoadAll(forEach func(index uint64, p *pb.Persistent)) error
+}
+
+type walSourceOpt struct {
+	source WALSource
+}
+
+// WALSourceOpt sets the WAL from which a rotating recorder constructs the
+// snapshot at the start of each segment.  It is required for rotating recorders.
+func WALSourceOpt(source WALSource) RecorderOpt {
+	return walSourceOpt{source: source}
+}
+
+// Manifest describes the segments written by a rotating recorder.  Every
+// segment is a complete event log which may be read with a Reader.  Each
+// segment after the first begins with a snapshot, a synthetic sequence of
+// Initialize, LoadEntry, and CompleteInitialization events constructed from
+// the WAL as it was when the results which precede the segment were added.
+// Note, that because the state machine cannot be snapshotted directly,
+// replaying a segment from its snapshot is akin to restarting the node, and
+// the subsequent recorded events may not apply identically.
+type Manifest struct {
+	NodeID   uint64             `json:"node_id"`
+	Segments []*ManifestSegment `json:"segments"`
+}
+
+type ManifestSegment struct {
+	Number uint64 `json:"number"`
+	File   string `json:"file"`
+
+	// SnapshotEvents is the number of synthetic events at the start of the segment.
+	SnapshotEvents int `json:"snapshot_events"`
+
+	// StartTime is the time of the first recorded event in the segment.
+	StartTime int64 `json:"start_time"`
+
+	// Events is the number of recorded events in the segment, excluding the
+	// snapshot events.  It is only accurate once the segment is complete.
+	Events uint64 `json:"events"`
+
+	// Complete indicates that the segment was closed cleanly.
+	Complete bool `json:"complete"`
+}
+
+// ReadManifest reads the manifest from the given segment directory.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return nil, errors.WithMessage(err, "could not read manifest")
+	}
+
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, errors.WithMessage(err, "could not parse manifest")
+	}
+
+	return manifest, nil
+}
+
+// write atomically replaces the manifest in the given directory.
+func (m *Manifest) write(dir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.WithMessage(err, "could not marshal manifest")
+	}
+
+	tmpPath := filepath.Join(dir, ManifestFileName+".tmp")
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return errors.WithMessage(err, "could not write manifest")
+	}
+
+	return errors.WithMessage(os.Rename(tmpPath, filepath.Join(dir, ManifestFileName)), "could not replace manifest")
+}
+
+// NewRotatingRecorder creates a recorder which writes to a sequence of
+// segment files in the given directory, rather than a single stream.  A new
+// segment is started once the current one exceeds the configured size or
+// duration, and only the most recent segments are retained.  The segments
+// are described by a manifest in the same directory.  If the directory
+// already contains a manifest for this node, the new segments are appended.
+// The WALSourceOpt must be supplied, so that each segment may begin with a
+// snapshot of the WAL.
+func NewRotatingRecorder(nodeID uint64, dir string, opts ...RecorderOpt) (*Recorder, error) {
+	r := &rotation{}
+	for _, opt := range opts {
+		if v, ok := opt.(walSourceOpt); ok {
+			r.walSource = v.source
+		}
+	}
+
+	if r.walSource == nil {
+		return nil, errors.Errorf("rotating recorder requires a WAL source")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.WithMessage(err, "could not create segment directory")
+	}
+
+	manifest, err := ReadManifest(dir)
+	switch {
+	case os.IsNotExist(errors.Cause(err)):
+		manifest = &Manifest{NodeID: nodeID}
+	case err != nil:
+		return nil, err
+	case manifest.NodeID != nodeID:
+		return nil, errors.Errorf("segment directory contains segments for node %d", manifest.NodeID)
+	}
+
+	i := newRecorder(nodeID, opts)
+	i.rotation = r
+
+	sw := &segmentWriter{
+		dir:              dir,
+		nodeID:           nodeID,
+		compressionLevel: i.compressionLevel,
+		segmentSize:      DefaultSegmentSize,
+		retainSegments:   DefaultRetainSegments,
+		rotation:         r,
+		manifest:         manifest,
+	}
+
+	for _, opt := range opts {
+		switch v := opt.(type) {
+		case segmentSizeOpt:
+			sw.segmentSize = int64(v)
+		case segmentDurationOpt:
+			sw.segmentDuration = int64(v)
+		case retainSegmentsOpt:
+			sw.retainSegments = int(v)
+		}
+	}
+
+	go i.run(func() (eventWriter, error) {
+		return sw, nil
+	})
+
+	return i, nil
+}
+
+// rotation coordinates the start of new segments between the segment
+// writer, which determines when a new segment is due, and the recorder,
+// which snapshots the WAL in step with the intercepted events.  New segments
+// begin only after an AddResults event, because the node does not hand the
+// processor any further actions until that event has been applied, so the
+// WAL contains exactly the entries which the recorded events have persisted.
+type rotation struct {
+	walSource WALSource
+
+	// due is set by the segment writer once the current segment is full,
+	// and cleared by the recorder as it snapshots the WAL.  It must be
+	// accessed atomically.
+	due int32
+
+	// initialize is the event which started the node, it is only
+	// accessed by Intercept.
+	initialize *pb.StateEvent
+}
+
+// rotateIfDue enqueues a marker carrying a snapshot of the WAL after an
+// AddResults event, if the segment writer has requested a new segment.
+func (i *Recorder) rotateIfDue(et eventTime) error {
+	if et.event.GetAddResults() == nil || i.rotation.initialize == nil {
+		// Without the initialize event, which is only intercepted as
+		// the node starts, there is no way to construct a snapshot.
+		return nil
+	}
+
+	if !atomic.CompareAndSwapInt32(&i.rotation.due, 1, 0) {
+		return nil
+	}
+
+	snapshot, err := i.rotation.snapshot()
+	if err != nil {
+		return err
+	}
+
+	enqueued, err := i.send(eventTime{time: et.time, snapshot: snapshot})
+	if err == nil && !enqueued {
+		// The marker was dropped, so try again after the next results.
+		atomic.StoreInt32(&i.rotation.due, 1)
+	}
+
+	return err
+}
+
+// snapshot constructs the events which bring a fresh state machine to the
+// state of the node after a restart from its current WAL.
+func (r *rotation) snapshot() ([]*pb.StateEvent, error) {
+	stateEvents := []*pb.StateEvent{r.initialize}
+
+	err := r.walSource.LoadAll(func(index uint64, p *pb.Persistent) {
+		stateEvents = append(stateEvents, &pb.StateEvent{
+			Type: &pb.StateEvent_LoadEntry{
+				LoadEntry: &pb.StateEvent_PersistedEntry{
+					Index: index,
+					Data:  proto.Clone(p).(*pb.Persistent),
+				},
+			},
+		})
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "could not load WAL for snapshot")
+	}
+
+	stateEvents = append(stateEvents, &pb.StateEvent{
+		Type: &pb.StateEvent_CompleteInitialization{
+			CompleteInitialization: &pb.StateEvent_LoadCompleted{},
+		},
+	})
+
+	return stateEvents, nil
+}
+
+// segmentWriter is the eventWriter for rotating recorders.
+type segmentWriter struct {
+	dir              string
+	nodeID           uint64
+	compressionLevel int
+	segmentSize      int64
+	segmentDuration  int64
+	retainSegments   int
+	rotation         *rotation
+	manifest         *Manifest
+
+	current  *ManifestSegment
+	file     *os.File
+	counter  *countingWriter
+	gzWriter *gzip.Writer
+
+	// rotationRequested indicates that the current segment is full, and
+	// the recorder has been asked to begin a new one.
+	rotationRequested bool
+}
+
+func (sw *segmentWriter) write(event *rpb.RecordedEvent) error {
+	if sw.gzWriter == nil {
+		if err := sw.openSegment(event.Time, nil); err != nil {
+			return err
+		}
+	}
+
+	if err := WriteRecordedEvent(sw.gzWriter, event); err != nil {
+		return err
+	}
+
+	sw.current.Events++
+
+	if !sw.rotationRequested && sw.full(event.Time) {
+		sw.rotationRequested = true
+		atomic.StoreInt32(&sw.rotation.due, 1)
+	}
+
+	return nil
+}
+
+func (sw *segmentWriter) full(time int64) bool {
+	return (sw.segmentSize > 0 && sw.counter.count >= sw.segmentSize) ||
+		(sw.segmentDuration > 0 && time-sw.current.StartTime >= sw.segmentDuration)
+}
+
+// rotate closes the current segment, and begins a new one with the given
+// snapshot.
+func (sw *segmentWriter) rotate(time int64, stateEvents []*pb.StateEvent) error {
+	snapshot := make([]*rpb.RecordedEvent, len(stateEvents))
+	for i, stateEvent := range stateEvents {
+		snapshot[i] = &rpb.RecordedEvent{
+			NodeId:     sw.nodeID,
+			Time:       time,
+			StateEvent: stateEvent,
+		}
+	}
+
+	if err := sw.closeSegment(); err != nil {
+		return err
+	}
+
+	if err := sw.openSegment(time, snapshot); err != nil {
+		return err
+	}
+
+	sw.rotationRequested = false
+
+	for sw.retainSegments > 0 && len(sw.manifest.Segments) > sw.retainSegments {
+		oldest := sw.manifest.Segments[0]
+		err := os.Remove(filepath.Join(sw.dir, oldest.File))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.WithMessagef(err, "could not remove segment %d", oldest.Number)
+		}
+		sw.manifest.Segments = sw.manifest.Segments[1:]
+	}
+
+	return sw.manifest.write(sw.dir)
+}
+
+func (sw *segmentWriter) openSegment(time int64, snapshot []*rpb.RecordedEvent) error {
+	number := uint64(0)
+	if len(sw.manifest.Segments) > 0 {
+		number = sw.manifest.Segments[len(sw.manifest.Segments)-1].Number + 1
+	}
+
+	segment := &ManifestSegment{
+		Number:         number,
+		File:           fmt.Sprintf("segment-%06d.gz", number),
+		SnapshotEvents: len(snapshot),
+		StartTime:      time,
+	}
+
+	file, err := os.OpenFile(filepath.Join(sw.dir, segment.File), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return errors.WithMessagef(err, "could not create segment %d", number)
+	}
+
+	counter := &countingWriter{dest: file}
+	gzWriter, err := gzip.NewWriterLevel(counter, sw.compressionLevel)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	sw.current = segment
+	sw.file = file
+	sw.counter = counter
+	sw.gzWriter = gzWriter
+	sw.manifest.Segments = append(sw.manifest.Segments, segment)
+
+	for _, event := range snapshot {
+		if err := WriteRecordedEvent(gzWriter, event); err != nil {
+			return errors.WithMessage(err, "could not write snapshot")
+		}
+	}
+
+	return sw.manifest.write(sw.dir)
+}
+
+func (sw *segmentWriter) closeSegment() error {
+	if err := sw.gzWriter.Close(); err != nil {
+		return errors.WithMessagef(err, "could not flush segment %d", sw.current.Number)
+	}
+
+	if err := sw.file.Close(); err != nil {
+		return errors.WithMessagef(err, "could not close segment %d", sw.current.Number)
+	}
+
+	sw.current.Complete = true
+	return nil
+}
+
+func (sw *segmentWriter) close() error {
+	if sw.gzWriter == nil {
+		return nil
+	}
+
+	if err := sw.closeSegment(); err != nil {
+		return err
+	}
+
+	return sw.manifest.write(sw.dir)
+}
+
+// ManifestReader reads the events from consecutive segments of a
+// rotating recorder as a single event log.  The snapshot events of the
+// first segment read are returned, but those of subsequent segments are
+// skipped, as the events of the previous segment already lead to the
+// same state.
+type ManifestReader struct {
+	dir      string
+	segments []*ManifestSegment
+
+	file   *os.File
+	reader *Reader
+}
+
+// NewManifestReader creates a reader for the events in the given segment
+// directory, beginning with the segment of the given number.
+func NewManifestReader(dir string, startSegment uint64) (*ManifestReader, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, segment := range manifest.Segments {
+		if segment.Number != startSegment {
+			continue
+		}
+
+		mr := &ManifestReader{
+			dir:      dir,
+			segments: manifest.Segments[i:],
+		}
+
+		if err := mr.openSegment(0); err != nil {
+			return nil, err
+		}
+
+		return mr, nil
+	}
+
+	return nil, errors.Errorf("segment %d is not in the manifest", startSegment)
+}
+
+func (mr *ManifestReader) openSegment(skip int) error {
+	segment := mr.segments[0]
+	file, err := os.Open(filepath.Join(mr.dir, segment.File))
+	if err != nil {
+		return errors.WithMessagef(err, "could not open segment %d", segment.Number)
+	}
+
+	reader, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return errors.WithMessagef(err, "could not read segment %d", segment.Number)
+	}
+
+	for i := 0; i < skip; i++ {
+		if _, err := reader.ReadEvent(); err != nil {
+			file.Close()
+			return errors.WithMessagef(err, "could not skip snapshot of segment %d", segment.Number)
+		}
+	}
+
+	mr.file = file
+	mr.reader = reader
+	return nil
+}
+
+// ReadEvent returns the next event, or io.EOF once every segment has been read.
+func (mr *ManifestReader) ReadEvent() (*rpb.RecordedEvent, error) {
+	for {
+		if mr.reader == nil {
+			return nil, io.EOF
+		}
+
+		event, err := mr.reader.ReadEvent()
+		if err != io.EOF {
+			return event, err
+		}
+
+		mr.file.Close()
+		mr.file = nil
+		mr.reader = nil
+		mr.segments = mr.segments[1:]
+		if len(mr.segments) == 0 {
+			continue
+		}
+
+		if err := mr.openSegment(mr.segments[0].SnapshotEvents); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Close releases the currently open segment, if any.
+func (mr *ManifestReader) Close() error {
+	if mr.file == nil {
+		return nil
+	}
+	return mr.file.Close()
+}
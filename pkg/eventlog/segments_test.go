@@ -0,0 +1,226 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package eventlog_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	"github.com/IBM/mirbft/pkg/eventlog"
+)
+
+type walSourceFunc func(forEach func(index uint64, p *pb.Persistent)) error
+
+func (wsf walSourceFunc) LoadAll(forEach func(index uint64, p *pb.Persistent)) error {
+	return wsf(forEach)
+}
+
+func loadEntryEvent(index uint64) *pb.StateEvent {
+	return &pb.StateEvent{
+		Type: &pb.StateEvent_LoadEntry{
+			LoadEntry: &pb.StateEvent_PersistedEntry{
+				Index: index,
+				Data: &pb.Persistent{
+					Type: &pb.Persistent_CEntry{
+						CEntry: &pb.CEntry{
+							SeqNo: index,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+var addResultsEvent = &pb.StateEvent{
+	Type: &pb.StateEvent_AddResults{
+		AddResults: &pb.StateEvent_ActionResults{},
+	},
+}
+
+var startupEvents = []*pb.StateEvent{
+	{
+		Type: &pb.StateEvent_Initialize{
+			Initialize: &pb.StateEvent_InitialParameters{
+				Id: 1,
+			},
+		},
+	},
+	loadEntryEvent(1),
+	loadEntryEvent(2),
+	{
+		Type: &pb.StateEvent_CompleteInitialization{
+			CompleteInitialization: &pb.StateEvent_LoadCompleted{},
+		},
+	},
+}
+
+var _ = Describe("RotatingRecorder", func() {
+	var (
+		dir      string
+		time     int64
+		walIndex uint64
+		opts     []eventlog.RecorderOpt
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "eventlog-segments")
+		Expect(err).NotTo(HaveOccurred())
+
+		time = 0
+		walIndex = 7
+		opts = []eventlog.RecorderOpt{
+			eventlog.TimeSourceOpt(func() int64 { return time }),
+			eventlog.RetainSegmentsOpt(2),
+			eventlog.WALSourceOpt(walSourceFunc(func(forEach func(index uint64, p *pb.Persistent)) error {
+				forEach(walIndex, loadEntryEvent(walIndex).GetLoadEntry().Data)
+				return nil
+			})),
+			// With an unbuffered recorder, each event has been written
+			// before the next but one is intercepted, so that the
+			// segments rotate deterministically.
+			eventlog.BufferSizeOpt(0),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	record := func(extraOpts ...eventlog.RecorderOpt) {
+		recorder, err := eventlog.NewRotatingRecorder(1, dir, append(opts, extraOpts...)...)
+		Expect(err).NotTo(HaveOccurred())
+		for _, event := range startupEvents {
+			Expect(recorder.Intercept(event)).To(Succeed())
+		}
+		for i := 0; i < 3; i++ {
+			time++
+			Expect(recorder.Intercept(tickEvent)).To(Succeed())
+			walIndex++
+			Expect(recorder.Intercept(addResultsEvent)).To(Succeed())
+		}
+		time++
+		Expect(recorder.Intercept(tickEvent)).To(Succeed())
+		Expect(recorder.Stop()).To(Succeed())
+	}
+
+	readAll := func(startSegment uint64) []*pb.StateEvent {
+		reader, err := eventlog.NewManifestReader(dir, startSegment)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		var result []*pb.StateEvent
+		for {
+			event, err := reader.ReadEvent()
+			if err == io.EOF {
+				return result
+			}
+			Expect(err).NotTo(HaveOccurred())
+			result = append(result, event.StateEvent)
+		}
+	}
+
+	When("the segment size is exceeded", func() {
+		BeforeEach(func() {
+			record(eventlog.SegmentSizeOpt(1))
+		})
+
+		It("rotates after results are added and retains the most recent segments", func() {
+			manifest, err := eventlog.ReadManifest(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manifest.NodeID).To(Equal(uint64(1)))
+			Expect(manifest.Segments).To(Equal([]*eventlog.ManifestSegment{
+				{
+					Number:         2,
+					File:           "segment-000002.gz",
+					SnapshotEvents: 3,
+					StartTime:      2,
+					Events:         2,
+					Complete:       true,
+				},
+				{
+					Number:         3,
+					File:           "segment-000003.gz",
+					SnapshotEvents: 3,
+					StartTime:      3,
+					Events:         1,
+					Complete:       true,
+				},
+			}))
+
+			files, err := filepath.Glob(filepath.Join(dir, "segment-*"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveLen(2))
+		})
+
+		It("replays from a snapshot of the WAL, skipping later snapshots", func() {
+			events := readAll(2)
+			Expect(events).To(HaveLen(6))
+			Expect(events[0].GetInitialize().Id).To(Equal(uint64(1)))
+			Expect(events[1].GetLoadEntry().Index).To(Equal(uint64(9)))
+			Expect(events[2].GetCompleteInitialization()).NotTo(BeNil())
+			Expect(events[3].GetTick()).NotTo(BeNil())
+			Expect(events[4].GetAddResults()).NotTo(BeNil())
+			Expect(events[5].GetTick()).NotTo(BeNil())
+		})
+
+		It("snapshots the WAL as it was when the preceding results were added", func() {
+			events := readAll(3)
+			Expect(events).To(HaveLen(4))
+			Expect(events[1].GetLoadEntry().Index).To(Equal(uint64(10)))
+		})
+
+		It("returns an error for segments which are not retained", func() {
+			_, err := eventlog.NewManifestReader(dir, 0)
+			Expect(err).To(MatchError("segment 0 is not in the manifest"))
+		})
+
+		It("appends to the manifest when restarted", func() {
+			record(eventlog.SegmentSizeOpt(1))
+			manifest, err := eventlog.ReadManifest(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manifest.Segments).To(HaveLen(2))
+			Expect(manifest.Segments[0].Number).To(Equal(uint64(6)))
+			Expect(readAll(6)).To(HaveLen(6))
+		})
+
+		It("refuses a directory belonging to another node", func() {
+			_, err := eventlog.NewRotatingRecorder(2, dir, opts...)
+			Expect(err).To(MatchError("segment directory contains segments for node 1"))
+		})
+	})
+
+	It("requires a WAL source", func() {
+		_, err := eventlog.NewRotatingRecorder(1, dir, eventlog.SegmentSizeOpt(1))
+		Expect(err).To(MatchError("rotating recorder requires a WAL source"))
+	})
+
+	When("the segment duration is exceeded", func() {
+		BeforeEach(func() {
+			record(eventlog.SegmentSizeOpt(0), eventlog.SegmentDurationOpt(2))
+		})
+
+		It("rotates once the duration elapses", func() {
+			manifest, err := eventlog.ReadManifest(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manifest.Segments).To(HaveLen(2))
+			Expect(manifest.Segments[0].Number).To(Equal(uint64(0)))
+			Expect(manifest.Segments[0].Events).To(Equal(uint64(8)))
+			Expect(manifest.Segments[1].StartTime).To(Equal(int64(2)))
+
+			events := readAll(0)
+			Expect(events).To(HaveLen(len(startupEvents) + 7))
+		})
+	})
+})
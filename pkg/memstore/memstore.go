@@ -0,0 +1,64 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package memstore provides in-memory implementations of the WAL, WALStorage,
+// and RequestStore interfaces required by mirbft.  They are intended for tests,
+// and in particular support injecting storage faults so that the recovery behavior
+// of a Node may be exercised without touching disk.  Neither store is durable in
+// any sense, so they should never be used outside of tests.
+package memstore
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ErrInjected is returned (possibly wrapped) by any operation which fails
+// because of a configured fault.
+var ErrInjected = errors.New("injected fault")
+
+// Faults configures the failures a store should exhibit.  The zero value
+// injects no faults.  Faults may be modified between operations, but not
+// concurrently with them.
+type Faults struct {
+	// FailWrite, if non-zero, causes the FailWrite-th write to the store (counting
+	// from one) to fail.  For the WAL, appends and truncations are writes, for the
+	// request store, puts and truncations are writes.  The failed write has no effect.
+	FailWrite int
+
+	// FailSync causes every Sync to fail.  The unsynced writes are retained, and
+	// may be made durable by a subsequent successful Sync.
+	FailSync bool
+
+	// LoseUnsynced causes Crash to discard every write made since the last
+	// successful Sync.
+	LoseUnsynced bool
+
+	// TornLastRecord causes Crash to truncate the final record in the WAL as
+	// though the process died partway through writing it.  It is applied after
+	// any unsynced writes are discarded.  It has no effect on the request store.
+	TornLastRecord bool
+}
+
+// faultCounter tracks the writes made to a store so that the configured
+// write fault may be triggered.
+type faultCounter struct {
+	writes int
+}
+
+func (fc *faultCounter) write(faults *Faults) error {
+	fc.writes++
+	if faults.FailWrite != 0 && fc.writes == faults.FailWrite {
+		return errors.WithMessagef(ErrInjected, "write %d failed", fc.writes)
+	}
+	return nil
+}
+
+func (fc *faultCounter) sync(faults *Faults) error {
+	if faults.FailSync {
+		return errors.WithMessage(ErrInjected, "sync failed")
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package memstore_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/IBM/mirbft"
+	pb "github.com/IBM/mirbft/mirbftpb"
+	"github.com/IBM/mirbft/pkg/memstore"
+)
+
+var (
+	_ mirbft.WAL          = &memstore.WAL{}
+	_ mirbft.WALStorage   = &memstore.WAL{}
+	_ mirbft.RequestStore = &memstore.RequestStore{}
+)
+
+func fEntry(seqNo uint64) *pb.Persistent {
+	return &pb.Persistent{
+		Type: &pb.Persistent_FEntry{
+			FEntry: &pb.FEntry{
+				EndsEpochConfig: &pb.EpochConfig{
+					Number: seqNo,
+				},
+			},
+		},
+	}
+}
+
+func loadIndices(wal *memstore.WAL) ([]uint64, error) {
+	var indices []uint64
+	err := wal.LoadAll(func(index uint64, p *pb.Persistent) {
+		indices = append(indices, index)
+	})
+	return indices, err
+}
+
+var _ = Describe("WAL", func() {
+	var (
+		wal *memstore.WAL
+	)
+
+	BeforeEach(func() {
+		wal = memstore.NewWAL()
+		for i := uint64(1); i <= 3; i++ {
+			Expect(wal.Write(i, fEntry(i))).To(Succeed())
+		}
+		Expect(wal.Sync()).To(Succeed())
+	})
+
+	It("loads what was written", func() {
+		var entries []*pb.Persistent
+		err := wal.LoadAll(func(index uint64, p *pb.Persistent) {
+			Expect(index).To(Equal(uint64(len(entries) + 1)))
+			entries = append(entries, p)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(3))
+		Expect(entries[2].Type.(*pb.Persistent_FEntry).FEntry.EndsEpochConfig.Number).To(Equal(uint64(3)))
+	})
+
+	It("rejects out of order writes", func() {
+		err := wal.Write(5, fEntry(5))
+		Expect(err).To(MatchError("out of order write, expected index 4, got 5"))
+	})
+
+	It("truncates", func() {
+		Expect(wal.Truncate(3)).To(Succeed())
+		Expect(loadIndices(wal)).To(Equal([]uint64{3}))
+		Expect(wal.Write(4, fEntry(4))).To(Succeed())
+		Expect(loadIndices(wal)).To(Equal([]uint64{3, 4}))
+	})
+
+	It("fails the configured write", func() {
+		wal.Faults.FailWrite = 5
+		Expect(wal.Write(4, fEntry(4))).To(Succeed())
+		err := wal.Write(5, fEntry(5))
+		Expect(err).To(MatchError("write 5 failed: injected fault"))
+		Expect(wal.Write(5, fEntry(5))).To(Succeed())
+		Expect(loadIndices(wal)).To(Equal([]uint64{1, 2, 3, 4, 5}))
+	})
+
+	It("fails syncs", func() {
+		wal.Faults.FailSync = true
+		Expect(wal.Sync()).To(MatchError("sync failed: injected fault"))
+	})
+
+	It("retains unsynced writes on crash by default", func() {
+		Expect(wal.Write(4, fEntry(4))).To(Succeed())
+		wal.Crash()
+		Expect(loadIndices(wal)).To(Equal([]uint64{1, 2, 3, 4}))
+	})
+
+	It("loses unsynced writes and truncations on crash", func() {
+		wal.Faults.LoseUnsynced = true
+		Expect(wal.Truncate(2)).To(Succeed())
+		Expect(wal.Write(4, fEntry(4))).To(Succeed())
+		wal.Crash()
+		Expect(loadIndices(wal)).To(Equal([]uint64{1, 2, 3}))
+	})
+
+	It("tears the last record on crash", func() {
+		wal.Faults.TornLastRecord = true
+		wal.Crash()
+		_, err := loadIndices(wal)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(HavePrefix("error decoding index 3 to proto, is the WAL corrupt?"))
+	})
+})
+
+var _ = Describe("RequestStore", func() {
+	var (
+		rs *memstore.RequestStore
+	)
+
+	ack := func(clientID, reqNo uint64) *pb.RequestAck {
+		return &pb.RequestAck{
+			ClientId: clientID,
+			ReqNo:    reqNo,
+			Digest:   []byte{byte(clientID), byte(reqNo)},
+		}
+	}
+
+	BeforeEach(func() {
+		rs = memstore.NewRequestStore()
+		for _, clientID := range []uint64{7, 3} {
+			for reqNo := uint64(0); reqNo < 4; reqNo++ {
+				a := ack(clientID, reqNo)
+				Expect(rs.PutAllocation(clientID, reqNo, a.Digest)).To(Succeed())
+				Expect(rs.PutRequest(a, []byte("data"))).To(Succeed())
+			}
+		}
+		Expect(rs.Sync()).To(Succeed())
+	})
+
+	It("iterates clients and allocations in order", func() {
+		var clients []uint64
+		Expect(rs.Clients(func(clientID uint64) {
+			clients = append(clients, clientID)
+		})).To(Succeed())
+		Expect(clients).To(Equal([]uint64{3, 7}))
+
+		var reqNos []uint64
+		Expect(rs.Allocations(3, 1, 3, func(reqNo uint64, digest []byte) {
+			Expect(digest).To(Equal(ack(3, reqNo).Digest))
+			reqNos = append(reqNos, reqNo)
+		})).To(Succeed())
+		Expect(reqNos).To(Equal([]uint64{1, 2}))
+	})
+
+	It("truncates below the low watermark", func() {
+		Expect(rs.Truncate(3, 2)).To(Succeed())
+		Expect(rs.GetAllocation(3, 1)).To(BeNil())
+		Expect(rs.GetRequest(ack(3, 1))).To(BeNil())
+		Expect(rs.GetAllocation(3, 2)).To(Equal(ack(3, 2).Digest))
+		Expect(rs.GetRequest(ack(7, 1))).To(Equal([]byte("data")))
+	})
+
+	It("fails the configured write", func() {
+		rs.Faults.FailWrite = 17
+		err := rs.PutAllocation(3, 4, []byte("digest"))
+		Expect(err).To(MatchError("write 17 failed: injected fault"))
+		Expect(rs.GetAllocation(3, 4)).To(BeNil())
+	})
+
+	It("loses unsynced writes on crash", func() {
+		rs.Faults.LoseUnsynced = true
+		Expect(rs.PutAllocation(3, 4, []byte("digest"))).To(Succeed())
+		Expect(rs.Truncate(7, 4)).To(Succeed())
+		rs.Crash()
+		Expect(rs.GetAllocation(3, 4)).To(BeNil())
+		Expect(rs.GetAllocation(7, 0)).To(Equal(ack(7, 0).Digest))
+	})
+})
+
+var _ = Describe("Node recovery", func() {
+	var (
+		wal    *memstore.WAL
+		config *mirbft.Config
+	)
+
+	BeforeEach(func() {
+		config = &mirbft.Config{
+			ID:                   0,
+			BatchSize:            1,
+			SuspectTicks:         4,
+			HeartbeatTicks:       2,
+			NewEpochTimeoutTicks: 8,
+			BufferSize:           5 * 1024 * 1024,
+			Logger:               mirbft.ConsoleWarnLogger,
+		}
+
+		node, err := mirbft.StartNewNode(config, mirbft.StandardInitialNetworkState(1, 1), []byte("fake-application-state"))
+		Expect(err).NotTo(HaveOccurred())
+		defer node.Stop()
+
+		// The serializer only delivers actions after processing its first event.
+		Expect(node.Tick()).To(Succeed())
+
+		wal = memstore.NewWAL()
+		var actions mirbft.Actions
+		Eventually(node.Ready()).Should(Receive(&actions))
+		Expect(actions.WriteAhead).NotTo(BeEmpty())
+		for _, write := range actions.WriteAhead {
+			Expect(write.Append).NotTo(BeNil())
+			Expect(wal.Write(write.Append.Index, write.Append.Data)).To(Succeed())
+		}
+		Expect(wal.Sync()).To(Succeed())
+	})
+
+	It("restarts from the WAL", func() {
+		wal.Crash()
+		node, err := mirbft.RestartNode(config, wal)
+		Expect(err).NotTo(HaveOccurred())
+		defer node.Stop()
+
+		status, err := node.Status(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.NodeID).To(Equal(uint64(0)))
+	})
+
+	When("the last WAL record is torn", func() {
+		BeforeEach(func() {
+			wal.Faults.TornLastRecord = true
+		})
+
+		It("exits with an error", func() {
+			wal.Crash()
+			node, err := mirbft.RestartNode(config, wal)
+			Expect(err).NotTo(HaveOccurred())
+			defer node.Stop()
+
+			Eventually(node.Err()).Should(BeClosed())
+			_, err = node.Status(context.Background())
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("failed to load persisted from WALStorage: error decoding index"))
+		})
+	})
+})
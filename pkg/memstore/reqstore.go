@@ -0,0 +1,249 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package memstore
+
+import (
+	"sort"
+	"sync"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+)
+
+type clientRecords struct {
+	allocations map[uint64][]byte
+	// requests is indexed by request number, then by digest.
+	requests map[uint64]map[string][]byte
+}
+
+type reqState map[uint64]*clientRecords
+
+func (rs reqState) client(clientID uint64) *clientRecords {
+	cr, ok := rs[clientID]
+	if !ok {
+		cr = &clientRecords{
+			allocations: map[uint64][]byte{},
+			requests:    map[uint64]map[string][]byte{},
+		}
+		rs[clientID] = cr
+	}
+	return cr
+}
+
+// clone copies the maps, but not the values, which are never modified in place.
+func (rs reqState) clone() reqState {
+	result := reqState{}
+	for clientID, cr := range rs {
+		crClone := result.client(clientID)
+		for reqNo, digest := range cr.allocations {
+			crClone.allocations[reqNo] = digest
+		}
+		for reqNo, reqs := range cr.requests {
+			reqsClone := make(map[string][]byte, len(reqs))
+			for digest, data := range reqs {
+				reqsClone[digest] = data
+			}
+			crClone.requests[reqNo] = reqsClone
+		}
+	}
+	return result
+}
+
+// RequestStore is an in-memory RequestStore.  Only the puts and truncations
+// made before the last successful Sync are guaranteed to survive a Crash.
+type RequestStore struct {
+	Faults Faults
+
+	mutex   sync.Mutex
+	counter faultCounter
+	current reqState
+	durable reqState
+}
+
+func NewRequestStore() *RequestStore {
+	return &RequestStore{
+		current: reqState{},
+		durable: reqState{},
+	}
+}
+
+func copyBytes(value []byte) []byte {
+	return append([]byte(nil), value...)
+}
+
+func (rs *RequestStore) PutAllocation(clientID, reqNo uint64, digest []byte) error {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if err := rs.counter.write(&rs.Faults); err != nil {
+		return err
+	}
+
+	rs.current.client(clientID).allocations[reqNo] = copyBytes(digest)
+	return nil
+}
+
+func (rs *RequestStore) GetAllocation(clientID, reqNo uint64) ([]byte, error) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	cr, ok := rs.current[clientID]
+	if !ok {
+		return nil, nil
+	}
+
+	digest, ok := cr.allocations[reqNo]
+	if !ok {
+		return nil, nil
+	}
+
+	return copyBytes(digest), nil
+}
+
+func (rs *RequestStore) PutRequest(requestAck *pb.RequestAck, data []byte) error {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if err := rs.counter.write(&rs.Faults); err != nil {
+		return err
+	}
+
+	cr := rs.current.client(requestAck.ClientId)
+	reqs, ok := cr.requests[requestAck.ReqNo]
+	if !ok {
+		reqs = map[string][]byte{}
+		cr.requests[requestAck.ReqNo] = reqs
+	}
+
+	reqs[string(requestAck.Digest)] = copyBytes(data)
+	return nil
+}
+
+func (rs *RequestStore) GetRequest(requestAck *pb.RequestAck) ([]byte, error) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	cr, ok := rs.current[requestAck.ClientId]
+	if !ok {
+		return nil, nil
+	}
+
+	data, ok := cr.requests[requestAck.ReqNo][string(requestAck.Digest)]
+	if !ok {
+		return nil, nil
+	}
+
+	return copyBytes(data), nil
+}
+
+// Truncate removes all allocations and requests for the given client whose
+// request number is strictly less than lowWatermark.
+func (rs *RequestStore) Truncate(clientID, lowWatermark uint64) error {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if err := rs.counter.write(&rs.Faults); err != nil {
+		return err
+	}
+
+	cr, ok := rs.current[clientID]
+	if !ok {
+		return nil
+	}
+
+	for reqNo := range cr.allocations {
+		if reqNo < lowWatermark {
+			delete(cr.allocations, reqNo)
+		}
+	}
+
+	for reqNo := range cr.requests {
+		if reqNo < lowWatermark {
+			delete(cr.requests, reqNo)
+		}
+	}
+
+	return nil
+}
+
+// Clients invokes forEach, in order, for each client ID which has at least one
+// allocation in the store.
+func (rs *RequestStore) Clients(forEach func(clientID uint64)) error {
+	rs.mutex.Lock()
+	var clientIDs []uint64
+	for clientID, cr := range rs.current {
+		if len(cr.allocations) != 0 {
+			clientIDs = append(clientIDs, clientID)
+		}
+	}
+	rs.mutex.Unlock()
+
+	sort.Slice(clientIDs, func(i, j int) bool {
+		return clientIDs[i] < clientIDs[j]
+	})
+
+	for _, clientID := range clientIDs {
+		forEach(clientID)
+	}
+
+	return nil
+}
+
+// Allocations invokes forEach, in request number order, for each allocation of the
+// given client with a request number in the range [startReqNo, endReqNo).
+func (rs *RequestStore) Allocations(clientID, startReqNo, endReqNo uint64, forEach func(reqNo uint64, digest []byte)) error {
+	type allocation struct {
+		reqNo  uint64
+		digest []byte
+	}
+
+	rs.mutex.Lock()
+	var allocations []allocation
+	if cr, ok := rs.current[clientID]; ok {
+		for reqNo, digest := range cr.allocations {
+			if reqNo >= startReqNo && reqNo < endReqNo {
+				allocations = append(allocations, allocation{
+					reqNo:  reqNo,
+					digest: copyBytes(digest),
+				})
+			}
+		}
+	}
+	rs.mutex.Unlock()
+
+	sort.Slice(allocations, func(i, j int) bool {
+		return allocations[i].reqNo < allocations[j].reqNo
+	})
+
+	for _, a := range allocations {
+		forEach(a.reqNo, a.digest)
+	}
+
+	return nil
+}
+
+func (rs *RequestStore) Sync() error {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if err := rs.counter.sync(&rs.Faults); err != nil {
+		return err
+	}
+
+	rs.durable = rs.current.clone()
+	return nil
+}
+
+// Crash simulates the process (or machine) failing and restarting, applying
+// the LoseUnsynced fault.  The store remains usable afterwards.
+func (rs *RequestStore) Crash() {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if rs.Faults.LoseUnsynced {
+		rs.current = rs.durable.clone()
+	}
+}
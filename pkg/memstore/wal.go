@@ -0,0 +1,146 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package memstore
+
+import (
+	"sync"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// WAL is an in-memory WAL.  Like a real WAL, entries are stored in their
+// serialized form, and only those written before the last successful Sync are
+// guaranteed to survive a Crash.
+type WAL struct {
+	Faults Faults
+
+	mutex   sync.Mutex
+	counter faultCounter
+
+	// lowIndex is the index of entries[0].
+	lowIndex uint64
+	entries  [][]byte
+
+	// durableLowIndex and durable are the state as of the last successful Sync.
+	durableLowIndex uint64
+	durable         [][]byte
+}
+
+func NewWAL() *WAL {
+	return &WAL{}
+}
+
+func (w *WAL) nextIndex() uint64 {
+	return w.lowIndex + uint64(len(w.entries))
+}
+
+func (w *WAL) IsEmpty() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return len(w.entries) == 0
+}
+
+func (w *WAL) LoadAll(forEach func(index uint64, p *pb.Persistent)) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for i, data := range w.entries {
+		index := w.lowIndex + uint64(i)
+		result := &pb.Persistent{}
+		err := proto.Unmarshal(data, result)
+		if err != nil {
+			return errors.WithMessagef(err, "error decoding index %d to proto, is the WAL corrupt?", index)
+		}
+
+		forEach(index, result)
+	}
+
+	return nil
+}
+
+func (w *WAL) Write(index uint64, p *pb.Persistent) error {
+	data, err := proto.Marshal(p)
+	if err != nil {
+		return errors.WithMessage(err, "could not marshal")
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.entries) != 0 && index != w.nextIndex() {
+		return errors.Errorf("out of order write, expected index %d, got %d", w.nextIndex(), index)
+	}
+
+	if err := w.counter.write(&w.Faults); err != nil {
+		return err
+	}
+
+	if len(w.entries) == 0 {
+		w.lowIndex = index
+	}
+
+	w.entries = append(w.entries, data)
+
+	return nil
+}
+
+// Truncate removes all entries with an index strictly less than the given index.
+func (w *WAL) Truncate(index uint64) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.entries) == 0 || index >= w.nextIndex() {
+		return errors.Errorf("truncation index %d out of range", index)
+	}
+
+	if err := w.counter.write(&w.Faults); err != nil {
+		return err
+	}
+
+	if index <= w.lowIndex {
+		return nil
+	}
+
+	w.entries = w.entries[index-w.lowIndex:]
+	w.lowIndex = index
+
+	return nil
+}
+
+func (w *WAL) Sync() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.counter.sync(&w.Faults); err != nil {
+		return err
+	}
+
+	w.durableLowIndex = w.lowIndex
+	w.durable = append([][]byte(nil), w.entries...)
+
+	return nil
+}
+
+// Crash simulates the process (or machine) failing and restarting, applying
+// the LoseUnsynced and TornLastRecord faults.  The WAL remains usable afterwards.
+func (w *WAL) Crash() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.Faults.LoseUnsynced {
+		w.lowIndex = w.durableLowIndex
+		w.entries = append([][]byte(nil), w.durable...)
+	}
+
+	if w.Faults.TornLastRecord && len(w.entries) != 0 {
+		last := w.entries[len(w.entries)-1]
+		w.entries[len(w.entries)-1] = last[:len(last)/2]
+	}
+}
@@ -11,18 +11,53 @@ SPDX-License-Identifier: Apache-2.0
 package reqstore
 
 import (
-	"fmt"
+	"encoding/binary"
+	"math"
+
 	pb "github.com/IBM/mirbft/mirbftpb"
 	badger "github.com/dgraph-io/badger/v2"
 	"github.com/pkg/errors"
 )
 
+// Keys are encoded so that their byte order matches the numeric order of their
+// components.  Each key begins with a one byte prefix indicating the type of
+// record, followed by the big-endian client ID, followed by the big-endian
+// request number.  Request keys additionally have the request digest appended.
+// Because of this, all records for a given client are contiguous, and are sorted
+// by request number, which allows for efficient range deletion.  The prefixes
+// are deliberately not printable characters so that they may never collide with
+// the keys of the legacy string layout (see schema.go).
+const (
+	metaPrefix  byte = 0x00
+	allocPrefix byte = 0x01
+	reqPrefix   byte = 0x02
+)
+
+func clientPrefix(prefix byte, clientID uint64) []byte {
+	key := make([]byte, 9, 17)
+	key[0] = prefix
+	binary.BigEndian.PutUint64(key[1:], clientID)
+	return key
+}
+
+func reqNoKey(prefix byte, clientID, reqNo uint64) []byte {
+	key := clientPrefix(prefix, clientID)
+	key = key[:17]
+	binary.BigEndian.PutUint64(key[9:], reqNo)
+	return key
+}
+
 func reqKey(ack *pb.RequestAck) []byte {
-	return []byte(fmt.Sprintf("req-%d.%d.%x", ack.ClientId, ack.ReqNo, ack.Digest))
+	return append(reqNoKey(reqPrefix, ack.ClientId, ack.ReqNo), ack.Digest...)
 }
 
 func allocKey(clientID, reqNo uint64) []byte {
-	return []byte(fmt.Sprintf("alloc-%d.%d", clientID, reqNo))
+	return reqNoKey(allocPrefix, clientID, reqNo)
+}
+
+// keyReqNo extracts the request number from an encoded alloc or req key.
+func keyReqNo(key []byte) uint64 {
+	return binary.BigEndian.Uint64(key[9:17])
 }
 
 type Store struct {
@@ -42,6 +77,11 @@ func Open(dirPath string) (*Store, error) {
 		return nil, errors.WithMessage(err, "could not open backing db")
 	}
 
+	if err := upgradeSchema(db); err != nil {
+		db.Close()
+		return nil, errors.WithMessage(err, "could not upgrade db schema")
+	}
+
 	return &Store{
 		db: db,
 	}, nil
@@ -97,12 +137,132 @@ func (s *Store) GetRequest(requestAck *pb.RequestAck) ([]byte, error) {
 	return valCopy, err
 }
 
+// Clients invokes forEach, in order, for each client ID which has at least one
+// allocation in the store.
+func (s *Store) Clients(forEach func(clientID uint64)) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{
+			Prefix: []byte{allocPrefix},
+		})
+		defer it.Close()
+
+		it.Rewind()
+		for it.Valid() {
+			clientID := binary.BigEndian.Uint64(it.Item().Key()[1:9])
+			forEach(clientID)
+			if clientID == math.MaxUint64 {
+				break
+			}
+			it.Seek(clientPrefix(allocPrefix, clientID+1))
+		}
+
+		return nil
+	})
+}
+
+// Allocations invokes forEach, in request number order, for each allocation of the
+// given client with a request number in the range [startReqNo, endReqNo).
+func (s *Store) Allocations(clientID, startReqNo, endReqNo uint64, forEach func(reqNo uint64, digest []byte)) error {
+	return s.iterate(allocPrefix, clientID, startReqNo, endReqNo, func(key, value []byte) {
+		forEach(keyReqNo(key), value)
+	})
+}
+
+// Requests invokes forEach, in request number order, for each request of the given
+// client with a request number in the range [startReqNo, endReqNo).  Note that there
+// may be more than one request stored for a particular request number, in which case
+// they are ordered by digest.
+func (s *Store) Requests(clientID, startReqNo, endReqNo uint64, forEach func(ack *pb.RequestAck, data []byte)) error {
+	return s.iterate(reqPrefix, clientID, startReqNo, endReqNo, func(key, value []byte) {
+		forEach(&pb.RequestAck{
+			ClientId: clientID,
+			ReqNo:    keyReqNo(key),
+			Digest:   key[17:],
+		}, value)
+	})
+}
+
+// iterate invokes forEach with a copy of the key and value for each record of the
+// given type belonging to the client, with a request number in [startReqNo, endReqNo).
+func (s *Store) iterate(prefix byte, clientID, startReqNo, endReqNo uint64, forEach func(key, value []byte)) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{
+			PrefetchValues: true,
+			PrefetchSize:   100,
+			Prefix:         clientPrefix(prefix, clientID),
+		})
+		defer it.Close()
+
+		for it.Seek(reqNoKey(prefix, clientID, startReqNo)); it.Valid(); it.Next() {
+			item := it.Item()
+			if keyReqNo(item.Key()) >= endReqNo {
+				break
+			}
+
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return errors.WithMessagef(err, "could not read value for client %d", clientID)
+			}
+
+			forEach(item.KeyCopy(nil), value)
+		}
+
+		return nil
+	})
+}
+
 func (s *Store) Commit(ack *pb.RequestAck) error {
 	return s.db.Update(func(txn *badger.Txn) error {
 		return txn.Delete(reqKey(ack))
 	})
 }
 
+// Truncate removes all allocations and requests for the given client whose
+// request number is strictly less than lowWatermark.  It is intended to be
+// invoked once a checkpoint becomes stable, with the client low watermarks
+// from the checkpoint's network state.  Because the deletion is over a range,
+// any records skipped by a previous (perhaps interrupted) truncation are also
+// removed.
+func (s *Store) Truncate(clientID, lowWatermark uint64) error {
+	var keys [][]byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		for _, prefix := range []byte{allocPrefix, reqPrefix} {
+			it := txn.NewIterator(badger.IteratorOptions{
+				Prefix: clientPrefix(prefix, clientID),
+			})
+
+			for it.Rewind(); it.Valid(); it.Next() {
+				key := it.Item().Key()
+				if keyReqNo(key) >= lowWatermark {
+					break
+				}
+				keys = append(keys, it.Item().KeyCopy(nil))
+			}
+
+			it.Close()
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessagef(err, "could not iterate keys for client %d", clientID)
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, key := range keys {
+		if err := wb.Delete(key); err != nil {
+			return errors.WithMessagef(err, "could not delete keys for client %d", clientID)
+		}
+	}
+
+	return wb.Flush()
+}
+
 func (s *Store) Sync() error {
 	return s.db.Sync()
 }
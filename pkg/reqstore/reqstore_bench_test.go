@@ -0,0 +1,147 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package reqstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+// The legacy key functions are retained here only to compare against.
+func legacyReqKey(ack *pb.RequestAck) []byte {
+	return []byte(fmt.Sprintf("req-%d.%d.%x", ack.ClientId, ack.ReqNo, ack.Digest))
+}
+
+func legacyAllocKey(clientID, reqNo uint64) []byte {
+	return []byte(fmt.Sprintf("alloc-%d.%d", clientID, reqNo))
+}
+
+var benchDigest = []byte("0123456789abcdef0123456789abcdef")
+
+func BenchmarkReqKey(b *testing.B) {
+	ack := &pb.RequestAck{ClientId: 17, ReqNo: 123456, Digest: benchDigest}
+	for i := 0; i < b.N; i++ {
+		reqKey(ack)
+	}
+}
+
+func BenchmarkLegacyReqKey(b *testing.B) {
+	ack := &pb.RequestAck{ClientId: 17, ReqNo: 123456, Digest: benchDigest}
+	for i := 0; i < b.N; i++ {
+		legacyReqKey(ack)
+	}
+}
+
+func BenchmarkAllocKey(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		allocKey(17, uint64(i))
+	}
+}
+
+func BenchmarkLegacyAllocKey(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		legacyAllocKey(17, uint64(i))
+	}
+}
+
+// benchmarkPutGet measures a put followed by a get of an allocation and a request
+// against a fresh on-disk badger instance using the supplied key functions.
+func benchmarkPutGet(b *testing.B, allocKey func(uint64, uint64) []byte, reqKey func(*pb.RequestAck) []byte) {
+	tmpDir, err := ioutil.TempDir("", "reqstore-bench-*")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	db, err := badger.Open(badger.DefaultOptions(tmpDir).WithSyncWrites(false).WithLogger(nil))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	data := make([]byte, 256)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ack := &pb.RequestAck{
+			ClientId: uint64(i % 16),
+			ReqNo:    uint64(i / 16),
+			Digest:   benchDigest,
+		}
+
+		err := db.Update(func(txn *badger.Txn) error {
+			if err := txn.Set(allocKey(ack.ClientId, ack.ReqNo), ack.Digest); err != nil {
+				return err
+			}
+			return txn.Set(reqKey(ack), data)
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		err = db.View(func(txn *badger.Txn) error {
+			if _, err := txn.Get(allocKey(ack.ClientId, ack.ReqNo)); err != nil {
+				return err
+			}
+			_, err := txn.Get(reqKey(ack))
+			return err
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPutGet(b *testing.B) {
+	benchmarkPutGet(b, allocKey, reqKey)
+}
+
+func BenchmarkLegacyPutGet(b *testing.B) {
+	benchmarkPutGet(b, legacyAllocKey, legacyReqKey)
+}
+
+func BenchmarkStorePutGet(b *testing.B) {
+	tmpDir, err := ioutil.TempDir("", "reqstore-bench-*")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	s, err := Open(tmpDir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer s.Close()
+
+	data := make([]byte, 256)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ack := &pb.RequestAck{
+			ClientId: uint64(i % 16),
+			ReqNo:    uint64(i / 16),
+			Digest:   benchDigest,
+		}
+
+		if err := s.PutAllocation(ack.ClientId, ack.ReqNo, ack.Digest); err != nil {
+			b.Fatal(err)
+		}
+
+		if err := s.PutRequest(ack, data); err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := s.GetRequest(ack); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,12 +1,17 @@
 package reqstore_test
 
 import (
+	"encoding/binary"
 	"io/ioutil"
+	"math"
 	"os"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	badger "github.com/dgraph-io/badger/v2"
+	"google.golang.org/protobuf/proto"
+
 	pb "github.com/IBM/mirbft/mirbftpb"
 	"github.com/IBM/mirbft/pkg/reqstore"
 )
@@ -84,7 +89,204 @@ var _ = Describe("Reqstore", func() {
 	})
 
 	It("returns all uncommitted txes", func() {
-		_ = reqStore
-		// XXX need to actually test this
+		var acks []*pb.RequestAck
+		var datas []string
+		for _, clientID := range []uint64{1, 2} {
+			err := reqStore.Requests(clientID, 0, math.MaxUint64, func(ack *pb.RequestAck, data []byte) {
+				acks = append(acks, ack)
+				datas = append(datas, string(data))
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Expect(acks).To(HaveLen(3))
+		Expect(proto.Equal(acks[0], ack1dot3)).To(BeTrue())
+		Expect(proto.Equal(acks[1], ack2dot1)).To(BeTrue())
+		Expect(proto.Equal(acks[2], ack2dot2)).To(BeTrue())
+		Expect(datas).To(Equal([]string{"data1dot3", "data2dot1", "data2dot2"}))
+	})
+
+	It("iterates requests within a request number range", func() {
+		var reqNos []uint64
+		err := reqStore.Requests(2, 1, 2, func(ack *pb.RequestAck, data []byte) {
+			reqNos = append(reqNos, ack.ReqNo)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reqNos).To(Equal([]uint64{1}))
+	})
+
+	When("there are allocations", func() {
+		BeforeEach(func() {
+			for _, ack := range []*pb.RequestAck{ack1dot2, ack1dot3, ack2dot1} {
+				err := reqStore.PutAllocation(ack.ClientId, ack.ReqNo, ack.Digest)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			err := reqStore.PutAllocation(10, 7, []byte("digest10"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("iterates the clients in numeric order", func() {
+			var clientIDs []uint64
+			err := reqStore.Clients(func(clientID uint64) {
+				clientIDs = append(clientIDs, clientID)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(clientIDs).To(Equal([]uint64{1, 2, 10}))
+		})
+
+		It("iterates the allocations for a client", func() {
+			var reqNos []uint64
+			err := reqStore.Allocations(1, 0, math.MaxUint64, func(reqNo uint64, digest []byte) {
+				reqNos = append(reqNos, reqNo)
+				Expect(digest).To(Equal([]byte("digest1")))
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reqNos).To(Equal([]uint64{2, 3}))
+		})
+	})
+
+	When("a client is truncated", func() {
+		BeforeEach(func() {
+			for _, ack := range []*pb.RequestAck{ack1dot1, ack1dot2, ack1dot3, ack2dot1, ack2dot2} {
+				err := reqStore.PutAllocation(ack.ClientId, ack.ReqNo, ack.Digest)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			err := reqStore.Truncate(1, 3)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("removes the requests and allocations below the low watermark", func() {
+			data, err := reqStore.GetRequest(ack1dot2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(BeNil())
+
+			digest, err := reqStore.GetAllocation(1, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(digest).To(BeNil())
+
+			digest, err = reqStore.GetAllocation(1, 2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(digest).To(BeNil())
+		})
+
+		It("retains the requests and allocations at or above the low watermark", func() {
+			data, err := reqStore.GetRequest(ack1dot3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(Equal([]byte("data1dot3")))
+
+			digest, err := reqStore.GetAllocation(1, 3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(digest).To(Equal(ack1dot3.Digest))
+		})
+
+		It("does not affect other clients", func() {
+			data, err := reqStore.GetRequest(ack2dot1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(Equal([]byte("data2dot1")))
+
+			digest, err := reqStore.GetAllocation(2, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(digest).To(Equal(ack2dot1.Digest))
+		})
+	})
+})
+
+var _ = Describe("Schema", func() {
+	var (
+		tmpDir string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "reqstore-schema-test-*")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	writeRaw := func(kvs map[string][]byte) {
+		db, err := badger.Open(badger.DefaultOptions(tmpDir).WithLogger(nil))
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+
+		err = db.Update(func(txn *badger.Txn) error {
+			for key, value := range kvs {
+				if err := txn.Set([]byte(key), value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	When("the db was written with the legacy string layout", func() {
+		BeforeEach(func() {
+			writeRaw(map[string][]byte{
+				"req-9.1.6469676573743139":  []byte("data9dot1"),
+				"req-10.1.6469676573743130": []byte("data10dot1"),
+				"req-10.2.6469676573743130": []byte("data10dot2"),
+				"alloc-9.1":                 []byte("digest19"),
+				"alloc-10.1":                []byte("digest10"),
+			})
+		})
+
+		It("migrates the keys in place when opened", func() {
+			reqStore, err := reqstore.Open(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			defer reqStore.Close()
+
+			data, err := reqStore.GetRequest(&pb.RequestAck{
+				ClientId: 10,
+				ReqNo:    2,
+				Digest:   []byte("digest10"),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(Equal([]byte("data10dot2")))
+
+			digest, err := reqStore.GetAllocation(9, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(digest).To(Equal([]byte("digest19")))
+
+			var clientIDs []uint64
+			err = reqStore.Clients(func(clientID uint64) {
+				clientIDs = append(clientIDs, clientID)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(clientIDs).To(Equal([]uint64{9, 10}))
+		})
+
+		It("can be reopened after migrating", func() {
+			reqStore, err := reqstore.Open(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			reqStore.Close()
+
+			reqStore, err = reqstore.Open(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			defer reqStore.Close()
+
+			digest, err := reqStore.GetAllocation(10, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(digest).To(Equal([]byte("digest10")))
+		})
+	})
+
+	When("the db schema is newer than supported", func() {
+		BeforeEach(func() {
+			version := make([]byte, 8)
+			binary.BigEndian.PutUint64(version, reqstore.SchemaVersion+1)
+			writeRaw(map[string][]byte{
+				"\x00v": version,
+			})
+		})
+
+		It("refuses to open it", func() {
+			_, err := reqstore.Open(tmpDir)
+			Expect(err).To(MatchError("could not upgrade db schema: db schema version 2 is newer than the supported version 1"))
+		})
 	})
 })
@@ -0,0 +1,211 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package reqstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	badger "github.com/dgraph-io/badger/v2"
+	"github.com/pkg/errors"
+)
+
+// SchemaVersion is the version of the key layout written by this package.
+// Version 0 is the original layout, which encoded keys as strings of the form
+// 'req-<clientID>.<reqNo>.<hex digest>' and 'alloc-<clientID>.<reqNo>', and which
+// did not record a version.  Version 1 is the binary layout described in reqstore.go.
+const SchemaVersion uint64 = 1
+
+// migrationBatchSize is the number of legacy records rewritten per write batch.
+const migrationBatchSize = 1000
+
+var (
+	versionKey        = []byte{metaPrefix, 'v'}
+	legacyReqPrefix   = []byte("req-")
+	legacyAllocPrefix = []byte("alloc-")
+)
+
+func readSchemaVersion(db *badger.DB) (version uint64, found bool, err error) {
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(versionKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			if len(val) != 8 {
+				return errors.Errorf("schema version record has unexpected length %d", len(val))
+			}
+			version = binary.BigEndian.Uint64(val)
+			found = true
+			return nil
+		})
+	})
+
+	return version, found, err
+}
+
+func writeSchemaVersion(db *badger.DB, version uint64) error {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, version)
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.Set(versionKey, value)
+	})
+}
+
+// upgradeSchema checks the schema version of the db, and if it predates the
+// current version, migrates it in place.  The migration is idempotent, and the
+// version record is written only once it completes, so if the migration is
+// interrupted, it simply resumes on the next open.
+func upgradeSchema(db *badger.DB) error {
+	version, found, err := readSchemaVersion(db)
+	if err != nil {
+		return errors.WithMessage(err, "could not read schema version")
+	}
+
+	switch {
+	case found && version == SchemaVersion:
+		return nil
+	case found && version > SchemaVersion:
+		return errors.Errorf("db schema version %d is newer than the supported version %d", version, SchemaVersion)
+	case !found:
+		// Either a new db, or one written in the legacy string layout.
+		if err := migrateLegacyKeys(db); err != nil {
+			return errors.WithMessage(err, "could not migrate legacy keys")
+		}
+	}
+
+	return writeSchemaVersion(db, SchemaVersion)
+}
+
+// migrateLegacyKeys rewrites all keys in the version 0 string layout into the
+// binary layout.
+func migrateLegacyKeys(db *badger.DB) error {
+	for _, prefix := range [][]byte{legacyReqPrefix, legacyAllocPrefix} {
+		for {
+			migrated, err := migrateLegacyBatch(db, prefix)
+			if err != nil {
+				return err
+			}
+
+			if migrated < migrationBatchSize {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// migrateLegacyBatch rewrites up to migrationBatchSize keys with the given legacy
+// prefix, returning the number of keys rewritten.
+func migrateLegacyBatch(db *badger.DB, prefix []byte) (int, error) {
+	count := 0
+	err := db.Update(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{
+			PrefetchValues: true,
+			PrefetchSize:   100,
+			Prefix:         prefix,
+		})
+		defer it.Close()
+
+		type rewrite struct {
+			oldKey, newKey, value []byte
+		}
+
+		var rewrites []rewrite
+
+		for it.Rewind(); it.Valid() && len(rewrites) < migrationBatchSize; it.Next() {
+			item := it.Item()
+			oldKey := item.KeyCopy(nil)
+			newKey, err := legacyToBinaryKey(oldKey)
+			if err != nil {
+				return err
+			}
+
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return errors.WithMessagef(err, "could not read value for key '%s'", oldKey)
+			}
+
+			rewrites = append(rewrites, rewrite{
+				oldKey: oldKey,
+				newKey: newKey,
+				value:  value,
+			})
+		}
+
+		// The iterator must be closed before the txn is mutated.
+		it.Close()
+
+		for _, r := range rewrites {
+			if err := txn.Set(r.newKey, r.value); err != nil {
+				return err
+			}
+
+			if err := txn.Delete(r.oldKey); err != nil {
+				return err
+			}
+		}
+
+		count = len(rewrites)
+		return nil
+	})
+
+	return count, err
+}
+
+// legacyToBinaryKey parses a version 0 key and returns its version 1 equivalent.
+func legacyToBinaryKey(key []byte) ([]byte, error) {
+	var fields []string
+	switch {
+	case bytes.HasPrefix(key, legacyReqPrefix):
+		fields = strings.Split(string(key[len(legacyReqPrefix):]), ".")
+		if len(fields) != 3 {
+			return nil, errors.Errorf("malformed legacy request key '%s'", key)
+		}
+	case bytes.HasPrefix(key, legacyAllocPrefix):
+		fields = strings.Split(string(key[len(legacyAllocPrefix):]), ".")
+		if len(fields) != 2 {
+			return nil, errors.Errorf("malformed legacy allocation key '%s'", key)
+		}
+	default:
+		return nil, errors.Errorf("unknown legacy key '%s'", key)
+	}
+
+	clientID, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "malformed client ID in legacy key '%s'", key)
+	}
+
+	reqNo, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "malformed req no in legacy key '%s'", key)
+	}
+
+	if len(fields) == 2 {
+		return allocKey(clientID, reqNo), nil
+	}
+
+	digest, err := hex.DecodeString(fields[2])
+	if err != nil {
+		return nil, errors.WithMessagef(err, "malformed digest in legacy key '%s'", key)
+	}
+
+	return reqKey(&pb.RequestAck{
+		ClientId: clientID,
+		ReqNo:    reqNo,
+		Digest:   digest,
+	}), nil
+}
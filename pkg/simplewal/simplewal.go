@@ -100,6 +100,15 @@ func (w *WAL) Truncate(index uint64) error {
 	return w.log.TruncateFront(index)
 }
 
+// TruncateBack removes all entries with an index greater than the given index.
+// It is never invoked in the course of normal operation, but may be used to
+// repair a WAL whose tail is corrupt.
+func (w *WAL) TruncateBack(index uint64) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.log.TruncateBack(index)
+}
+
 func (w *WAL) Sync() error {
 	return w.log.Sync()
 }
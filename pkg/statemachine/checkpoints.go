@@ -286,7 +286,7 @@ func (cw *checkpoint) applyCheckpointMsg(source nodeID, value []byte) {
 
 	// If I have completed this checkpoint, along with a quorum of the network, and I've not already run this path
 	if cw.myValue != nil && cw.committedValue != nil && !cw.stable {
-		if !bytes.Equal(value, cw.committedValue) {
+		if !bytes.Equal(cw.myValue, cw.committedValue) {
 			// TODO optionally handle this more gracefully, with state transfer (though this
 			// indicates a violation of the byzantine assumptions)
 			panic("my checkpoint disagrees with the committed network view of this checkpoint")
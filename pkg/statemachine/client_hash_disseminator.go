@@ -716,12 +716,13 @@ func (c *client) reinitialize(seqNo uint64, networkConfig *pb.NetworkState_Confi
 	actions := &actionSet{}
 	oldReqNoMap := c.reqNoMap
 
-	intermediateHighWatermark := clientState.LowWatermark + uint64(clientState.Width) - uint64(clientState.WidthConsumedLastCheckpoint)
+	// The watermarks are inclusive, so the window holds exactly Width requests
+	intermediateHighWatermark := clientState.LowWatermark + uint64(clientState.Width) - uint64(clientState.WidthConsumedLastCheckpoint) - 1
 
 	c.networkConfig = networkConfig
 	c.clientState = clientState
 	if !reconfiguring {
-		c.highWatermark = clientState.LowWatermark + uint64(clientState.Width)
+		c.highWatermark = clientState.LowWatermark + uint64(clientState.Width) - 1
 	} else {
 		c.highWatermark = intermediateHighWatermark
 	}
@@ -765,11 +766,11 @@ func (c *client) reinitialize(seqNo uint64, networkConfig *pb.NetworkState_Confi
 func (c *client) allocate(seqNo uint64, state *pb.NetworkState_Client, reconfiguring bool) *actionSet {
 	actions := &actionSet{}
 
-	intermediateHighWatermark := state.LowWatermark + uint64(state.Width) - uint64(state.WidthConsumedLastCheckpoint)
+	intermediateHighWatermark := state.LowWatermark + uint64(state.Width) - uint64(state.WidthConsumedLastCheckpoint) - 1
 	assertEqualf(intermediateHighWatermark, c.highWatermark, "new intermediate high watermark should always be the old high watemark, in the allocation path", state.Id)
 	var newHighWatermark uint64
 	if !reconfiguring {
-		newHighWatermark = state.LowWatermark + uint64(state.Width)
+		newHighWatermark = state.LowWatermark + uint64(state.Width) - 1
 	} else {
 		newHighWatermark = intermediateHighWatermark
 	}
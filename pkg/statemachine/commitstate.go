@@ -342,7 +342,7 @@ func (cc *committingClient) createCheckpointState() (newState *pb.NetworkState_C
 		highWatermark := cc.lastState.LowWatermark + uint64(cc.lastState.Width) - uint64(cc.lastState.WidthConsumedLastCheckpoint) - 1
 		assertEqual(*lastCommitted, highWatermark, "if no client reqs are uncommitted, then all though the high watermark should be committed")
 
-		cc.committedSinceLastCheckpoint = []*uint64{}
+		cc.committedSinceLastCheckpoint = make([]*uint64, int(cc.lastState.Width))
 		return &pb.NetworkState_Client{
 			Id:                          cc.lastState.Id,
 			Width:                       cc.lastState.Width,
@@ -54,6 +54,7 @@ type epochTarget struct {
 	leaderNewEpoch  *pb.NewEpoch       // The NewEpoch msg we received directly from the leader
 	networkNewEpoch *pb.NewEpochConfig // The NewEpoch msg as received via the bracha broadcast
 	isLeader        bool
+	graceful        bool // Set when the epoch reaches its planned expiration
 	prestartBuffers map[nodeID]*msgBuffer
 
 	persisted              *persisted
@@ -358,9 +359,13 @@ func (et *epochTarget) tick() *actionSet {
 	if et.state == etPrepending {
 		// Waiting for a quorum of epoch changes
 		return et.tickPrepending()
-	} else if et.state <= etResuming {
+	} else if et.state < etResuming {
 		// Waiting for the new epoch config
 		return et.tickPending()
+	} else if et.state == etResuming {
+		// Waiting for our commits to catch up, we have no epoch change
+		// to rebroadcast, and already suspected the epoch on restart
+		return &actionSet{}
 	} else if et.state <= etInProgress {
 		// Active in the epoch
 		return et.activeEpoch.tick()
@@ -716,7 +721,15 @@ func (et *epochTarget) advanceState() *actionSet {
 		case etResuming: // We crashed during this epoch, and are waiting for it to resume or fail
 			et.checkEpochResumed()
 		case etReady: // New epoch is ready to begin
-			// TODO, handle case where planned epoch expiration is now
+			if et.commitState.lowWatermark >= et.networkNewEpoch.Config.PlannedExpiration {
+				// We crashed after computing the checkpoint at the planned
+				// expiration, but before the epoch ended, there is nothing
+				// left for this epoch to do.
+				et.logger.Log(LevelDebug, "epoch transitioning from ready to done, planned expiration already reached", "epoch_no", et.number)
+				actions.concat(et.end(et.networkNewEpoch.Config))
+				break
+			}
+
 			et.activeEpoch = newActiveEpoch(et.networkNewEpoch.Config, et.persisted, et.nodeBuffers, et.commitState, et.clientTracker, et.myConfig, et.logger)
 
 			actions.concat(et.activeEpoch.advance())
@@ -756,12 +769,22 @@ func (et *epochTarget) moveLowWatermark(seqNo uint64) *actionSet {
 	actions, done := et.activeEpoch.moveLowWatermark(seqNo)
 	if done {
 		et.logger.Log(LevelDebug, "epoch gracefully transitioning from in progress to done", "epoch_no", et.number)
-		et.state = etDone
+		actions.concat(et.end(et.activeEpoch.epochConfig))
 	}
 
 	return actions
 }
 
+// end gracefully ends the epoch, recording in the log that the epoch ended so
+// that, should we crash, we do not attempt to resume it.
+func (et *epochTarget) end(epochConfig *pb.EpochConfig) *actionSet {
+	et.state = etDone
+	et.graceful = true
+	return et.persisted.addFEntry(&pb.FEntry{
+		EndsEpochConfig: epochConfig,
+	})
+}
+
 func (et *epochTarget) applySuspectMsg(source nodeID) {
 	et.suspicions[source] = struct{}{}
 
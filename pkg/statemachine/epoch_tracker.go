@@ -230,6 +230,7 @@ func (et *epochTracker) advanceState() *actionSet {
 		return &actionSet{}
 	}
 
+	graceful := et.currentEpoch.graceful
 	newEpochNumber := et.currentEpoch.number + 1
 	if et.maxCorrectEpoch > newEpochNumber {
 		newEpochNumber = et.maxCorrectEpoch
@@ -252,7 +253,13 @@ func (et *epochTracker) advanceState() *actionSet {
 		et.logger,
 	)
 	et.currentEpoch.myEpochChange = myEpochChange
-	et.currentEpoch.myLeaderChoice = []uint64{et.myConfig.Id} // XXX, wrong
+	if graceful {
+		// The previous epoch ended as planned, so rotate the buckets
+		// among all of the nodes.
+		et.currentEpoch.myLeaderChoice = et.networkConfig.Nodes
+	} else {
+		et.currentEpoch.myLeaderChoice = []uint64{et.myConfig.Id} // XXX, wrong
+	}
 
 	actions := et.persisted.addECEntry(&pb.ECEntry{
 		EpochNumber: newEpochNumber,
@@ -87,6 +87,19 @@ var _ = Describe("Mirbft", func() {
 			_, err := recording.DrainClients(50000)
 			Expect(err).NotTo(HaveOccurred())
 		})
+
+		When("the clients send more requests than fit in their windows", func() {
+			BeforeEach(func() {
+				for _, clientConfig := range recorder.ClientConfigs {
+					clientConfig.Total = 250
+				}
+			})
+
+			It("still delivers all requests", func() {
+				_, err := recording.DrainClients(50000)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
 	})
 
 	When("the network has just one client", func() {
@@ -125,6 +138,47 @@ var _ = Describe("Mirbft", func() {
 		})
 	})
 
+	When("each epoch is planned to last a single checkpoint interval", func() {
+		BeforeEach(func() {
+			recorder.NetworkState.Config.MaxEpochLength = uint64(recorder.NetworkState.Config.CheckpointInterval)
+		})
+
+		It("gracefully changes epochs and still delivers all requests", func() {
+			_, err := recording.DrainClients(100000)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, node := range recording.Nodes {
+				status := node.PlaybackNode.StateMachine.Status()
+				Expect(status.EpochTracker.LastActiveEpoch).To(BeNumerically(">", 10))
+			}
+		})
+
+		When("a node crashes at the planned expiration", func() {
+			BeforeEach(func() {
+				recorder.Mangler = For(MatchMsgs().FromSelf().ToNode(1).OfTypeCheckpoint().WithSequence(20)).CrashAndRestartAfter(1000, recorder.RecorderNodeConfigs[1].InitParms)
+			})
+
+			It("still delivers all requests", func() {
+				_, err := recording.DrainClients(100000)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		When("the third node is silenced", func() {
+			BeforeEach(func() {
+				recorder.Mangler = For(MatchMsgs().FromNodes(3)).Drop()
+				for _, clientConfig := range recorder.ClientConfigs {
+					clientConfig.Total = 20
+				}
+			})
+
+			It("still delivers all requests", func() {
+				_, err := recording.DrainClients(100000)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+	})
+
 	When("the first node is silenced", func() {
 		BeforeEach(func() {
 			recorder.Mangler = For(MatchMsgs().FromNodes(0)).Drop()
@@ -225,4 +279,70 @@ var _ = Describe("Mirbft", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 	})
+
+	When("the fourth node equivocates", func() {
+		BeforeEach(func() {
+			recorder.Mangler = For(MatchMsgs().FromNode(3).OfTypePreprepare()).Equivocate(0, 1)
+		})
+
+		It("still delivers all requests", func() {
+			_, err := recording.DrainClients(50000)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	When("the fourth node corrupts its digests", func() {
+		BeforeEach(func() {
+			recorder.Mangler = For(MatchMsgs().FromNode(3)).CorruptDigests()
+		})
+
+		It("still delivers all requests", func() {
+			_, err := recording.DrainClients(50000)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	When("the fourth node forges its checkpoints", func() {
+		BeforeEach(func() {
+			recorder.Mangler = For(MatchMsgs().FromNode(3)).ForgeCheckpoints()
+		})
+
+		It("still delivers all requests", func() {
+			_, err := recording.DrainClients(50000)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	When("the fourth node malforms its epoch changes", func() {
+		BeforeEach(func() {
+			recorder.Mangler = For(MatchMsgs().FromNode(3)).MalformEpochChanges()
+		})
+
+		It("still delivers all requests", func() {
+			_, err := recording.DrainClients(50000)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	When("the third node, primary of the second epoch, forges its new epochs", func() {
+		BeforeEach(func() {
+			recorder.Mangler = For(MatchMsgs().FromNode(2)).ForgeNewEpochs()
+		})
+
+		It("still delivers all requests", func() {
+			_, err := recording.DrainClients(50000)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	When("the fourth node spams acks for nonexistent requests", func() {
+		BeforeEach(func() {
+			recorder.Mangler = For(MatchMsgs().FromNode(3)).SpamAcks(5)
+		})
+
+		It("still delivers all requests", func() {
+			_, err := recording.DrainClients(50000)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
 })
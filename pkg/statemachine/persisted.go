@@ -107,6 +107,16 @@ func (p *persisted) addNEntry(nEntry *pb.NEntry) *actionSet {
 	return p.appendLogEntry(d)
 }
 
+func (p *persisted) addFEntry(fEntry *pb.FEntry) *actionSet {
+	d := &pb.Persistent{
+		Type: &pb.Persistent_FEntry{
+			FEntry: fEntry,
+		},
+	}
+
+	return p.appendLogEntry(d)
+}
+
 func (p *persisted) addCEntry(cEntry *pb.CEntry) *actionSet {
 	assertNotEqual(cEntry.NetworkState, nil, "network config must be set")
 
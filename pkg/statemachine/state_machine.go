@@ -230,7 +230,7 @@ func (sm *StateMachine) applyEvent(stateEvent *pb.StateEvent) *actionSet {
 		newLow := sm.checkpointTracker.garbageCollect()
 		sm.Logger.Log(LevelDebug, "garbage collecting through", "seq_no", newLow)
 
-		sm.persisted.truncate(newLow)
+		actions.concat(sm.persisted.truncate(newLow))
 
 		if newLow > uint64(sm.checkpointTracker.networkConfig.CheckpointInterval) {
 			// Note, we leave an extra checkpoint worth of batches around, to help
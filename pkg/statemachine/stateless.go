@@ -120,6 +120,23 @@ func seqToBucket(seqNo uint64, nc *pb.NetworkState_Config) bucketID {
 	return bucketID(seqNo % uint64(nc.NumberOfBuckets))
 }
 
+// plannedExpiration computes the sequence number at which an epoch starting
+// after the given checkpoint gracefully ends.  Because epochs end only once the
+// checkpoint at their planned expiration is stable, the expiration is rounded
+// up to a checkpoint boundary.  And, so that the epoch always has some sequences
+// of its own to allocate, the expiration is at least one checkpoint interval
+// beyond the final preprepares the epoch inherits.
+func plannedExpiration(config *pb.NetworkState_Config, startingSeqNo uint64, finalPreprepares int) uint64 {
+	ci := uint64(config.CheckpointInterval)
+
+	epochLength := (config.MaxEpochLength + ci - 1) / ci * ci
+	if minLength := uint64(finalPreprepares) + ci; epochLength < minLength {
+		epochLength = minLength
+	}
+
+	return startingSeqNo + epochLength
+}
+
 func constructNewEpochConfig(config *pb.NetworkState_Config, newLeaders []uint64, epochChanges map[nodeID]*parsedEpochChange) *pb.NewEpochConfig {
 	type checkpointKey struct {
 		SeqNo uint64
@@ -195,9 +212,8 @@ func constructNewEpochConfig(config *pb.NetworkState_Config, newLeaders []uint64
 
 	newEpochConfig := &pb.NewEpochConfig{
 		Config: &pb.EpochConfig{
-			Number:            newEpochNumber,
-			Leaders:           newLeaders,
-			PlannedExpiration: maxCheckpoint.SeqNo + config.MaxEpochLength,
+			Number:  newEpochNumber,
+			Leaders: newLeaders,
 		},
 		StartingCheckpoint: &pb.Checkpoint{
 			SeqNo: maxCheckpoint.SeqNo,
@@ -317,6 +333,8 @@ func constructNewEpochConfig(config *pb.NetworkState_Config, newLeaders []uint64
 		newEpochConfig.FinalPreprepares = nil
 	}
 
+	newEpochConfig.Config.PlannedExpiration = plannedExpiration(config, maxCheckpoint.SeqNo, len(newEpochConfig.FinalPreprepares))
+
 	return newEpochConfig
 }
 
@@ -0,0 +1,205 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testengine
+
+import (
+	pb "github.com/IBM/mirbft/mirbftpb"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// The byzantine manglers rewrite the contents of messages, and so are
+// typically bound to the messages from a particular node, for instance:
+//   For(MatchMsgs().FromNode(3)).CorruptDigests()
+// makes node 3 lie about the digests it prepares and commits.  Because
+// the same message is delivered to each of its targets, (and may be retained
+// by the sender), these manglers always rewrite a copy of the message.
+
+// unmangled returns the event as is.
+func unmangled(event *rpb.RecordedEvent) []MangleResult {
+	return []MangleResult{{Event: event}}
+}
+
+// cloneMsg returns a copy of the step event and of its message.
+func cloneMsg(event *rpb.RecordedEvent) (*rpb.RecordedEvent, *pb.Msg) {
+	clone := proto.Clone(event).(*rpb.RecordedEvent)
+	return clone, clone.StateEvent.GetStep().Msg
+}
+
+// corrupt returns a value which differs from the original, but
+// is derived from it, so that corrupting the same value twice
+// yields the same lie.
+func corrupt(value []byte) []byte {
+	if len(value) == 0 {
+		return []byte("byzantine")
+	}
+
+	result := make([]byte, len(value))
+	for i, b := range value {
+		result[i] = b ^ 0xff
+	}
+	return result
+}
+
+// EquivocateMangler rewrites the preprepares received by the target nodes to
+// contain a different batch than the one received by all other nodes.  The
+// alternate batch omits the last request of the original batch, or if the
+// original batch is empty, contains a request which was never sent.
+type EquivocateMangler struct {
+	Targets []uint64
+}
+
+func (em *EquivocateMangler) Mangle(random int, event *rpb.RecordedEvent) []MangleResult {
+	if event.StateEvent.GetStep().GetMsg().GetPreprepare() == nil || !uint64SliceContains(em.Targets, event.NodeId) {
+		return unmangled(event)
+	}
+
+	clone, msg := cloneMsg(event)
+	preprepare := msg.GetPreprepare()
+	if len(preprepare.Batch) > 0 {
+		preprepare.Batch = preprepare.Batch[:len(preprepare.Batch)-1]
+	} else {
+		preprepare.Batch = []*pb.RequestAck{
+			{
+				ClientId: 0,
+				ReqNo:    preprepare.SeqNo,
+				Digest:   corrupt(nil),
+			},
+		}
+	}
+
+	return []MangleResult{{Event: clone}}
+}
+
+func uint64SliceContains(values []uint64, value uint64) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CorruptDigestMangler rewrites the digests of prepares and commits.
+type CorruptDigestMangler struct{}
+
+func (CorruptDigestMangler) Mangle(random int, event *rpb.RecordedEvent) []MangleResult {
+	switch event.StateEvent.GetStep().GetMsg().GetType().(type) {
+	case *pb.Msg_Prepare, *pb.Msg_Commit:
+	default:
+		return unmangled(event)
+	}
+
+	clone, msg := cloneMsg(event)
+	switch c := msg.Type.(type) {
+	case *pb.Msg_Prepare:
+		c.Prepare.Digest = corrupt(c.Prepare.Digest)
+	case *pb.Msg_Commit:
+		c.Commit.Digest = corrupt(c.Commit.Digest)
+	}
+
+	return []MangleResult{{Event: clone}}
+}
+
+// ForgeCheckpointMangler rewrites the values of checkpoints.
+type ForgeCheckpointMangler struct{}
+
+func (ForgeCheckpointMangler) Mangle(random int, event *rpb.RecordedEvent) []MangleResult {
+	if event.StateEvent.GetStep().GetMsg().GetCheckpoint() == nil {
+		return unmangled(event)
+	}
+
+	clone, msg := cloneMsg(event)
+	checkpoint := msg.GetCheckpoint()
+	checkpoint.Value = corrupt(checkpoint.Value)
+	return []MangleResult{{Event: clone}}
+}
+
+// MalformEpochChangeMangler rewrites epoch changes, including those embedded
+// in epoch change acks, so that they are invalid.  Depending on the random
+// value, the epoch change either contains a duplicated checkpoint, contains
+// a P-set entry far beyond any checkpoint, or contains no checkpoints at all.
+type MalformEpochChangeMangler struct{}
+
+func (MalformEpochChangeMangler) Mangle(random int, event *rpb.RecordedEvent) []MangleResult {
+	switch event.StateEvent.GetStep().GetMsg().GetType().(type) {
+	case *pb.Msg_EpochChange, *pb.Msg_EpochChangeAck:
+	default:
+		return unmangled(event)
+	}
+
+	clone, msg := cloneMsg(event)
+	epochChange := msg.GetEpochChange()
+	if epochChange == nil {
+		epochChange = msg.GetEpochChangeAck().EpochChange
+	}
+
+	var maxSeqNo uint64
+	for _, checkpoint := range epochChange.Checkpoints {
+		if checkpoint.SeqNo > maxSeqNo {
+			maxSeqNo = checkpoint.SeqNo
+		}
+	}
+
+	switch {
+	case random%3 == 0 && len(epochChange.Checkpoints) > 0:
+		epochChange.Checkpoints = append(epochChange.Checkpoints, epochChange.Checkpoints[0])
+	case random%3 == 1:
+		epochChange.PSet = append(epochChange.PSet, &pb.EpochChange_SetEntry{
+			Epoch:  epochChange.NewEpoch - 1,
+			SeqNo:  maxSeqNo + 100000,
+			Digest: corrupt(nil),
+		})
+	default:
+		epochChange.Checkpoints = nil
+	}
+
+	return []MangleResult{{Event: clone}}
+}
+
+// ForgeNewEpochMangler rewrites new epoch messages to reference epoch changes
+// which were never sent.
+type ForgeNewEpochMangler struct{}
+
+func (ForgeNewEpochMangler) Mangle(random int, event *rpb.RecordedEvent) []MangleResult {
+	if event.StateEvent.GetStep().GetMsg().GetNewEpoch() == nil {
+		return unmangled(event)
+	}
+
+	clone, msg := cloneMsg(event)
+	for _, remoteEpochChange := range msg.GetNewEpoch().EpochChanges {
+		remoteEpochChange.Digest = corrupt(remoteEpochChange.Digest)
+	}
+
+	return []MangleResult{{Event: clone}}
+}
+
+// AckSpamMangler delivers each request ack along with Count additional
+// acks for requests far beyond the client's window, which the client never
+// sent.
+type AckSpamMangler struct {
+	Count int
+}
+
+func (am *AckSpamMangler) Mangle(random int, event *rpb.RecordedEvent) []MangleResult {
+	results := unmangled(event)
+
+	if event.StateEvent.GetStep().GetMsg().GetRequestAck() == nil {
+		return results
+	}
+
+	for i := 0; i < am.Count; i++ {
+		clone, msg := cloneMsg(event)
+		ack := msg.GetRequestAck()
+		ack.ReqNo += 1000000 + uint64(i)
+		ack.Digest = corrupt(ack.Digest)
+		results = append(results, MangleResult{Event: clone})
+	}
+
+	return results
+}
@@ -0,0 +1,165 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testengine
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+)
+
+var _ = Describe("Byzantine manglers", func() {
+	stepEvent := func(target uint64, msg *pb.Msg) *rpb.RecordedEvent {
+		return &rpb.RecordedEvent{
+			NodeId: target,
+			StateEvent: &pb.StateEvent{
+				Type: &pb.StateEvent_Step{
+					Step: &pb.StateEvent_InboundMsg{
+						Source: 3,
+						Msg:    msg,
+					},
+				},
+			},
+		}
+	}
+
+	mangledMsg := func(results []MangleResult) *pb.Msg {
+		Expect(results).To(HaveLen(1))
+		return results[0].Event.StateEvent.GetStep().Msg
+	}
+
+	It("equivocates only to the targets", func() {
+		msg := &pb.Msg{
+			Type: &pb.Msg_Preprepare{
+				Preprepare: &pb.Preprepare{
+					SeqNo: 5,
+					Batch: []*pb.RequestAck{{ClientId: 1, ReqNo: 2}},
+				},
+			},
+		}
+		original := proto.Clone(msg)
+		mangler := &EquivocateMangler{Targets: []uint64{1}}
+
+		Expect(mangledMsg(mangler.Mangle(0, stepEvent(0, msg))).GetPreprepare().Batch).To(HaveLen(1))
+		Expect(mangledMsg(mangler.Mangle(0, stepEvent(1, msg))).GetPreprepare().Batch).To(BeEmpty())
+		Expect(proto.Equal(msg, original)).To(BeTrue())
+
+		msg.GetPreprepare().Batch = nil
+		batch := mangledMsg(mangler.Mangle(0, stepEvent(1, msg))).GetPreprepare().Batch
+		Expect(batch).To(HaveLen(1))
+		Expect(batch[0].ReqNo).To(Equal(uint64(5)))
+	})
+
+	It("corrupts digests without modifying the original message", func() {
+		msg := &pb.Msg{
+			Type: &pb.Msg_Commit{
+				Commit: &pb.Commit{
+					SeqNo:  5,
+					Digest: []byte{0x0f, 0xf0},
+				},
+			},
+		}
+		commit := mangledMsg(CorruptDigestMangler{}.Mangle(0, stepEvent(0, msg))).GetCommit()
+		Expect(commit.Digest).To(Equal([]byte{0xf0, 0x0f}))
+		Expect(msg.GetCommit().Digest).To(Equal([]byte{0x0f, 0xf0}))
+	})
+
+	It("forges checkpoint values", func() {
+		msg := &pb.Msg{
+			Type: &pb.Msg_Checkpoint{
+				Checkpoint: &pb.Checkpoint{
+					SeqNo: 20,
+					Value: []byte("value"),
+				},
+			},
+		}
+		checkpoint := mangledMsg(ForgeCheckpointMangler{}.Mangle(0, stepEvent(0, msg))).GetCheckpoint()
+		Expect(checkpoint.Value).NotTo(Equal([]byte("value")))
+		Expect(checkpoint.SeqNo).To(Equal(uint64(20)))
+	})
+
+	It("malforms epoch changes", func() {
+		msg := &pb.Msg{
+			Type: &pb.Msg_EpochChangeAck{
+				EpochChangeAck: &pb.EpochChangeAck{
+					Originator: 1,
+					EpochChange: &pb.EpochChange{
+						NewEpoch:    2,
+						Checkpoints: []*pb.Checkpoint{{SeqNo: 20}},
+					},
+				},
+			},
+		}
+
+		epochChange := mangledMsg(MalformEpochChangeMangler{}.Mangle(0, stepEvent(0, msg))).GetEpochChangeAck().EpochChange
+		Expect(epochChange.Checkpoints).To(HaveLen(2))
+
+		epochChange = mangledMsg(MalformEpochChangeMangler{}.Mangle(1, stepEvent(0, msg))).GetEpochChangeAck().EpochChange
+		Expect(epochChange.PSet).To(HaveLen(1))
+		Expect(epochChange.PSet[0].SeqNo).To(Equal(uint64(100020)))
+
+		epochChange = mangledMsg(MalformEpochChangeMangler{}.Mangle(2, stepEvent(0, msg))).GetEpochChangeAck().EpochChange
+		Expect(epochChange.Checkpoints).To(BeEmpty())
+
+		Expect(msg.GetEpochChangeAck().EpochChange.Checkpoints).To(HaveLen(1))
+	})
+
+	It("forges the epoch changes of new epochs", func() {
+		msg := &pb.Msg{
+			Type: &pb.Msg_NewEpoch{
+				NewEpoch: &pb.NewEpoch{
+					EpochChanges: []*pb.NewEpoch_RemoteEpochChange{
+						{NodeId: 1, Digest: []byte("digest")},
+					},
+				},
+			},
+		}
+		newEpoch := mangledMsg(ForgeNewEpochMangler{}.Mangle(0, stepEvent(0, msg))).GetNewEpoch()
+		Expect(newEpoch.EpochChanges[0].Digest).NotTo(Equal([]byte("digest")))
+		Expect(msg.GetNewEpoch().EpochChanges[0].Digest).To(Equal([]byte("digest")))
+	})
+
+	It("spams acks for nonexistent requests", func() {
+		msg := &pb.Msg{
+			Type: &pb.Msg_RequestAck{
+				RequestAck: &pb.RequestAck{ClientId: 1, ReqNo: 2},
+			},
+		}
+		results := (&AckSpamMangler{Count: 3}).Mangle(0, stepEvent(0, msg))
+		Expect(results).To(HaveLen(4))
+		Expect(results[0].Event.StateEvent.GetStep().Msg).To(Equal(msg))
+		for i, result := range results[1:] {
+			ack := result.Event.StateEvent.GetStep().Msg.GetRequestAck()
+			Expect(ack.ClientId).To(Equal(uint64(1)))
+			Expect(ack.ReqNo).To(Equal(uint64(1000002 + i)))
+		}
+	})
+
+	It("passes other messages through unchanged", func() {
+		event := stepEvent(0, &pb.Msg{
+			Type: &pb.Msg_Suspect{
+				Suspect: &pb.Suspect{Epoch: 1},
+			},
+		})
+		for _, mangler := range []Mangler{
+			&EquivocateMangler{Targets: []uint64{0}},
+			CorruptDigestMangler{},
+			ForgeCheckpointMangler{},
+			MalformEpochChangeMangler{},
+			ForgeNewEpochMangler{},
+			&AckSpamMangler{Count: 3},
+		} {
+			results := mangler.Mangle(0, event)
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Event).To(BeIdenticalTo(event))
+		}
+	})
+})
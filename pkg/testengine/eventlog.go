@@ -125,8 +125,8 @@ func (l *EventLog) InsertProposeEvent(target uint64, req *pb.RequestAck, fromNow
 	)
 }
 
-func (l *EventLog) InsertStepEvent(target uint64, stepEvent *pb.StateEvent_InboundMsg, fromNow int64) {
-	l.InsertStateEvent(
+func (l *EventLog) InsertStepEvent(target uint64, stepEvent *pb.StateEvent_InboundMsg, fromNow int64) *rpb.RecordedEvent {
+	return l.InsertStateEvent(
 		target,
 		&pb.StateEvent{
 			Type: &pb.StateEvent_Step{
@@ -137,12 +137,14 @@ func (l *EventLog) InsertStepEvent(target uint64, stepEvent *pb.StateEvent_Inbou
 	)
 }
 
-func (l *EventLog) InsertStateEvent(target uint64, stateEvent *pb.StateEvent, fromNow int64) {
-	l.Insert(&rpb.RecordedEvent{
+func (l *EventLog) InsertStateEvent(target uint64, stateEvent *pb.StateEvent, fromNow int64) *rpb.RecordedEvent {
+	event := &rpb.RecordedEvent{
 		NodeId:     target,
 		Time:       l.FakeTime + fromNow,
 		StateEvent: stateEvent,
-	})
+	}
+	l.Insert(event)
+	return event
 }
 
 func (l *EventLog) InsertProcess(target uint64, fromNow int64) {
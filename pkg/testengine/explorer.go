@@ -0,0 +1,207 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testengine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Scenario constructs the recorder for a single run of an exploration.
+// Because recorders, and many manglers, hold state, a new recorder must be
+// constructed for every run.  The seed may be used to vary the scenario beyond
+// the randomness of the manglers, for instance, to select which faults to
+// inject and when.
+type Scenario func(seed int64) *Recorder
+
+// Explorer runs a scenario over a range of random seeds, checking that each run
+// drains its clients without violating any invariant.
+type Explorer struct {
+	// Name identifies the scenario in the names of the event logs written.
+	Name string
+
+	// Scenario constructs the recorder for each seed.
+	Scenario Scenario
+
+	// FirstSeed is the first seed explored, and Seeds is the number of
+	// consecutive seeds explored after it.
+	FirstSeed int64
+	Seeds     int
+
+	// Parallelism is the number of seeds explored concurrently.  If zero,
+	// the seeds are explored one at a time.
+	Parallelism int
+
+	// Timeout is the number of events after which a run which has not
+	// drained its clients fails.
+	Timeout int
+
+	// OutputDir is the directory to which the event logs of failing seeds
+	// are written.  If empty, the event logs are discarded.
+	OutputDir string
+
+	// ReproCommand, if set, returns a command which reproduces the failure
+	// of a seed, to be reported alongside the failure.
+	ReproCommand func(seed int64) string
+}
+
+// SeedFailure describes a seed whose run failed.
+type SeedFailure struct {
+	Seed   int64
+	Events uint64
+	Err    error
+
+	// LogPath is the path of the event log of the failed run, or empty if
+	// the explorer has no output directory.
+	LogPath string
+}
+
+// Run executes the scenario for a single seed, writing its event log to
+// output.  It returns the number of events executed, and the error which
+// caused the run to fail, if any.
+func (e *Explorer) Run(seed int64, output io.Writer) (uint64, error) {
+	recorder := e.Scenario(seed)
+	recorder.RandomSeed = seed
+
+	recording, err := drain(recorder, e.Timeout, output)
+	if recording == nil {
+		return 0, err
+	}
+
+	return recording.EventIndex, err
+}
+
+// drain records the recorder's network until its clients drain, writing the
+// event log to output.  A panic by the state machine is returned as an error,
+// so that it may be reported like any other failure.
+func drain(recorder *Recorder, timeout int, output io.Writer) (recording *Recording, err error) {
+	recorder.LogOutput = ioutil.Discard
+
+	recording, err = recorder.Recording(gzip.NewWriter(output))
+	if err != nil {
+		return nil, errors.WithMessage(err, "could not construct recording")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("panicked at event %d: %v", recording.EventIndex, r)
+		}
+
+		if closeErr := recording.EventLog.Output.Close(); closeErr != nil && err == nil {
+			err = errors.WithMessage(closeErr, "could not flush event log")
+		}
+	}()
+
+	_, err = recording.DrainClients(timeout)
+	return recording, err
+}
+
+func (e *Explorer) explore(seed int64) (*SeedFailure, error) {
+	output := &bytes.Buffer{}
+	events, err := e.Run(seed, output)
+	if err == nil {
+		return nil, nil
+	}
+
+	failure := &SeedFailure{
+		Seed:   seed,
+		Events: events,
+		Err:    err,
+	}
+
+	if e.OutputDir == "" {
+		return failure, nil
+	}
+
+	failure.LogPath = filepath.Join(e.OutputDir, fmt.Sprintf("%s-%d.eventlog", e.Name, seed))
+	if err := ioutil.WriteFile(failure.LogPath, output.Bytes(), 0644); err != nil {
+		return nil, errors.WithMessagef(err, "could not write event log for seed %d", seed)
+	}
+
+	return failure, nil
+}
+
+// Explore runs the scenario for each seed, reporting each failure to output as
+// it occurs, and returns the failures ordered by seed.
+func (e *Explorer) Explore(output io.Writer) ([]*SeedFailure, error) {
+	if e.OutputDir != "" {
+		if err := os.MkdirAll(e.OutputDir, 0755); err != nil {
+			return nil, errors.WithMessage(err, "could not create output directory")
+		}
+	}
+
+	parallelism := e.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	seeds := make(chan int64)
+	go func() {
+		for i := 0; i < e.Seeds; i++ {
+			seeds <- e.FirstSeed + int64(i)
+		}
+		close(seeds)
+	}()
+
+	var (
+		mutex    sync.Mutex
+		wg       sync.WaitGroup
+		failures []*SeedFailure
+		firstErr error
+	)
+
+	wg.Add(parallelism)
+	for i := 0; i < parallelism; i++ {
+		go func() {
+			defer wg.Done()
+			for seed := range seeds {
+				failure, err := e.explore(seed)
+
+				mutex.Lock()
+				switch {
+				case err != nil:
+					if firstErr == nil {
+						firstErr = err
+					}
+				case failure != nil:
+					failures = append(failures, failure)
+					e.report(output, failure)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].Seed < failures[j].Seed
+	})
+
+	fmt.Fprintf(output, "Explored %d seeds of scenario %s, %d failed\n", e.Seeds, e.Name, len(failures))
+
+	return failures, firstErr
+}
+
+func (e *Explorer) report(output io.Writer, failure *SeedFailure) {
+	fmt.Fprintf(output, "Seed %d failed after %d events: %s\n", failure.Seed, failure.Events, failure.Err)
+	if failure.LogPath != "" {
+		fmt.Fprintf(output, "  event log: %s\n", failure.LogPath)
+	}
+	if e.ReproCommand != nil {
+		fmt.Fprintf(output, "  reproduce: %s\n", e.ReproCommand(failure.Seed))
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testengine_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+	"github.com/IBM/mirbft/pkg/testengine"
+)
+
+var _ = Describe("Explorer", func() {
+	var (
+		outputDir string
+		output    *bytes.Buffer
+		explorer  *testengine.Explorer
+	)
+
+	BeforeEach(func() {
+		var err error
+		outputDir, err = ioutil.TempDir("", "explorer")
+		Expect(err).NotTo(HaveOccurred())
+
+		output = &bytes.Buffer{}
+
+		explorer = &testengine.Explorer{
+			Name: "test",
+			Scenario: func(seed int64) *testengine.Recorder {
+				recorder := testengine.BasicRecorder(4, 4, 20)
+				if seed%2 == 1 {
+					// No request commits before the first ticks
+					recorder.ProgressTicks = 1
+				}
+				return recorder
+			},
+			FirstSeed:   10,
+			Seeds:       4,
+			Parallelism: 2,
+			Timeout:     50000,
+			OutputDir:   filepath.Join(outputDir, "failures"),
+			ReproCommand: func(seed int64) string {
+				return fmt.Sprintf("repro %d", seed)
+			},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(outputDir)
+	})
+
+	It("reports and records the failing seeds", func() {
+		failures, err := explorer.Explore(output)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(failures).To(HaveLen(2))
+
+		for i, failure := range failures {
+			seed := int64(11 + 2*i)
+			Expect(failure.Seed).To(Equal(seed))
+			Expect(failure.Err).To(MatchError(ContainSubstring(fmt.Sprintf("invariant violated at event %d", failure.Events))))
+			Expect(failure.LogPath).To(Equal(filepath.Join(explorer.OutputDir, fmt.Sprintf("test-%d.eventlog", seed))))
+			Expect(output.String()).To(ContainSubstring(fmt.Sprintf("Seed %d failed after %d events: ", seed, failure.Events)))
+			Expect(output.String()).To(ContainSubstring(fmt.Sprintf("  event log: %s\n  reproduce: repro %d\n", failure.LogPath, seed)))
+
+			logFile, err := os.Open(failure.LogPath)
+			Expect(err).NotTo(HaveOccurred())
+			eventLog, err := testengine.ReadEventLog(logFile)
+			logFile.Close()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uint64(eventLog.List.Len())).To(Equal(failure.Events))
+		}
+
+		Expect(output.String()).To(HaveSuffix("Explored 4 seeds of scenario test, 2 failed\n"))
+
+		files, err := ioutil.ReadDir(explorer.OutputDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(2))
+	})
+
+	It("reproduces the same run for the same seed", func() {
+		first := &bytes.Buffer{}
+		firstEvents, err := explorer.Run(11, first)
+		Expect(err).To(HaveOccurred())
+
+		second := &bytes.Buffer{}
+		secondEvents, err := explorer.Run(11, second)
+		Expect(err).To(HaveOccurred())
+
+		Expect(secondEvents).To(Equal(firstEvents))
+		Expect(second.Bytes()).To(Equal(first.Bytes()))
+	})
+
+	It("reports panics as failures", func() {
+		scenario := explorer.Scenario
+		explorer.Scenario = func(seed int64) *testengine.Recorder {
+			recorder := scenario(seed)
+			recorder.Mangler = testengine.InlineMangler(func(random int, event *rpb.RecordedEvent) []testengine.MangleResult {
+				if event.Time > 1000 {
+					panic("mangler failure")
+				}
+				return []testengine.MangleResult{{Event: event}}
+			})
+			return recorder
+		}
+		explorer.Seeds = 1
+		explorer.FirstSeed = 0
+
+		failures, err := explorer.Explore(output)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(failures).To(HaveLen(1))
+		Expect(failures[0].Err).To(MatchError(fmt.Sprintf("panicked at event %d: mangler failure", failures[0].Events)))
+	})
+})
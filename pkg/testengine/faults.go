@@ -0,0 +1,127 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testengine
+
+import (
+	pb "github.com/IBM/mirbft/mirbftpb"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+)
+
+// The fault manglers act on the links between nodes rather than on
+// particular messages.  Combined with Between, or scheduled with a
+// FaultSchedule, they describe how the network degrades and heals over time,
+// for instance:
+//   Between(1000, 6000).Partition([]uint64{0, 1}, []uint64{2, 3})
+// splits a four node network into two halves for five seconds.  All times
+// are in the units of the event log, which are milliseconds for the
+// BasicRecorder, (so one tick is 500 units).
+
+// Between is useful to apply a mangling only to events which occur within
+// a window of time, at or after start, and before end.  If end is zero, the
+// mangling applies to all events after start.
+func Between(start, end int64) *Mangling {
+	return &Mangling{
+		Filter: InlineMatcher(func(random int, event *rpb.RecordedEvent) bool {
+			return inWindow(start, end, event.Time)
+		}),
+	}
+}
+
+func inWindow(start, end, time int64) bool {
+	return time >= start && (end == 0 || time < end)
+}
+
+// Partition splits the network into the given groups of nodes, which
+// cannot communicate with one another.
+func (m *Mangling) Partition(groups ...[]uint64) Mangler {
+	return m.Do(&PartitionMangler{Groups: groups})
+}
+
+// FailLink drops the messages from one node to another.
+func (m *Mangling) FailLink(from, to uint64) Mangler {
+	return m.Do(&LinkFailureMangler{From: from, To: to})
+}
+
+// PartitionMangler drops all messages sent between nodes in different groups.
+// Nodes which do not appear in any group form an additional group of their
+// own.
+type PartitionMangler struct {
+	Groups [][]uint64
+}
+
+func (pm *PartitionMangler) group(nodeID uint64) int {
+	for i, group := range pm.Groups {
+		if uint64SliceContains(group, nodeID) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (pm *PartitionMangler) Mangle(random int, event *rpb.RecordedEvent) []MangleResult {
+	step, ok := event.StateEvent.Type.(*pb.StateEvent_Step)
+	if !ok || pm.group(step.Step.Source) == pm.group(event.NodeId) {
+		return unmangled(event)
+	}
+
+	return nil
+}
+
+// LinkFailureMangler drops the messages sent from one node to another, but
+// not those sent in the reverse direction.
+type LinkFailureMangler struct {
+	From uint64
+	To   uint64
+}
+
+func (lm *LinkFailureMangler) Mangle(random int, event *rpb.RecordedEvent) []MangleResult {
+	step, ok := event.StateEvent.Type.(*pb.StateEvent_Step)
+	if !ok || step.Step.Source != lm.From || event.NodeId != lm.To {
+		return unmangled(event)
+	}
+
+	return nil
+}
+
+// ScheduledFault is a mangler which is applied to the events occurring at or
+// after Start, and before End.  If End is zero, the fault never heals.
+type ScheduledFault struct {
+	Start int64
+	End   int64
+	Fault Mangler
+}
+
+// FaultSchedule is a script of faults, which may overlap in time.  Each
+// event is passed through every fault active at the time of the event, in
+// order, so that for instance, a message may be both delayed by one fault
+// and dropped by another.
+type FaultSchedule []ScheduledFault
+
+func (fs FaultSchedule) Mangle(random int, event *rpb.RecordedEvent) []MangleResult {
+	// Faults may reschedule the event, so the active faults are
+	// determined by the time the event originally occurred.
+	time := event.Time
+	results := unmangled(event)
+	for _, fault := range fs {
+		if !inWindow(fault.Start, fault.End, time) {
+			continue
+		}
+
+		var next []MangleResult
+		for _, result := range results {
+			for _, mangled := range fault.Fault.Mangle(random, result.Event) {
+				next = append(next, MangleResult{
+					Event:    mangled.Event,
+					Remangle: result.Remangle || mangled.Remangle,
+				})
+			}
+		}
+		results = next
+	}
+
+	return results
+}
@@ -0,0 +1,86 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testengine
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+)
+
+var _ = Describe("Fault manglers", func() {
+	msgEvent := func(time int64, source, target uint64) *rpb.RecordedEvent {
+		return &rpb.RecordedEvent{
+			NodeId: target,
+			Time:   time,
+			StateEvent: &pb.StateEvent{
+				Type: &pb.StateEvent_Step{
+					Step: &pb.StateEvent_InboundMsg{
+						Source: source,
+						Msg: &pb.Msg{
+							Type: &pb.Msg_Suspect{
+								Suspect: &pb.Suspect{Epoch: 1},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	It("partitions the network only within the window", func() {
+		mangler := Between(100, 200).Partition([]uint64{0, 1}, []uint64{2})
+		Expect(mangler.Mangle(0, msgEvent(150, 0, 1))).To(HaveLen(1))
+		Expect(mangler.Mangle(0, msgEvent(150, 0, 2))).To(BeEmpty())
+		Expect(mangler.Mangle(0, msgEvent(150, 3, 2))).To(BeEmpty())
+		Expect(mangler.Mangle(0, msgEvent(150, 3, 0))).To(BeEmpty())
+		Expect(mangler.Mangle(0, msgEvent(150, 3, 4))).To(HaveLen(1))
+		Expect(mangler.Mangle(0, msgEvent(150, 2, 2))).To(HaveLen(1))
+		Expect(mangler.Mangle(0, msgEvent(99, 0, 2))).To(HaveLen(1))
+		Expect(mangler.Mangle(0, msgEvent(200, 0, 2))).To(HaveLen(1))
+
+		tick := &rpb.RecordedEvent{
+			NodeId: 2,
+			Time:   150,
+			StateEvent: &pb.StateEvent{
+				Type: &pb.StateEvent_Tick{
+					Tick: &pb.StateEvent_TickElapsed{},
+				},
+			},
+		}
+		Expect(mangler.Mangle(0, tick)).To(HaveLen(1))
+	})
+
+	It("fails links in one direction only", func() {
+		mangler := For(MatchMsgs()).FailLink(0, 1)
+		Expect(mangler.Mangle(0, msgEvent(0, 0, 1))).To(BeEmpty())
+		Expect(mangler.Mangle(0, msgEvent(0, 1, 0))).To(HaveLen(1))
+	})
+
+	It("applies each fault active at the time of the event in order", func() {
+		schedule := FaultSchedule{
+			{Start: 0, End: 100, Fault: &DelayMangler{Delay: 50}},
+			{Start: 50, End: 0, Fault: &DuplicateMangler{MaxDelay: 10}},
+			{Start: 200, End: 0, Fault: DropMangler{}},
+		}
+
+		results := schedule.Mangle(3, msgEvent(10, 0, 1))
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Event.Time).To(Equal(int64(60)))
+		Expect(results[0].Remangle).To(BeTrue())
+
+		results = schedule.Mangle(3, msgEvent(60, 0, 1))
+		Expect(results).To(HaveLen(2))
+		Expect(results[0].Event.Time).To(Equal(int64(110)))
+		Expect(results[1].Event.Time).To(Equal(int64(113)))
+		Expect(results[1].Remangle).To(BeTrue())
+
+		Expect(schedule.Mangle(3, msgEvent(250, 0, 1))).To(BeEmpty())
+	})
+})
@@ -0,0 +1,177 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testengine
+
+import (
+	"bytes"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+type requestID struct {
+	clientID uint64
+	reqNo    uint64
+}
+
+// InvariantChecker verifies the safety and liveness of the network as the
+// recording executes.  It checks that no two nodes commit different batches,
+// or different checkpoint values, for the same sequence number, that no request
+// commits at more than one sequence number, and, if ProgressTicks is set, that
+// the network commits some new request at least every ProgressTicks ticks of
+// any node while requests remain outstanding.  If GracefulEpochChanges is set,
+// it additionally checks that no epoch is suspected by enough nodes to force an
+// epoch change before the epoch's planned expiration.
+//
+// A node which restarts, or which transfers state, may commit the same batch at
+// the same sequence number more than once, which is not a violation.
+type InvariantChecker struct {
+	// ProgressTicks is the number of ticks a node may observe without
+	// any request committing before the network is considered stalled.
+	// If zero, liveness is not checked.
+	ProgressTicks int
+
+	// GracefulEpochChanges, if set, makes it a violation for F+1 nodes to
+	// suspect the same epoch, for networks whose nodes are slow, but
+	// correct.  A single slow node may suspect an epoch which the others
+	// continue in.
+	GracefulEpochChanges bool
+
+	// F is the number of faulty nodes the network tolerates.
+	F int
+
+	// Totals is the number of requests expected from each client.  Requests
+	// from clients not in Totals, or beyond the total, are not expected.
+	Totals map[uint64]uint64
+
+	batches     map[uint64]*pb.QEntry
+	checkpoints map[uint64][]byte
+	requests    map[requestID]uint64
+	remaining   uint64
+	ticks       map[uint64]int
+	suspicions  map[uint64]map[uint64]struct{}
+}
+
+func (ic *InvariantChecker) init() {
+	if ic.batches != nil {
+		return
+	}
+
+	ic.batches = map[uint64]*pb.QEntry{}
+	ic.checkpoints = map[uint64][]byte{}
+	ic.requests = map[requestID]uint64{}
+	ic.ticks = map[uint64]int{}
+	ic.suspicions = map[uint64]map[uint64]struct{}{}
+	for _, total := range ic.Totals {
+		ic.remaining += total
+	}
+}
+
+// Commit checks a batch committed by a node against those committed by the
+// other nodes.
+func (ic *InvariantChecker) Commit(nodeID uint64, batch *pb.QEntry) error {
+	ic.init()
+
+	committed, ok := ic.batches[batch.SeqNo]
+	if !ok {
+		ic.batches[batch.SeqNo] = batch
+	} else {
+		if !bytes.Equal(committed.Digest, batch.Digest) {
+			return errors.Errorf("node %d committed batch with digest %x at seq_no=%d, but another node committed digest %x", nodeID, batch.Digest, batch.SeqNo, committed.Digest)
+		}
+
+		if len(committed.Requests) != len(batch.Requests) {
+			return errors.Errorf("node %d committed %d requests at seq_no=%d, but another node committed %d", nodeID, len(batch.Requests), batch.SeqNo, len(committed.Requests))
+		}
+
+		for i, request := range batch.Requests {
+			if !proto.Equal(request, committed.Requests[i]) {
+				return errors.Errorf("node %d committed request client_id=%d req_no=%d at seq_no=%d, but another node committed request client_id=%d req_no=%d", nodeID, request.ClientId, request.ReqNo, batch.SeqNo, committed.Requests[i].ClientId, committed.Requests[i].ReqNo)
+			}
+		}
+	}
+
+	for _, request := range batch.Requests {
+		id := requestID{clientID: request.ClientId, reqNo: request.ReqNo}
+		seqNo, ok := ic.requests[id]
+		if ok {
+			if seqNo != batch.SeqNo {
+				return errors.Errorf("node %d committed request client_id=%d req_no=%d at seq_no=%d, but it was already committed at seq_no=%d", nodeID, request.ClientId, request.ReqNo, batch.SeqNo, seqNo)
+			}
+			continue
+		}
+
+		ic.requests[id] = batch.SeqNo
+
+		if total, ok := ic.Totals[request.ClientId]; ok && request.ReqNo < total {
+			ic.remaining--
+			ic.ticks = map[uint64]int{}
+		}
+	}
+
+	return nil
+}
+
+// Checkpoint checks a checkpoint computed by a node against those computed by
+// the other nodes.
+func (ic *InvariantChecker) Checkpoint(nodeID uint64, checkpoint *pb.CheckpointResult) error {
+	ic.init()
+
+	value, ok := ic.checkpoints[checkpoint.SeqNo]
+	if !ok {
+		ic.checkpoints[checkpoint.SeqNo] = checkpoint.Value
+		return nil
+	}
+
+	if !bytes.Equal(value, checkpoint.Value) {
+		return errors.Errorf("node %d computed checkpoint value %x at seq_no=%d, but another node computed %x", nodeID, checkpoint.Value, checkpoint.SeqNo, value)
+	}
+
+	return nil
+}
+
+// Suspect checks that a suspicion of an epoch by a node does not force the
+// epoch to end early.
+func (ic *InvariantChecker) Suspect(nodeID uint64, suspect *pb.Suspect) error {
+	ic.init()
+
+	if !ic.GracefulEpochChanges {
+		return nil
+	}
+
+	suspicions, ok := ic.suspicions[suspect.Epoch]
+	if !ok {
+		suspicions = map[uint64]struct{}{}
+		ic.suspicions[suspect.Epoch] = suspicions
+	}
+	suspicions[nodeID] = struct{}{}
+
+	if len(suspicions) > ic.F {
+		return errors.Errorf("node %d suspected epoch %d, which %d nodes now suspect, forcing an ungraceful epoch change", nodeID, suspect.Epoch, len(suspicions))
+	}
+
+	return nil
+}
+
+// Tick checks that the network has not exceeded its tick budget for
+// committing a new request.
+func (ic *InvariantChecker) Tick(nodeID uint64) error {
+	ic.init()
+
+	if ic.ProgressTicks == 0 || ic.remaining == 0 {
+		return nil
+	}
+
+	ic.ticks[nodeID]++
+	if ic.ticks[nodeID] > ic.ProgressTicks {
+		return errors.Errorf("node %d ticked %d times without any request committing, while %d requests remain", nodeID, ic.ticks[nodeID], ic.remaining)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testengine
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+)
+
+var _ = Describe("InvariantChecker", func() {
+	var checker *InvariantChecker
+
+	BeforeEach(func() {
+		checker = &InvariantChecker{
+			ProgressTicks: 2,
+			Totals:        map[uint64]uint64{0: 2},
+		}
+	})
+
+	batch := func(seqNo uint64, digest string, reqNos ...uint64) *pb.QEntry {
+		qEntry := &pb.QEntry{
+			SeqNo:  seqNo,
+			Digest: []byte(digest),
+		}
+		for _, reqNo := range reqNos {
+			qEntry.Requests = append(qEntry.Requests, &pb.RequestAck{
+				ClientId: 0,
+				ReqNo:    reqNo,
+				Digest:   uint64ToBytes(reqNo),
+			})
+		}
+		return qEntry
+	}
+
+	It("allows nodes to commit the same batches, even repeatedly", func() {
+		Expect(checker.Commit(0, batch(1, "a", 0))).To(Succeed())
+		Expect(checker.Commit(1, batch(1, "a", 0))).To(Succeed())
+		Expect(checker.Commit(1, batch(1, "a", 0))).To(Succeed())
+		Expect(checker.Commit(1, batch(2, "b"))).To(Succeed())
+	})
+
+	It("detects nodes committing different batches", func() {
+		Expect(checker.Commit(0, batch(1, "a", 0))).To(Succeed())
+		Expect(checker.Commit(1, batch(1, "b", 0))).To(MatchError("node 1 committed batch with digest 62 at seq_no=1, but another node committed digest 61"))
+		Expect(checker.Commit(2, batch(1, "a", 1))).To(MatchError("node 2 committed request client_id=0 req_no=1 at seq_no=1, but another node committed request client_id=0 req_no=0"))
+		Expect(checker.Commit(3, batch(1, "a"))).To(MatchError("node 3 committed 0 requests at seq_no=1, but another node committed 1"))
+	})
+
+	It("detects requests committing twice", func() {
+		Expect(checker.Commit(0, batch(1, "a", 0))).To(Succeed())
+		Expect(checker.Commit(0, batch(2, "b", 0))).To(MatchError("node 0 committed request client_id=0 req_no=0 at seq_no=2, but it was already committed at seq_no=1"))
+	})
+
+	It("detects nodes computing different checkpoints", func() {
+		Expect(checker.Checkpoint(0, &pb.CheckpointResult{SeqNo: 5, Value: []byte("a")})).To(Succeed())
+		Expect(checker.Checkpoint(1, &pb.CheckpointResult{SeqNo: 5, Value: []byte("a")})).To(Succeed())
+		Expect(checker.Checkpoint(2, &pb.CheckpointResult{SeqNo: 5, Value: []byte("b")})).To(MatchError("node 2 computed checkpoint value 62 at seq_no=5, but another node computed 61"))
+	})
+
+	It("detects enough nodes suspecting an epoch to end it ungracefully", func() {
+		checker.GracefulEpochChanges = true
+		checker.F = 1
+
+		Expect(checker.Suspect(3, &pb.Suspect{Epoch: 1})).To(Succeed())
+		Expect(checker.Suspect(3, &pb.Suspect{Epoch: 1})).To(Succeed())
+		Expect(checker.Suspect(2, &pb.Suspect{Epoch: 2})).To(Succeed())
+		Expect(checker.Suspect(1, &pb.Suspect{Epoch: 1})).To(MatchError("node 1 suspected epoch 1, which 2 nodes now suspect, forcing an ungraceful epoch change"))
+	})
+
+	It("detects the network failing to make progress", func() {
+		Expect(checker.Tick(0)).To(Succeed())
+		Expect(checker.Tick(0)).To(Succeed())
+		Expect(checker.Commit(0, batch(1, "a", 0))).To(Succeed())
+		Expect(checker.Tick(0)).To(Succeed())
+		Expect(checker.Tick(1)).To(Succeed())
+		Expect(checker.Tick(0)).To(Succeed())
+		Expect(checker.Tick(0)).To(MatchError("node 0 ticked 3 times without any request committing, while 1 requests remain"))
+
+		Expect(checker.Commit(0, batch(2, "b", 1))).To(Succeed())
+		for i := 0; i < 5; i++ {
+			Expect(checker.Tick(0)).To(Succeed())
+		}
+	})
+})
@@ -122,6 +122,42 @@ func (m *Mangling) CrashAndRestartAfter(delay int64, initParms *pb.StateEvent_In
 	})
 }
 
+// Equivocate makes the sender of the matched preprepares send a different
+// batch to the target nodes than to the others.
+func (m *Mangling) Equivocate(targets ...uint64) Mangler {
+	return m.Do(&EquivocateMangler{Targets: targets})
+}
+
+// CorruptDigests makes the sender of the matched prepares and commits lie
+// about the digest.
+func (m *Mangling) CorruptDigests() Mangler {
+	return m.Do(CorruptDigestMangler{})
+}
+
+// ForgeCheckpoints makes the sender of the matched checkpoints lie about
+// the checkpoint value.
+func (m *Mangling) ForgeCheckpoints() Mangler {
+	return m.Do(ForgeCheckpointMangler{})
+}
+
+// MalformEpochChanges makes the sender of the matched epoch changes and
+// epoch change acks send invalid epoch changes.
+func (m *Mangling) MalformEpochChanges() Mangler {
+	return m.Do(MalformEpochChangeMangler{})
+}
+
+// ForgeNewEpochs makes the sender of the matched new epoch messages
+// reference epoch changes which were never sent.
+func (m *Mangling) ForgeNewEpochs() Mangler {
+	return m.Do(ForgeNewEpochMangler{})
+}
+
+// SpamAcks makes the sender of the matched request acks additionally ack
+// count requests which do not exist.
+func (m *Mangling) SpamAcks(count int) Mangler {
+	return m.Do(&AckSpamMangler{Count: count})
+}
+
 func MatchMsgs() *MsgMatching {
 	return newMsgMatching()
 }
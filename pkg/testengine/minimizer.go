@@ -0,0 +1,341 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testengine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+var numbers = regexp.MustCompile("[0-9]+")
+
+// SameFailure reports whether two errors describe the same failure, ignoring
+// any numbers within them, such as event indices, times, and request numbers,
+// which naturally change as a scenario is minimized.
+func SameFailure(original, candidate error) bool {
+	if original == nil || candidate == nil {
+		return original == candidate
+	}
+
+	return numbers.ReplaceAllString(original.Error(), "#") == numbers.ReplaceAllString(candidate.Error(), "#")
+}
+
+// Minimizer searches for the smallest variant of a failing scenario which
+// still fails in the same way.  It repeatedly removes faults from the
+// recorder's fault schedule, shortens the windows in which the remaining faults
+// apply, and reduces the number of requests each client sends, keeping any
+// change after which the scenario still fails in no more events than before.
+//
+// If the recorder's mangler is not a FaultSchedule, it is treated as a single
+// fault which applies for the whole of the recording.
+type Minimizer struct {
+	// Recorder constructs the failing recorder.  Because recorders, and
+	// many manglers, hold state, it is invoked for every run.
+	Recorder func() *Recorder
+
+	// Timeout is the number of events after which a run which has not
+	// drained its clients fails.
+	Timeout int
+
+	// SameFailure reports whether the failure of a candidate is the same as
+	// the original failure.  If nil, the package level SameFailure is used.
+	SameFailure func(original, candidate error) bool
+
+	// MaxRuns bounds the number of runs performed.  If zero, the minimizer
+	// runs until no further reduction is possible.
+	MaxRuns int
+
+	// Progress, if set, receives a line for each reduction made.
+	Progress io.Writer
+}
+
+// Reduction describes a variant of the scenario.
+type Reduction struct {
+	// Faults holds the schedule of the original faults which remain,
+	// indexed by their position in the original schedule.
+	Faults map[int]ScheduledFault
+
+	// Totals holds the number of requests sent by each client, indexed by
+	// the position of the client in the recorder's configuration.
+	Totals []uint64
+}
+
+func (r *Reduction) clone() *Reduction {
+	result := &Reduction{
+		Faults: map[int]ScheduledFault{},
+		Totals: append([]uint64(nil), r.Totals...),
+	}
+	for i, fault := range r.Faults {
+		result.Faults[i] = fault
+	}
+	return result
+}
+
+// Minimization is the result of a minimizer.
+type Minimization struct {
+	Reduction *Reduction
+
+	// Err is the failure of the smallest variant found, and Events the
+	// number of events of its recording.
+	Err    error
+	Events uint64
+
+	// Runs is the number of times the scenario was executed.
+	Runs int
+}
+
+type minimizer struct {
+	*Minimizer
+	original error
+	faults   int
+	best     *Minimization
+	bestLog  []byte
+	bestTime int64
+}
+
+func schedule(recorder *Recorder) FaultSchedule {
+	switch mangler := recorder.Mangler.(type) {
+	case nil:
+		return nil
+	case FaultSchedule:
+		return mangler
+	default:
+		return FaultSchedule{{Fault: mangler}}
+	}
+}
+
+// Apply constructs the recorder for the given reduction of the scenario.
+func (m *Minimizer) Apply(reduction *Reduction) *Recorder {
+	recorder := m.Recorder()
+
+	var reduced FaultSchedule
+	for i, fault := range schedule(recorder) {
+		window, ok := reduction.Faults[i]
+		if !ok {
+			continue
+		}
+		fault.Start = window.Start
+		fault.End = window.End
+		reduced = append(reduced, fault)
+	}
+
+	recorder.Mangler = nil
+	if len(reduced) > 0 {
+		recorder.Mangler = reduced
+	}
+
+	for i, total := range reduction.Totals {
+		recorder.ClientConfigs[i].Total = total
+	}
+
+	return recorder
+}
+
+// try runs the reduction, and keeps it as the best if it fails in the same
+// way, in no more events.
+func (m *minimizer) try(reduction *Reduction, description string) bool {
+	if m.MaxRuns != 0 && m.best.Runs >= m.MaxRuns {
+		return false
+	}
+	m.best.Runs++
+
+	output := &bytes.Buffer{}
+	recording, err := drain(m.Apply(reduction), m.Timeout, output)
+	if recording == nil {
+		return false
+	}
+
+	sameFailure := m.SameFailure
+	if sameFailure == nil {
+		sameFailure = SameFailure
+	}
+
+	if !sameFailure(m.original, err) || recording.EventIndex > m.best.Events {
+		return false
+	}
+
+	m.best.Reduction = reduction
+	m.best.Err = err
+	m.best.Events = recording.EventIndex
+	m.bestLog = output.Bytes()
+	m.bestTime = recording.EventLog.FakeTime
+
+	if m.Progress != nil {
+		fmt.Fprintf(m.Progress, "Run %d: %s, fails after %d events\n", m.best.Runs, description, m.best.Events)
+	}
+
+	return true
+}
+
+// removeFaults removes chunks of the remaining faults, halving the size
+// of the chunks until single faults have been tried.
+func (m *minimizer) removeFaults() bool {
+	changed := false
+	for chunk := len(m.best.Reduction.Faults); chunk > 0; chunk /= 2 {
+		var remaining []int
+		for i := 0; i < m.faults; i++ {
+			if _, ok := m.best.Reduction.Faults[i]; ok {
+				remaining = append(remaining, i)
+			}
+		}
+
+		for i := 0; i < len(remaining); i += chunk {
+			removed := remaining[i:]
+			if len(removed) > chunk {
+				removed = removed[:chunk]
+			}
+
+			candidate := m.best.Reduction.clone()
+			for _, j := range removed {
+				delete(candidate.Faults, j)
+			}
+
+			if m.try(candidate, fmt.Sprintf("removed faults %v", removed)) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// shortenFaults shrinks the window of each remaining fault, trimming
+// its end, then its start, by successively smaller steps for as long as the
+// scenario still fails.
+func (m *minimizer) shortenFaults() bool {
+	changed := false
+	for i := 0; i < m.faults; i++ {
+		fault, ok := m.best.Reduction.Faults[i]
+		if !ok {
+			continue
+		}
+
+		shorten := func(start, end int64) bool {
+			candidate := m.best.Reduction.clone()
+			candidate.Faults[i] = ScheduledFault{Start: start, End: end}
+			if !m.try(candidate, fmt.Sprintf("shortened fault %d to [%d, %d)", i, start, end)) {
+				return false
+			}
+			fault.Start, fault.End = start, end
+			changed = true
+			return true
+		}
+
+		// Faults after the end of the recording are irrelevant
+		if (fault.End == 0 || fault.End > m.bestTime+1) && m.bestTime+1 > fault.Start {
+			shorten(fault.Start, m.bestTime+1)
+		}
+
+		if fault.End == 0 {
+			continue
+		}
+
+		for step := (fault.End - fault.Start) / 2; step > 0; step /= 2 {
+			if fault.End-step > fault.Start {
+				shorten(fault.Start, fault.End-step)
+			}
+
+			if fault.Start+step < fault.End {
+				shorten(fault.Start+step, fault.End)
+			}
+		}
+	}
+	return changed
+}
+
+// reduceRequests halves the number of requests of each client for as long
+// as the scenario still fails, then tries removing a single request.
+func (m *minimizer) reduceRequests() bool {
+	changed := false
+	for i := range m.best.Reduction.Totals {
+		for {
+			total := m.best.Reduction.Totals[i]
+			if total == 0 {
+				break
+			}
+
+			candidate := m.best.Reduction.clone()
+			candidate.Totals[i] = total / 2
+			if m.try(candidate, fmt.Sprintf("reduced client %d to %d requests", i, total/2)) {
+				changed = true
+				continue
+			}
+
+			if total/2 == total-1 {
+				break
+			}
+
+			candidate = m.best.Reduction.clone()
+			candidate.Totals[i] = total - 1
+			if m.try(candidate, fmt.Sprintf("reduced client %d to %d requests", i, total-1)) {
+				changed = true
+				continue
+			}
+
+			break
+		}
+	}
+	return changed
+}
+
+// Minimize runs the original scenario, which must fail, then searches for the
+// smallest variant which fails in the same way, and writes its event log to
+// output.
+func (m *Minimizer) Minimize(output io.Writer) (*Minimization, error) {
+	recorder := m.Recorder()
+
+	reduction := &Reduction{
+		Faults: map[int]ScheduledFault{},
+	}
+	for i, fault := range schedule(recorder) {
+		reduction.Faults[i] = ScheduledFault{Start: fault.Start, End: fault.End}
+	}
+	for _, clientConfig := range recorder.ClientConfigs {
+		reduction.Totals = append(reduction.Totals, clientConfig.Total)
+	}
+
+	originalLog := &bytes.Buffer{}
+	recording, err := drain(m.Apply(reduction), m.Timeout, originalLog)
+	if recording == nil {
+		return nil, err
+	}
+	if err == nil {
+		return nil, errors.Errorf("scenario does not fail")
+	}
+
+	mm := &minimizer{
+		Minimizer: m,
+		original:  err,
+		faults:    len(reduction.Faults),
+		best: &Minimization{
+			Reduction: reduction,
+			Err:       err,
+			Events:    recording.EventIndex,
+			Runs:      1,
+		},
+		bestLog:  originalLog.Bytes(),
+		bestTime: recording.EventLog.FakeTime,
+	}
+
+	for {
+		changed := mm.removeFaults()
+		changed = mm.shortenFaults() || changed
+		changed = mm.reduceRequests() || changed
+		if !changed {
+			break
+		}
+	}
+
+	if _, err := output.Write(mm.bestLog); err != nil {
+		return nil, errors.WithMessage(err, "could not write event log")
+	}
+
+	return mm.best, nil
+}
@@ -0,0 +1,112 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testengine_test
+
+import (
+	"bytes"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/IBM/mirbft/pkg/testengine"
+)
+
+var _ = Describe("Minimizer", func() {
+	It("compares failures ignoring numbers", func() {
+		Expect(testengine.SameFailure(
+			errors.New("invariant violated at event 6646: node 0 ticked 5 times"),
+			errors.New("invariant violated at event 12: node 3 ticked 5 times"),
+		)).To(BeTrue())
+		Expect(testengine.SameFailure(
+			errors.New("invariant violated at event 6646: node 0 ticked 5 times"),
+			errors.New("panicked at event 6646: node 0 ticked 5 times"),
+		)).To(BeFalse())
+		Expect(testengine.SameFailure(errors.New("failure"), nil)).To(BeFalse())
+	})
+
+	It("refuses to minimize a scenario which does not fail", func() {
+		minimizer := &testengine.Minimizer{
+			Recorder: func() *testengine.Recorder {
+				return testengine.BasicRecorder(1, 1, 3)
+			},
+			Timeout: 1000,
+		}
+		_, err := minimizer.Minimize(&bytes.Buffer{})
+		Expect(err).To(MatchError("scenario does not fail"))
+	})
+
+	When("a partition stalls the network", func() {
+		var (
+			minimizer *testengine.Minimizer
+			progress  *bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			progress = &bytes.Buffer{}
+			minimizer = &testengine.Minimizer{
+				Recorder: func() *testengine.Recorder {
+					recorder := testengine.BasicRecorder(4, 4, 20)
+					recorder.ProgressTicks = 8
+					recorder.Mangler = testengine.FaultSchedule{
+						{
+							Fault: testengine.For(testengine.MatchMsgs()).Jitter(20),
+						},
+						{
+							Start: 2000,
+							End:   20000,
+							Fault: &testengine.PartitionMangler{
+								Groups: [][]uint64{{0, 1}, {2, 3}},
+							},
+						},
+						{
+							Start: 1000,
+							Fault: testengine.For(testengine.MatchMsgs().AtPercent(10)).Duplicate(50),
+						},
+					}
+					return recorder
+				},
+				Timeout:  50000,
+				Progress: progress,
+			}
+		})
+
+		It("finds a smaller scenario with the same failure", func() {
+			recording, err := minimizer.Recorder().Recording(nil)
+			Expect(err).NotTo(HaveOccurred())
+			_, originalErr := recording.DrainClients(50000)
+			Expect(originalErr).To(MatchError(ContainSubstring("without any request committing")))
+
+			output := &bytes.Buffer{}
+			result, err := minimizer.Minimize(output)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testengine.SameFailure(result.Err, originalErr)).To(BeTrue())
+			Expect(result.Events).To(BeNumerically("<", recording.EventIndex))
+
+			Expect(result.Reduction.Faults).To(HaveLen(1))
+			partition, ok := result.Reduction.Faults[1]
+			Expect(ok).To(BeTrue())
+			Expect(partition.End - partition.Start).To(BeNumerically("<", 18000))
+
+			var total uint64
+			for _, clientTotal := range result.Reduction.Totals {
+				total += clientTotal
+			}
+			Expect(total).To(BeNumerically("<", 80))
+			Expect(progress.String()).To(ContainSubstring("removed faults"))
+
+			eventLog, err := testengine.ReadEventLog(output)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uint64(eventLog.List.Len())).To(Equal(result.Events))
+
+			recording, err = minimizer.Apply(result.Reduction).Recording(nil)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = recording.DrainClients(50000)
+			Expect(err).To(MatchError(result.Err.Error()))
+		})
+	})
+})
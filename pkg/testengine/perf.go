@@ -0,0 +1,172 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testengine
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"sort"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+
+	"github.com/pkg/errors"
+)
+
+// PerfReport estimates the performance of a network from a recording.  As the
+// recording executes in virtual time, the estimates depend only on the
+// parameters of the network, its nodes, and its clients, and not on the speed
+// of the machine running the recording.  Rates are per second, assuming the
+// units of the event log are milliseconds, as for the BasicRecorder.
+type PerfReport struct {
+	// Requests is the number of requests committed.
+	Requests int
+
+	// Duration is the time at which the final request committed.
+	Duration int64
+
+	// Throughput is the number of requests committed per second.
+	Throughput float64
+
+	// The latency of a request is the time from when its client sends it,
+	// until f+1 nodes have committed it, so that the client may trust the
+	// result.  LatencyP50, LatencyP90, and LatencyP99 are percentiles of
+	// the latencies of all requests, and LatencyMax is the greatest.
+	LatencyP50 int64
+	LatencyP90 int64
+	LatencyP99 int64
+	LatencyMax int64
+
+	// MaxSendRate is the greatest rate, in bytes per second, at which any
+	// one node sent messages to the other nodes, over the whole duration.
+	MaxSendRate float64
+}
+
+// Measure executes the recording until f+1 nodes have committed every client
+// request, then reports the performance of the network.  It returns an error if
+// the number of events executed exceeds timeout, or if any step fails.
+func (r *Recording) Measure(timeout int) (*PerfReport, error) {
+	total := 0
+	for _, client := range r.Clients {
+		total += int(client.Config.Total)
+	}
+
+	quorum := r.Invariants.F + 1
+	committedBy := map[requestID]map[uint64]struct{}{}
+	var latencies []int64
+
+	for count := 1; len(latencies) < total; count++ {
+		if count > timeout {
+			return nil, errors.Errorf("timed out after %d events with only %d of %d requests committed", timeout, len(latencies), total)
+		}
+
+		if err := r.Step(); err != nil {
+			return nil, err
+		}
+
+		lastEvent := r.Player.LastEvent
+		if _, ok := lastEvent.StateEvent.Type.(*pb.StateEvent_ActionsReceived); !ok {
+			continue
+		}
+
+		for _, commit := range r.Player.Node(lastEvent.NodeId).Processing.Commits {
+			if commit.Batch == nil {
+				continue
+			}
+
+			for _, req := range commit.Batch.Requests {
+				id := requestID{clientID: req.ClientId, reqNo: req.ReqNo}
+				nodes, ok := committedBy[id]
+				if !ok {
+					nodes = map[uint64]struct{}{}
+					committedBy[id] = nodes
+				}
+
+				// A restarted node may commit the same request again
+				if _, ok := nodes[lastEvent.NodeId]; ok {
+					continue
+				}
+
+				nodes[lastEvent.NodeId] = struct{}{}
+				if len(nodes) != quorum {
+					continue
+				}
+
+				submittedAt := r.Clients[int(req.ClientId)].submittedAt[req.ReqNo]
+				latencies = append(latencies, r.EventLog.FakeTime-submittedAt)
+			}
+		}
+	}
+
+	return r.perfReport(latencies), nil
+}
+
+// perfReport summarizes the latencies of the committed requests, and the
+// messages sent by the nodes, as of the current time.
+func (r *Recording) perfReport(latencies []int64) *PerfReport {
+	report := &PerfReport{
+		Requests: len(latencies),
+		Duration: r.EventLog.FakeTime,
+	}
+
+	if len(latencies) == 0 || report.Duration == 0 {
+		return report
+	}
+
+	seconds := float64(report.Duration) / 1000
+	report.Throughput = float64(report.Requests) / seconds
+
+	for _, node := range r.Nodes {
+		if rate := float64(node.BytesSent) / seconds; rate > report.MaxSendRate {
+			report.MaxSendRate = rate
+		}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	report.LatencyP50 = percentile(latencies, 50)
+	report.LatencyP90 = percentile(latencies, 90)
+	report.LatencyP99 = percentile(latencies, 99)
+	report.LatencyMax = latencies[len(latencies)-1]
+
+	return report
+}
+
+// percentile returns the nearest-rank percentile of the sorted latencies.
+func percentile(latencies []int64, p int) int64 {
+	rank := (len(latencies)*p + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+
+	return latencies[rank-1]
+}
+
+// Measure executes the scenario, discarding its event log, and reports the
+// performance of its network.  The expectations of the scenario are not
+// checked, but any fault the scenario injects applies.
+func (s *ScenarioSpec) Measure() (report *PerfReport, err error) {
+	recorder, err := s.Recorder()
+	if err != nil {
+		return nil, err
+	}
+
+	recording, err := recorder.Recording(gzip.NewWriter(ioutil.Discard))
+	if err != nil {
+		return nil, errors.WithMessage(err, "could not construct recording")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			report = nil
+			err = errors.Errorf("panicked at event %d: %v", recording.EventIndex, r)
+		}
+	}()
+
+	return recording.Measure(s.Timeout)
+}
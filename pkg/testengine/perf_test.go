@@ -0,0 +1,78 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testengine_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/IBM/mirbft/pkg/testengine"
+)
+
+var _ = Describe("Measure", func() {
+	measure := func(scenario string) *testengine.PerfReport {
+		spec, err := testengine.ParseScenarioSpec([]byte(scenario))
+		Expect(err).NotTo(HaveOccurred())
+
+		report, err := spec.Measure()
+		Expect(err).NotTo(HaveOccurred())
+		return report
+	}
+
+	const batched = `
+nodes: 4
+initialParameters: {batchSize: 20}
+clients: {count: 4, requests: 200}
+`
+
+	It("reports the throughput and latency of the network", func() {
+		report := measure(batched)
+		Expect(report.Requests).To(Equal(800))
+		Expect(report.Throughput).To(BeNumerically("~", float64(800*1000)/float64(report.Duration)))
+		Expect(report.LatencyP50).To(BeNumerically(">", 0))
+		Expect(report.LatencyP50).To(BeNumerically("<=", report.LatencyP90))
+		Expect(report.LatencyP90).To(BeNumerically("<=", report.LatencyP99))
+		Expect(report.LatencyP99).To(BeNumerically("<=", report.LatencyMax))
+		Expect(report.LatencyMax).To(BeNumerically("<", report.Duration))
+		Expect(report.MaxSendRate).To(BeNumerically(">", 0))
+	})
+
+	It("commits more requests per second in larger batches", func() {
+		unbatched := measure("nodes: 4\nclients: {count: 4, requests: 200}\n")
+		Expect(measure(batched).Throughput).To(BeNumerically(">", unbatched.Throughput))
+	})
+
+	It("commits fewer requests per second over slow links", func() {
+		slow := measure(batched + "runtimeParameters: {linkBandwidth: 10}\n")
+		Expect(slow.Throughput).To(BeNumerically("<", measure(batched).Throughput))
+	})
+
+	It("commits fewer requests per second when large requests are slow to hash", func() {
+		slow := measure(`
+nodes: 4
+initialParameters: {batchSize: 20}
+runtimeParameters: {hashBandwidth: 1000}
+clients: {count: 4, requests: 200, requestSize: 10000}
+`)
+		Expect(slow.Throughput).To(BeNumerically("<", measure(batched).Throughput))
+	})
+
+	It("commits requests no faster than the clients send them", func() {
+		report := measure("nodes: 4\nclients: {count: 4, requests: 20, requestInterval: 200}\n")
+		Expect(report.Requests).To(Equal(80))
+		Expect(report.Duration).To(BeNumerically(">", 19*200))
+		Expect(report.LatencyP50).To(BeNumerically("<", 19*200))
+	})
+
+	It("fails when the requests do not commit in time", func() {
+		spec, err := testengine.ParseScenarioSpec([]byte("nodes: 4\nclients: {count: 4, requests: 200}\ntimeout: 100\n"))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = spec.Measure()
+		Expect(err).To(MatchError("timed out after 100 events with only 0 of 800 requests committed"))
+	})
+})
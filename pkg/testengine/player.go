@@ -118,6 +118,8 @@ func (p *Player) Step() error {
 		node.Actions = &pb.StateEventResult{}
 		node.Status = sm.Status()
 		node.Processing = nil
+		node.ClientActions = &pb.StateEventResult{}
+		node.ClientProcessing = nil
 	case *pb.StateEvent_Transfer:
 	case *pb.StateEvent_AddResults:
 		if node.Processing == nil {
@@ -24,7 +24,6 @@ var _ = Describe("Player", func() {
 		defer gzw.Close()
 
 		recorder = testengine.BasicRecorder(4, 4, 20)
-		recorder.NetworkState.Config.MaxEpochLength = 200000 // XXX this works around a bug in the library for now
 
 		var err error
 		recording, err = recorder.Recording(gzw)
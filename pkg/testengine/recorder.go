@@ -22,6 +22,7 @@ import (
 	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
 
 	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
 )
 
 type Hasher func() hash.Hash
@@ -47,26 +48,92 @@ type RuntimeParameters struct {
 	WALReadDelay         int
 	ReqReadDelay         int
 	StateTransferLatency int
+
+	// TickDrift bounds the random variation of each of the node's tick
+	// intervals, each tick occurs up to TickDrift earlier or later than
+	// TickInterval, so that the node's clock wanders relative to the
+	// clocks of the other nodes.
+	TickDrift int
+
+	// TickStallPercent is the percentage of ticks after which the node
+	// stalls, as for a garbage collection pause.  For TickStallDuration, the
+	// node neither ticks, nor processes its actions, though it continues to
+	// receive messages.
+	TickStallPercent  int
+	TickStallDuration int
+
+	// PersistBandwidth is the number of bytes of write-ahead log entries
+	// the node's disk persists per unit of time, in addition to the fixed
+	// PersistLatency.  If zero, persisting takes PersistLatency regardless
+	// of the amount of data written.
+	PersistBandwidth int
+
+	// LinkBandwidth is the number of bytes of messages which may be sent
+	// per unit of time over each of the node's links which has no
+	// LinkProfile.  If zero, the bandwidth is unlimited.
+	LinkBandwidth int
+
+	// HashBandwidth is the number of bytes the node's CPU hashes per unit
+	// of time, delaying the results of the node's actions, and the storing
+	// of client requests.  If zero, hashing takes no time.
+	HashBandwidth int
+
+	// StorageFaults optionally describes how the node's storage fails
+	// each time the node crashes.  If nil, the node's storage is reliable.
+	StorageFaults *StorageFaults
+
+	// LinkProfiles optionally overrides the LinkLatency of the links
+	// to particular nodes, indexed by the target node ID.
+	LinkProfiles map[uint64]*LinkProfile
+}
+
+// LinkProfile describes the link from a node to a particular target.
+type LinkProfile struct {
+	// Latency is the time for a message to traverse the link.
+	Latency int
+
+	// Bandwidth is the number of bytes of messages which may be sent
+	// over the link per unit of time.  Messages which exceed the
+	// bandwidth queue behind one another.  If zero, the bandwidth
+	// is unlimited.
+	Bandwidth int
 }
 
 type ReqStore struct {
 	ReqAcks   *list.List
-	ReqAckMap map[*pb.RequestAck]*list.Element
+	ReqAckMap map[requestID]*list.Element
 }
 
 func NewReqStore() *ReqStore {
 	return &ReqStore{
 		ReqAcks:   list.New(),
-		ReqAckMap: map[*pb.RequestAck]*list.Element{},
+		ReqAckMap: map[requestID]*list.Element{},
 	}
 }
 
 func (rs *ReqStore) Store(ack *pb.RequestAck, _ []byte) {
+	id := requestID{clientID: ack.ClientId, reqNo: ack.ReqNo}
+	if _, ok := rs.ReqAckMap[id]; ok {
+		return
+	}
+
 	el := rs.ReqAcks.PushBack(ack)
-	rs.ReqAckMap[ack] = el
+	rs.ReqAckMap[id] = el
 	// TODO, deal with free-ing
 }
 
+// Lose removes the given number of the most recently stored requests, and
+// returns them.
+func (rs *ReqStore) Lose(count int) []*pb.RequestAck {
+	var lost []*pb.RequestAck
+	for ; count > 0 && rs.ReqAcks.Len() > 0; count-- {
+		ack := rs.ReqAcks.Remove(rs.ReqAcks.Back()).(*pb.RequestAck)
+		delete(rs.ReqAckMap, requestID{clientID: ack.ClientId, reqNo: ack.ReqNo})
+		lost = append(lost, ack)
+	}
+	return lost
+}
+
 func (rs *ReqStore) Uncommitted(forEach func(*pb.RequestAck)) error {
 	for el := rs.ReqAcks.Front(); el != nil; el = el.Next() {
 		forEach(el.Value.(*pb.RequestAck))
@@ -133,6 +200,17 @@ func (wal *WAL) Truncate(index uint64) {
 	}
 }
 
+// TruncateBack removes all entries with an index greater than the given index.
+func (wal *WAL) TruncateBack(index uint64) {
+	if index < wal.LowIndex {
+		panic(fmt.Sprintf("asked to truncate back to index %d, but lowIndex is %d", index, wal.LowIndex))
+	}
+
+	for wal.LowIndex+uint64(wal.List.Len())-1 > index {
+		wal.List.Remove(wal.List.Back())
+	}
+}
+
 func (wal *WAL) LoadAll(iter func(index uint64, p *pb.Persistent)) {
 	i := uint64(0)
 	for el := wal.List.Front(); el != nil; el = el.Next() {
@@ -149,11 +227,176 @@ type RecorderNode struct {
 	Config                     *RecorderNodeConfig
 	AwaitingProcessEvent       bool
 	AwaitingClientProcessEvent bool
+
+	// StateTransfers is the number of times the node has transferred state
+	// to catch up with the network.
+	StateTransfers int
+
+	// LostEntries is the number of write-ahead log entries the node has
+	// lost to storage faults.
+	LostEntries int
+
+	// BytesSent is the number of bytes of messages the node has sent to
+	// the other nodes.
+	BytesSent int64
+
+	// linkBusyUntil is the time at which each bandwidth limited
+	// link to a target will have finished sending its queued messages.
+	linkBusyUntil map[uint64]int64
+
+	// stalledUntil is the time at which the node's current stall ends.
+	stalledUntil int64
+
+	// started is set once the node first initializes, so that any
+	// later initialization is a restart.
+	started bool
+
+	// unsynced are the write-ahead log appends which the node's disk may
+	// not yet have synced, tracked only if the node has storage faults.
+	unsynced []*unsyncedAppends
+
+	// lostRequests are the requests which were missing from the node's
+	// request store after a restart.
+	lostRequests map[requestID]struct{}
+
+	// unarrived are the requests the node has allocated, but which their
+	// clients have not yet sent.
+	unarrived []*pb.RequestAck
+}
+
+// nextArrival returns the earliest time at which a client sends one of the
+// requests the node is awaiting, or zero if the node awaits none.
+func (rn *RecorderNode) nextArrival(clients []*RecorderClient) int64 {
+	var next int64
+	for i, req := range rn.unarrived {
+		arrival := clients[int(req.ClientId)].ArrivalTime(req.ReqNo)
+		if i == 0 || arrival < next {
+			next = arrival
+		}
+	}
+
+	return next
+}
+
+// tickDelay returns the time until the node's next tick, taking into account
+// the drift of its clock, and possibly stalling the node.
+func (rn *RecorderNode) tickDelay(now int64, random *rand.Rand) int64 {
+	runtimeParms := rn.Config.RuntimeParms
+	delay := int64(runtimeParms.TickInterval)
+
+	if runtimeParms.TickDrift != 0 {
+		delay += int64(random.Intn(2*runtimeParms.TickDrift+1) - runtimeParms.TickDrift)
+		if delay < 1 {
+			delay = 1
+		}
+	}
+
+	if runtimeParms.TickStallPercent != 0 && random.Intn(100) < runtimeParms.TickStallPercent {
+		rn.stalledUntil = now + int64(runtimeParms.TickStallDuration)
+		delay += int64(runtimeParms.TickStallDuration)
+	}
+
+	return delay
+}
+
+// processDelay returns the time until the node processes its actions, which
+// it may not do until any stall ends.
+func (rn *RecorderNode) processDelay(now int64, latency int) int64 {
+	delay := int64(latency)
+	if rn.stalledUntil > now+delay {
+		delay = rn.stalledUntil - now
+	}
+
+	return delay
+}
+
+// persistDelay returns the time required to persist the given write-ahead
+// log entries before any messages which depend on them may be sent.
+func (rn *RecorderNode) persistDelay(writes []*pb.StateEventResult_Write) int64 {
+	runtimeParms := rn.Config.RuntimeParms
+	delay := int64(runtimeParms.PersistLatency)
+	if runtimeParms.PersistBandwidth == 0 {
+		return delay
+	}
+
+	size := 0
+	for _, write := range writes {
+		size += proto.Size(write)
+	}
+
+	return delay + int64((size+runtimeParms.PersistBandwidth-1)/runtimeParms.PersistBandwidth)
+}
+
+// sendDelay returns the time until a message sent now to the target will be
+// received, taking into account the time to persist the log entries it
+// depends on, the profile of the link, and any messages already queued on it.
+func (rn *RecorderNode) sendDelay(now, persistDelay int64, target uint64, msg *pb.Msg) int64 {
+	runtimeParms := rn.Config.RuntimeParms
+	if target == rn.Config.InitParms.Id {
+		// There's no latency to send to ourselves
+		return persistDelay
+	}
+
+	profile, ok := runtimeParms.LinkProfiles[target]
+	if !ok {
+		profile = &LinkProfile{
+			Latency:   runtimeParms.LinkLatency,
+			Bandwidth: runtimeParms.LinkBandwidth,
+		}
+	}
+
+	if profile.Bandwidth == 0 {
+		return int64(profile.Latency) + persistDelay
+	}
+
+	if rn.linkBusyUntil == nil {
+		rn.linkBusyUntil = map[uint64]int64{}
+	}
+
+	start := now + persistDelay
+	if busyUntil := rn.linkBusyUntil[target]; busyUntil > start {
+		start = busyUntil
+	}
+
+	size := proto.Size(msg)
+	transmission := int64((size + profile.Bandwidth - 1) / profile.Bandwidth)
+	rn.linkBusyUntil[target] = start + transmission
+
+	return start + transmission + int64(profile.Latency) - now
+}
+
+// hashDelay returns the time the node's CPU requires to hash the given
+// number of bytes.
+func (rn *RecorderNode) hashDelay(size int) int64 {
+	hashBandwidth := rn.Config.RuntimeParms.HashBandwidth
+	if hashBandwidth == 0 {
+		return 0
+	}
+
+	return int64((size + hashBandwidth - 1) / hashBandwidth)
 }
 
 type RecorderClient struct {
 	Config *ClientConfig
 	Hasher Hasher
+
+	// submittedAt is the time at which each request was first stored by
+	// any node, which is when the client is considered to have sent it.
+	submittedAt map[uint64]int64
+}
+
+// ArrivalTime returns the earliest time at which the client sends the request.
+func (rc *RecorderClient) ArrivalTime(reqNo uint64) int64 {
+	return int64(reqNo) * int64(rc.Config.RequestInterval)
+}
+
+// submit records the time at which the request was first stored by any node.
+func (rc *RecorderClient) submit(reqNo uint64, now int64) {
+	if _, ok := rc.submittedAt[reqNo]; ok {
+		return
+	}
+
+	rc.submittedAt[reqNo] = now
 }
 
 func (rc *RecorderClient) RequestByReqNo(reqNo uint64) *pb.RequestAck {
@@ -260,6 +503,16 @@ type ClientConfig struct {
 	ID          uint64
 	MaxInFlight int
 	Total       uint64
+
+	// RequestInterval is the time between the client's successive
+	// requests, a request is not stored by any node before the client
+	// sends it.  If zero, all of the client's requests are sent at once,
+	// and are limited only by the client's window.
+	RequestInterval int
+
+	// RequestSize is the number of bytes of each request, which every
+	// node hashes as it stores the request.
+	RequestSize int
 }
 
 type ReconfigPoint struct {
@@ -277,6 +530,15 @@ type Recorder struct {
 	LogOutput           io.Writer
 	Hasher              Hasher
 	RandomSeed          int64
+
+	// ProgressTicks is the number of ticks any node may observe without
+	// a new request committing before the recording fails.  If zero,
+	// the recording does not check for progress.
+	ProgressTicks int
+
+	// GracefulEpochChanges fails the recording as soon as enough nodes
+	// suspect an epoch to force it to end before its planned expiration.
+	GracefulEpochChanges bool
 }
 
 func (r *Recorder) Recording(output *gzip.Writer) (*Recording, error) {
@@ -326,31 +588,47 @@ func (r *Recorder) Recording(output *gzip.Writer) (*Recording, error) {
 		}
 	}
 
+	invariants := &InvariantChecker{
+		ProgressTicks:        r.ProgressTicks,
+		GracefulEpochChanges: r.GracefulEpochChanges,
+		F:                    int(r.NetworkState.Config.F),
+		Totals:               map[uint64]uint64{},
+	}
+
 	clients := make([]*RecorderClient, len(r.ClientConfigs))
 	for i, clientConfig := range r.ClientConfigs {
+		invariants.Totals[clientConfig.ID] = clientConfig.Total
+
 		client := &RecorderClient{
-			Config: clientConfig,
-			Hasher: r.Hasher,
+			Config:      clientConfig,
+			Hasher:      r.Hasher,
+			submittedAt: map[uint64]int64{},
 		}
 
 		clients[i] = client
 	}
 
 	return &Recording{
-		Hasher:   r.Hasher,
-		EventLog: eventLog,
-		Player:   player,
-		Nodes:    nodes,
-		Clients:  clients,
+		Hasher:     r.Hasher,
+		EventLog:   eventLog,
+		Player:     player,
+		Nodes:      nodes,
+		Clients:    clients,
+		Invariants: invariants,
 	}, nil
 }
 
 type Recording struct {
-	Hasher   Hasher
-	EventLog *EventLog
-	Player   *Player
-	Nodes    []*RecorderNode
-	Clients  []*RecorderClient
+	Hasher     Hasher
+	EventLog   *EventLog
+	Player     *Player
+	Nodes      []*RecorderNode
+	Clients    []*RecorderClient
+	Invariants *InvariantChecker
+
+	// EventIndex is the index of the last event stepped, counting
+	// from one, as the events of the log are numbered by mircat.
+	EventIndex uint64
 }
 
 func (r *Recording) Step() error {
@@ -363,6 +641,12 @@ func (r *Recording) Step() error {
 		return errors.WithMessagef(err, "could not step recorder's underlying player")
 	}
 
+	r.EventIndex++
+
+	if err := r.checkInvariants(); err != nil {
+		return errors.WithMessagef(err, "invariant violated at event %d", r.EventIndex)
+	}
+
 	lastEvent := r.Player.LastEvent
 
 	node := r.Nodes[int(lastEvent.NodeId)]
@@ -372,7 +656,7 @@ func (r *Recording) Step() error {
 
 	switch stateEvent := lastEvent.StateEvent.Type.(type) {
 	case *pb.StateEvent_Tick:
-		r.EventLog.InsertTickEvent(lastEvent.NodeId, int64(runtimeParms.TickInterval))
+		r.EventLog.InsertTickEvent(lastEvent.NodeId, node.tickDelay(r.EventLog.FakeTime, r.EventLog.Rand))
 	case *pb.StateEvent_AddResults:
 	case *pb.StateEvent_AddClientResults:
 	case *pb.StateEvent_Step:
@@ -384,6 +668,8 @@ func (r *Recording) Step() error {
 		clientActionResults := &pb.StateEvent_ClientActionResults{}
 
 		processing := playbackNode.ClientProcessing
+		reqs := node.unarrived
+		node.unarrived = nil
 		for _, reqSlot := range processing.AllocatedRequests {
 			client := r.Clients[int(reqSlot.ClientId)]
 			if client.Config.ID != reqSlot.ClientId {
@@ -394,6 +680,27 @@ func (r *Recording) Step() error {
 			if req == nil {
 				continue
 			}
+
+			reqs = append(reqs, req)
+		}
+
+		hashed := 0
+		for _, req := range reqs {
+			client := r.Clients[int(req.ClientId)]
+			if client.ArrivalTime(req.ReqNo) > r.EventLog.FakeTime {
+				node.unarrived = append(node.unarrived, req)
+				continue
+			}
+
+			if _, ok := node.lostRequests[requestID{clientID: req.ClientId, reqNo: req.ReqNo}]; ok {
+				// The client already received our ack for this request
+				// before we lost it, and so does not resubmit it.
+				continue
+			}
+
+			client.submit(req.ReqNo, r.EventLog.FakeTime)
+			node.ReqStore.Store(req, nil)
+			hashed += client.Config.RequestSize
 			clientActionResults.Persisted = append(clientActionResults.Persisted, req)
 		}
 
@@ -404,7 +711,7 @@ func (r *Recording) Step() error {
 					AddClientResults: clientActionResults,
 				},
 			},
-			0, // TODO, maybe have some additional reqstore latency here?
+			node.hashDelay(hashed), // TODO, maybe have some additional reqstore latency here?
 		)
 
 		// XXX shouldn't be needed
@@ -418,9 +725,13 @@ func (r *Recording) Step() error {
 		node.AwaitingProcessEvent = false
 		processing := playbackNode.Processing
 
+		var firstAppend uint64
 		for _, write := range processing.WriteAhead {
 			switch {
 			case write.Append != 0:
+				if firstAppend == 0 {
+					firstAppend = write.Append
+				}
 				node.WAL.Append(write.Append, write.Data)
 			case write.Truncate != 0:
 				node.WAL.Truncate(write.Truncate)
@@ -429,35 +740,45 @@ func (r *Recording) Step() error {
 			}
 		}
 
+		persistDelay := node.persistDelay(processing.WriteAhead)
+		var sends []*rpb.RecordedEvent
 		for _, send := range processing.Send {
 			for _, i := range send.Targets {
-				linkLatency := runtimeParms.LinkLatency
-				if i == lastEvent.NodeId {
-					// There's no latency to send to ourselves
-					linkLatency = 0
-				}
 				if n := r.Player.Node(i); n.StateMachine == nil {
 					continue
 				}
-				r.EventLog.InsertStepEvent(
+				if i != lastEvent.NodeId {
+					node.BytesSent += int64(proto.Size(send.Msg))
+				}
+				sends = append(sends, r.EventLog.InsertStepEvent(
 					i,
 					&pb.StateEvent_InboundMsg{
 						Source: lastEvent.NodeId,
 						Msg:    send.Msg,
 					},
-					int64(linkLatency+runtimeParms.PersistLatency),
-				)
+					node.sendDelay(r.EventLog.FakeTime, persistDelay, i, send.Msg),
+				))
 			}
 		}
 
+		if runtimeParms.StorageFaults != nil && firstAppend != 0 {
+			node.trackUnsynced(r.EventLog.FakeTime, &unsyncedAppends{
+				syncedAt: r.EventLog.FakeTime + persistDelay,
+				index:    firstAppend,
+				sends:    sends,
+			})
+		}
+
 		apply := &pb.StateEvent_ActionResults{
 			Digests: make([]*pb.HashResult, len(processing.Hash)),
 		}
 
+		hashed := 0
 		for i, hashRequest := range processing.Hash {
 			hasher := r.Hasher()
 			for _, data := range hashRequest.Data {
 				hasher.Write(data)
+				hashed += len(data)
 			}
 
 			apply.Digests[i] = &pb.HashResult{
@@ -468,6 +789,12 @@ func (r *Recording) Step() error {
 
 		apply.Checkpoints = nodeState.Commit(processing.Commits, lastEvent.NodeId)
 
+		for _, checkpoint := range apply.Checkpoints {
+			if err := r.Invariants.Checkpoint(lastEvent.NodeId, checkpoint); err != nil {
+				return errors.WithMessagef(err, "invariant violated at event %d", r.EventIndex)
+			}
+		}
+
 		r.EventLog.InsertStateEvent(
 			lastEvent.NodeId,
 			&pb.StateEvent{
@@ -475,7 +802,7 @@ func (r *Recording) Step() error {
 					AddResults: apply,
 				},
 			},
-			int64(runtimeParms.ReadyLatency),
+			int64(runtimeParms.ReadyLatency)+node.hashDelay(hashed),
 		)
 
 		if processing.StateTransfer != nil {
@@ -520,6 +847,37 @@ func (r *Recording) Step() error {
 			}
 		}
 
+		// A restart also ends any stall
+		node.stalledUntil = 0
+
+		// And discards any actions the node was awaiting to process, as
+		// well as any requests it was awaiting from its clients
+		node.AwaitingProcessEvent = false
+		node.AwaitingClientProcessEvent = false
+		node.unarrived = nil
+
+		if node.started && runtimeParms.StorageFaults != nil {
+			node.failStorage(r.EventLog)
+		}
+
+		if !node.started && runtimeParms.StorageFaults != nil {
+			// A new node persists its bootstrap entries with its first
+			// actions, so they are unsynced until then.
+			var writes []*pb.StateEventResult_Write
+			node.WAL.LoadAll(func(index uint64, p *pb.Persistent) {
+				writes = append(writes, &pb.StateEventResult_Write{
+					Append: index,
+					Data:   p,
+				})
+			})
+
+			node.trackUnsynced(r.EventLog.FakeTime, &unsyncedAppends{
+				syncedAt: r.EventLog.FakeTime + node.persistDelay(writes),
+				index:    node.WAL.LowIndex,
+			})
+		}
+		node.started = true
+
 		delay := int64(0)
 
 		var maxCEntry *pb.CEntry
@@ -544,6 +902,10 @@ func (r *Recording) Step() error {
 			}
 		})
 
+		if maxCEntry == nil {
+			return errors.Errorf("node %d restarted without any checkpoint in its write-ahead log", lastEvent.NodeId)
+		}
+
 		nodeState.Set(maxCEntry.SeqNo, maxCEntry.CheckpointValue, maxCEntry.NetworkState)
 
 		r.EventLog.InsertStateEvent(
@@ -557,9 +919,10 @@ func (r *Recording) Step() error {
 		)
 	case *pb.StateEvent_LoadEntry:
 	case *pb.StateEvent_Transfer:
+		node.StateTransfers++
 		node.State.Set(stateEvent.Transfer.SeqNo, stateEvent.Transfer.CheckpointValue, stateEvent.Transfer.NetworkState)
 	case *pb.StateEvent_CompleteInitialization:
-		r.EventLog.InsertTickEvent(lastEvent.NodeId, int64(runtimeParms.TickInterval))
+		r.EventLog.InsertTickEvent(lastEvent.NodeId, node.tickDelay(r.EventLog.FakeTime, r.EventLog.Rand))
 	default:
 		panic(fmt.Sprintf("unhandled state event type: %T", lastEvent.StateEvent.Type))
 	}
@@ -567,15 +930,61 @@ func (r *Recording) Step() error {
 	if playbackNode.Processing == nil &&
 		!isEmpty(playbackNode.Actions) &&
 		!node.AwaitingProcessEvent {
-		r.EventLog.InsertProcess(lastEvent.NodeId, int64(runtimeParms.ProcessLatency))
+		r.EventLog.InsertProcess(lastEvent.NodeId, node.processDelay(r.EventLog.FakeTime, runtimeParms.ProcessLatency))
 		node.AwaitingProcessEvent = true
 	}
 
 	if playbackNode.ClientProcessing == nil &&
-		!isEmpty(playbackNode.ClientActions) &&
 		!node.AwaitingClientProcessEvent {
-		r.EventLog.InsertClientProcess(lastEvent.NodeId, int64(runtimeParms.ClientProcessLatency))
-		node.AwaitingClientProcessEvent = true
+		switch {
+		case !isEmpty(playbackNode.ClientActions):
+			r.EventLog.InsertClientProcess(lastEvent.NodeId, node.processDelay(r.EventLog.FakeTime, runtimeParms.ClientProcessLatency))
+			node.AwaitingClientProcessEvent = true
+		case len(node.unarrived) > 0:
+			// Process again once the next awaited request arrives
+			delay := node.nextArrival(r.Clients) - r.EventLog.FakeTime
+			if processDelay := node.processDelay(r.EventLog.FakeTime, runtimeParms.ClientProcessLatency); processDelay > delay {
+				delay = processDelay
+			}
+			r.EventLog.InsertClientProcess(lastEvent.NodeId, delay)
+			node.AwaitingClientProcessEvent = true
+		}
+	}
+
+	return nil
+}
+
+// checkInvariants verifies the commits, checkpoints, suspicions, and ticks of
+// the last event.  The commits are checked as they are delivered to the node for
+// processing, so that a violation is reported at the earliest event possible.
+func (r *Recording) checkInvariants() error {
+	lastEvent := r.Player.LastEvent
+
+	switch lastEvent.StateEvent.Type.(type) {
+	case *pb.StateEvent_Tick:
+		return r.Invariants.Tick(lastEvent.NodeId)
+	case *pb.StateEvent_ActionsReceived:
+		processing := r.Player.Node(lastEvent.NodeId).Processing
+		for _, commit := range processing.Commits {
+			if commit.Batch == nil {
+				continue
+			}
+
+			if err := r.Invariants.Commit(lastEvent.NodeId, commit.Batch); err != nil {
+				return err
+			}
+		}
+
+		for _, send := range processing.Send {
+			suspect := send.Msg.GetSuspect()
+			if suspect == nil {
+				continue
+			}
+
+			if err := r.Invariants.Suspect(lastEvent.NodeId, suspect); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
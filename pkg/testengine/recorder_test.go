@@ -58,7 +58,7 @@ var _ = Describe("Recorder", func() {
 	When("There is a four node network", func() {
 		BeforeEach(func() {
 			recorder = testengine.BasicRecorder(4, 4, 200)
-			recorder.NetworkState.Config.MaxEpochLength = 100000 // XXX this works around a bug in the library for now
+			recorder.ProgressTicks = 8
 
 			var err error
 			recording, err = recorder.Recording(gzWriter)
@@ -66,15 +66,22 @@ var _ = Describe("Recorder", func() {
 		})
 
 		It("Executes and produces a log", func() {
+			// The 800 requests are committed one per sequence number, and
+			// with the standard max epoch length of 200, the network
+			// gracefully ends epochs 1 through 3, and is active in epoch 4.
+			// The epoch changes, and the WAL truncations at each stable
+			// checkpoint, account for the events beyond the 41197 needed
+			// when a single epoch ran throughout and the WAL was never
+			// truncated.
 			count, err := recording.DrainClients(50000)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(count).To(Equal(41197))
+			Expect(count).To(Equal(41691))
 
 			fmt.Printf("Executing test required a log of %d events\n", count)
 
 			for _, node := range recording.Nodes {
 				status := node.PlaybackNode.StateMachine.Status()
-				Expect(status.EpochTracker.LastActiveEpoch).To(Equal(uint64(1)))
+				Expect(status.EpochTracker.LastActiveEpoch).To(Equal(uint64(4)))
 				Expect(status.EpochTracker.EpochTargets).To(HaveLen(0))
 				//Expect(status.EpochTracker.EpochTargets[0].Suspicions).To(BeEmpty())
 
@@ -84,6 +91,220 @@ var _ = Describe("Recorder", func() {
 		})
 	})
 
+	When("the network is partitioned and then healed", func() {
+		var healTime int64
+
+		BeforeEach(func() {
+			recorder = testengine.BasicRecorder(4, 4, 20)
+			healTime = 20000
+			recorder.Mangler = testengine.Between(2000, healTime).Partition([]uint64{0, 1}, []uint64{2, 3})
+
+			var err error
+			recording, err = recorder.Recording(gzWriter)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("resumes committing after the partition heals", func() {
+			_, err := recording.DrainClients(50000)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recording.EventLog.FakeTime).To(BeNumerically(">", healTime))
+		})
+
+		It("stalls for longer than a small tick budget", func() {
+			recording.Invariants.ProgressTicks = 10
+			_, err := recording.DrainClients(50000)
+			Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf("invariant violated at event %d: node", recording.EventIndex))))
+			Expect(err).To(MatchError(ContainSubstring("ticked 11 times without any request committing")))
+			Expect(recording.EventLog.FakeTime).To(BeNumerically("<", healTime))
+		})
+	})
+
+	When("links fail asymmetrically", func() {
+		BeforeEach(func() {
+			recorder = testengine.BasicRecorder(4, 4, 20)
+			recorder.Mangler = testengine.FaultSchedule{
+				{
+					Start: 2000,
+					End:   20000,
+					Fault: &testengine.LinkFailureMangler{From: 0, To: 1},
+				},
+				{
+					Start: 2000,
+					End:   20000,
+					Fault: &testengine.LinkFailureMangler{From: 2, To: 3},
+				},
+			}
+
+			var err error
+			recording, err = recorder.Recording(gzWriter)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("resumes committing after the links are restored", func() {
+			_, err := recording.DrainClients(50000)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recording.EventLog.FakeTime).To(BeNumerically(">", 20000))
+		})
+	})
+
+	When("a node has slow and constrained links", func() {
+		var fastTime int64
+
+		BeforeEach(func() {
+			recorder = testengine.BasicRecorder(4, 4, 20)
+
+			fastRecording, err := recorder.Recording(gzip.NewWriter(ioutil.Discard))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = fastRecording.DrainClients(50000)
+			Expect(err).NotTo(HaveOccurred())
+			fastTime = fastRecording.EventLog.FakeTime
+
+			recorder = testengine.BasicRecorder(4, 4, 20)
+			for _, nodeConfig := range recorder.RecorderNodeConfigs {
+				nodeConfig.RuntimeParms.LinkProfiles = map[uint64]*testengine.LinkProfile{
+					3: {
+						Latency:   300,
+						Bandwidth: 1,
+					},
+				}
+			}
+
+			recording, err = recorder.Recording(gzWriter)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("still delivers all requests, but more slowly", func() {
+			_, err := recording.DrainClients(50000)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recording.EventLog.FakeTime).To(BeNumerically(">", fastTime))
+		})
+	})
+
+	When("the nodes' clocks drift and tick at different rates", func() {
+		BeforeEach(func() {
+			recorder = testengine.BasicRecorder(4, 4, 50)
+			recorder.GracefulEpochChanges = true
+			for i, nodeConfig := range recorder.RecorderNodeConfigs {
+				nodeConfig.RuntimeParms.TickInterval = 300 + 100*i
+				nodeConfig.RuntimeParms.TickDrift = 100
+			}
+
+			// The last node pauses briefly, and has a slow disk
+			slowParms := recorder.RecorderNodeConfigs[3].RuntimeParms
+			slowParms.TickStallPercent = 10
+			slowParms.TickStallDuration = 1000
+			slowParms.PersistLatency = 100
+			slowParms.PersistBandwidth = 10
+
+			var err error
+			recording, err = recorder.Recording(gzWriter)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("delivers all requests without any ungraceful epoch change", func() {
+			_, err := recording.DrainClients(50000)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	When("a node's disk is very slow", func() {
+		BeforeEach(func() {
+			recorder = testengine.BasicRecorder(4, 4, 100)
+			slowParms := recorder.RecorderNodeConfigs[3].RuntimeParms
+			slowParms.PersistLatency = 1000
+			slowParms.PersistBandwidth = 1
+
+			var err error
+			recording, err = recorder.Recording(gzWriter)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("catches up by transferring state", func() {
+			_, err := recording.DrainClients(50000)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recording.Nodes[3].StateTransfers).NotTo(BeZero())
+			Expect(recording.Nodes[3].State.LastSeqNo).To(Equal(recording.Nodes[0].State.LastSeqNo))
+		})
+	})
+
+	When("a node's storage fails as it crashes", func() {
+		var faults *testengine.StorageFaults
+
+		JustBeforeEach(func() {
+			recorder = testengine.BasicRecorder(4, 4, 50)
+			crashParms := recorder.RecorderNodeConfigs[1].RuntimeParms
+			crashParms.PersistLatency = 40
+			crashParms.StorageFaults = faults
+			// The node runs until it restarts, so restart it quickly,
+			// while some of its appends are still unsynced.
+			recorder.Mangler = testengine.For(
+				testengine.MatchMsgs().FromSelf().ToNode(1).OfTypeCheckpoint().WithSequence(40),
+			).CrashAndRestartAfter(30, recorder.RecorderNodeConfigs[1].InitParms)
+
+			var err error
+			recording, err = recorder.Recording(gzWriter)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		When("the unsynced appends are lost", func() {
+			BeforeEach(func() {
+				faults = &testengine.StorageFaults{LoseUnsynced: true}
+			})
+
+			It("recovers from the log its disk did sync", func() {
+				_, err := recording.DrainClients(50000)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(recording.Nodes[1].LostEntries).NotTo(BeZero())
+			})
+		})
+
+		When("the final log entry is torn", func() {
+			BeforeEach(func() {
+				faults = &testengine.StorageFaults{TearFinal: true}
+			})
+
+			It("recovers without the torn entry", func() {
+				_, err := recording.DrainClients(50000)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(recording.Nodes[1].LostEntries).To(Equal(1))
+			})
+		})
+
+		When("acknowledged requests are missing from its request store", func() {
+			BeforeEach(func() {
+				faults = &testengine.StorageFaults{MissingRequests: 3}
+			})
+
+			It("still delivers all requests", func() {
+				_, err := recording.DrainClients(50000)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(recording.Nodes[1].LostEntries).To(BeZero())
+			})
+		})
+	})
+
+	When("a node crashes before its bootstrap log entries sync", func() {
+		BeforeEach(func() {
+			recorder = testengine.BasicRecorder(4, 4, 50)
+			crashParms := recorder.RecorderNodeConfigs[1].RuntimeParms
+			crashParms.PersistLatency = 1000
+			crashParms.StorageFaults = &testengine.StorageFaults{LoseUnsynced: true}
+			recorder.Mangler = testengine.For(
+				testengine.MatchMsgs().ToNode(1),
+			).CrashAndRestartAfter(0, recorder.RecorderNodeConfigs[1].InitParms)
+
+			var err error
+			recording, err = recorder.Recording(gzWriter)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("cannot restart without any checkpoint", func() {
+			_, err := recording.DrainClients(50000)
+			Expect(err).To(MatchError(ContainSubstring("node 1 restarted without any checkpoint in its write-ahead log")))
+			Expect(recording.Nodes[1].WAL.List.Len()).To(BeZero())
+		})
+	})
+
 	When("A single-node network is selected", func() {
 		BeforeEach(func() {
 			recorder = testengine.BasicRecorder(1, 1, 3)
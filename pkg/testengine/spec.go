@@ -0,0 +1,796 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testengine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/IBM/mirbft"
+	pb "github.com/IBM/mirbft/mirbftpb"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// ScenarioSpec is a declarative description of a scenario, which may be
+// written as YAML or as JSON, for instance:
+//
+//	name: partition-heals
+//	nodes: 4
+//	clients:
+//	  count: 4
+//	  requests: 20
+//	faults:
+//	  - start: 2000
+//	    end: 20000
+//	    partition: [[0, 1], [2, 3]]
+//	expect:
+//	  minTime: 20000
+//
+// Any parameter which is not specified takes the value used by
+// BasicRecorder.
+type ScenarioSpec struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+
+	// Nodes is the number of nodes in the network.
+	Nodes int `yaml:"nodes"`
+
+	// Seed is the source of randomness for the faults, and for the drift
+	// and stalls of the nodes' ticks.
+	Seed int64 `yaml:"seed"`
+
+	// Timeout is the number of events after which the scenario fails if
+	// its clients have not drained, 100000 if not specified.
+	Timeout int `yaml:"timeout"`
+
+	// ProgressTicks is the number of ticks any node may observe without
+	// a new request committing before the scenario fails, see
+	// Recorder.ProgressTicks.
+	ProgressTicks int `yaml:"progressTicks"`
+
+	// GracefulEpochChanges fails the scenario if any epoch changes before
+	// its planned expiration, see Recorder.GracefulEpochChanges.
+	GracefulEpochChanges bool `yaml:"gracefulEpochChanges"`
+
+	Network           NetworkSpec           `yaml:"network"`
+	InitialParameters InitialParametersSpec `yaml:"initialParameters"`
+	RuntimeParameters RuntimeParametersSpec `yaml:"runtimeParameters"`
+
+	// NodeOverrides replace some of the parameters of particular nodes.
+	NodeOverrides []NodeOverrideSpec `yaml:"nodeOverrides"`
+
+	Clients          ClientsSpec         `yaml:"clients"`
+	Reconfigurations []ReconfigPointSpec `yaml:"reconfigurations"`
+	Faults           []FaultSpec         `yaml:"faults"`
+	Expect           ExpectSpec          `yaml:"expect"`
+}
+
+// NetworkSpec overrides the configuration of the standard initial network
+// state for the number of nodes and clients.
+type NetworkSpec struct {
+	F                  *int32  `yaml:"f"`
+	NumberOfBuckets    *int32  `yaml:"numberOfBuckets"`
+	CheckpointInterval *int32  `yaml:"checkpointInterval"`
+	MaxEpochLength     *uint64 `yaml:"maxEpochLength"`
+}
+
+// InitialParametersSpec describes the pb.StateEvent_InitialParameters of
+// each node, the node IDs are assigned automatically.
+type InitialParametersSpec struct {
+	BatchSize            uint32 `yaml:"batchSize"`
+	HeartbeatTicks       uint32 `yaml:"heartbeatTicks"`
+	SuspectTicks         uint32 `yaml:"suspectTicks"`
+	NewEpochTimeoutTicks uint32 `yaml:"newEpochTimeoutTicks"`
+	BufferSize           uint32 `yaml:"bufferSize"`
+}
+
+// RuntimeParametersSpec describes the RuntimeParameters of each node.
+type RuntimeParametersSpec struct {
+	TickInterval         int                         `yaml:"tickInterval"`
+	LinkLatency          int                         `yaml:"linkLatency"`
+	ReadyLatency         int                         `yaml:"readyLatency"`
+	ProcessLatency       int                         `yaml:"processLatency"`
+	ClientProcessLatency int                         `yaml:"clientProcessLatency"`
+	PersistLatency       int                         `yaml:"persistLatency"`
+	WALReadDelay         int                         `yaml:"walReadDelay"`
+	ReqReadDelay         int                         `yaml:"reqReadDelay"`
+	StateTransferLatency int                         `yaml:"stateTransferLatency"`
+	TickDrift            int                         `yaml:"tickDrift"`
+	TickStallPercent     int                         `yaml:"tickStallPercent"`
+	TickStallDuration    int                         `yaml:"tickStallDuration"`
+	PersistBandwidth     int                         `yaml:"persistBandwidth"`
+	LinkBandwidth        int                         `yaml:"linkBandwidth"`
+	HashBandwidth        int                         `yaml:"hashBandwidth"`
+	StorageFaults        *StorageFaultsSpec          `yaml:"storageFaults"`
+	LinkProfiles         map[uint64]*LinkProfileSpec `yaml:"linkProfiles"`
+}
+
+// StorageFaultsSpec describes the StorageFaults of a node.
+type StorageFaultsSpec struct {
+	LoseUnsynced    bool `yaml:"loseUnsynced"`
+	TearFinal       bool `yaml:"tearFinal"`
+	MissingRequests int  `yaml:"missingRequests"`
+}
+
+// LinkProfileSpec describes a LinkProfile.
+type LinkProfileSpec struct {
+	Latency   int `yaml:"latency"`
+	Bandwidth int `yaml:"bandwidth"`
+}
+
+// NodeOverrideSpec replaces the given parameters of a single node, any
+// parameters not given retain the values specified for all nodes.
+type NodeOverrideSpec struct {
+	Node              uint64                 `yaml:"node"`
+	InitialParameters map[string]interface{} `yaml:"initialParameters"`
+	RuntimeParameters map[string]interface{} `yaml:"runtimeParameters"`
+}
+
+// ClientsSpec describes the clients of the network.
+type ClientsSpec struct {
+	Count int `yaml:"count"`
+
+	// Requests is the number of requests sent by each client.
+	Requests uint64 `yaml:"requests"`
+
+	// MaxInFlight defaults to half the checkpoint interval.
+	MaxInFlight int `yaml:"maxInFlight"`
+
+	// RequestInterval is the time between each client's requests, if
+	// zero, the clients send their requests as fast as their windows allow.
+	RequestInterval int `yaml:"requestInterval"`
+
+	// RequestSize is the number of bytes of each request.
+	RequestSize int `yaml:"requestSize"`
+}
+
+// ReconfigPointSpec describes a ReconfigPoint, exactly one of NewClient,
+// RemoveClient, and NewConfig must be set.  NewConfig overrides the initial
+// configuration of the network.
+type ReconfigPointSpec struct {
+	Client       uint64         `yaml:"client"`
+	ReqNo        uint64         `yaml:"reqNo"`
+	NewClient    *NewClientSpec `yaml:"newClient"`
+	RemoveClient *uint64        `yaml:"removeClient"`
+	NewConfig    *NetworkSpec   `yaml:"newConfig"`
+}
+
+// NewClientSpec describes a client added by a reconfiguration.
+type NewClientSpec struct {
+	ID    uint64 `yaml:"id"`
+	Width uint32 `yaml:"width"`
+}
+
+// FaultSpec describes a fault which applies to the events occurring at or
+// after Start and before End, or forever if End is zero.  Exactly one of
+// the fault kinds must be set.
+//
+// The message faults, Drop, Jitter, Duplicate, and Delay, apply to the
+// messages selected by From, To, Types, and Percent, but never to the messages
+// a node sends to itself.  Types are named by the fields of pb.Msg, for
+// instance, 'prepare' or 'requestAck'.
+type FaultSpec struct {
+	Start int64 `yaml:"start"`
+	End   int64 `yaml:"end"`
+
+	From    []uint64 `yaml:"from"`
+	To      []uint64 `yaml:"to"`
+	Types   []string `yaml:"types"`
+	Percent int      `yaml:"percent"`
+
+	Drop      bool `yaml:"drop"`
+	Jitter    int  `yaml:"jitter"`
+	Duplicate int  `yaml:"duplicate"`
+	Delay     int  `yaml:"delay"`
+
+	Partition [][]uint64     `yaml:"partition"`
+	FailLink  *LinkSpec      `yaml:"failLink"`
+	Crash     *CrashSpec     `yaml:"crash"`
+	Byzantine *ByzantineSpec `yaml:"byzantine"`
+}
+
+// LinkSpec identifies the link from one node to another.
+type LinkSpec struct {
+	From uint64 `yaml:"from"`
+	To   uint64 `yaml:"to"`
+}
+
+// CrashSpec describes a node which crashes, then restarts after RestartDelay.
+// If SeqNo is set, the node crashes when it sends itself its checkpoint for
+// SeqNo, otherwise, it crashes at its first event within the window of the
+// fault.
+type CrashSpec struct {
+	Node         uint64 `yaml:"node"`
+	SeqNo        uint64 `yaml:"seqNo"`
+	RestartDelay int64  `yaml:"restartDelay"`
+}
+
+// ByzantineSpec describes a node which rewrites the messages it sends.
+// Behavior is one of equivocate, corruptDigests, forgeCheckpoints,
+// malformEpochChanges, forgeNewEpochs, or spamAcks.  Targets are the nodes
+// equivocated to, and Count the number of acks spammed per ack.
+type ByzantineSpec struct {
+	Node     uint64   `yaml:"node"`
+	Behavior string   `yaml:"behavior"`
+	Targets  []uint64 `yaml:"targets"`
+	Count    int      `yaml:"count"`
+}
+
+// ExpectSpec describes the expected outcome of the scenario.  If Failure is
+// empty, the scenario is expected to deliver all requests.
+type ExpectSpec struct {
+	// Failure is text which the error of a failing scenario must contain.
+	Failure string `yaml:"failure"`
+
+	// Events is the exact number of events expected, if set.
+	Events uint64 `yaml:"events"`
+
+	// MinTime and MaxTime bound the time at which the scenario
+	// completes, if set.
+	MinTime int64 `yaml:"minTime"`
+	MaxTime int64 `yaml:"maxTime"`
+
+	// Epoch is the active epoch every node is expected to end in, if set.
+	Epoch uint64 `yaml:"epoch"`
+
+	// StateTransfers are the nodes expected to have caught up with the
+	// network by transferring state.
+	StateTransfers []uint64 `yaml:"stateTransfers"`
+}
+
+// ParseScenarioSpec parses a scenario from YAML or JSON.  Unknown fields are
+// rejected, so that misspelled parameters are not silently ignored.
+func ParseScenarioSpec(data []byte) (*ScenarioSpec, error) {
+	// The defaults are those of every node of a BasicRecorder.
+	defaults := BasicRecorder(1, 0, 0).RecorderNodeConfigs[0]
+	spec := &ScenarioSpec{
+		Timeout:           100000,
+		InitialParameters: initialParametersSpec(defaults.InitParms),
+		RuntimeParameters: runtimeParametersSpec(defaults.RuntimeParms),
+	}
+	if err := decodeStrict(data, spec); err != nil {
+		return nil, errors.WithMessage(err, "could not parse scenario")
+	}
+
+	if spec.Nodes < 1 {
+		return nil, errors.Errorf("scenario must have at least one node")
+	}
+
+	return spec, nil
+}
+
+// ReadScenarioSpec reads and parses a scenario from a file.
+func ReadScenarioSpec(path string) (*ScenarioSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithMessage(err, "could not read scenario")
+	}
+
+	spec, err := ParseScenarioSpec(data)
+	if err != nil {
+		return nil, errors.WithMessage(err, path)
+	}
+
+	return spec, nil
+}
+
+func (ns *NetworkSpec) apply(config *pb.NetworkState_Config) {
+	if ns.F != nil {
+		config.F = *ns.F
+	}
+	if ns.NumberOfBuckets != nil {
+		config.NumberOfBuckets = *ns.NumberOfBuckets
+	}
+	if ns.CheckpointInterval != nil {
+		config.CheckpointInterval = *ns.CheckpointInterval
+	}
+	if ns.MaxEpochLength != nil {
+		config.MaxEpochLength = *ns.MaxEpochLength
+	}
+}
+
+func (ips *InitialParametersSpec) initialParameters(id uint64) *pb.StateEvent_InitialParameters {
+	return &pb.StateEvent_InitialParameters{
+		Id:                   id,
+		BatchSize:            ips.BatchSize,
+		HeartbeatTicks:       ips.HeartbeatTicks,
+		SuspectTicks:         ips.SuspectTicks,
+		NewEpochTimeoutTicks: ips.NewEpochTimeoutTicks,
+		BufferSize:           ips.BufferSize,
+	}
+}
+
+func initialParametersSpec(initParms *pb.StateEvent_InitialParameters) InitialParametersSpec {
+	return InitialParametersSpec{
+		BatchSize:            initParms.BatchSize,
+		HeartbeatTicks:       initParms.HeartbeatTicks,
+		SuspectTicks:         initParms.SuspectTicks,
+		NewEpochTimeoutTicks: initParms.NewEpochTimeoutTicks,
+		BufferSize:           initParms.BufferSize,
+	}
+}
+
+func runtimeParametersSpec(runtimeParms *RuntimeParameters) RuntimeParametersSpec {
+	rps := RuntimeParametersSpec{
+		TickInterval:         runtimeParms.TickInterval,
+		LinkLatency:          runtimeParms.LinkLatency,
+		ReadyLatency:         runtimeParms.ReadyLatency,
+		ProcessLatency:       runtimeParms.ProcessLatency,
+		ClientProcessLatency: runtimeParms.ClientProcessLatency,
+		PersistLatency:       runtimeParms.PersistLatency,
+		WALReadDelay:         runtimeParms.WALReadDelay,
+		ReqReadDelay:         runtimeParms.ReqReadDelay,
+		StateTransferLatency: runtimeParms.StateTransferLatency,
+		TickDrift:            runtimeParms.TickDrift,
+		TickStallPercent:     runtimeParms.TickStallPercent,
+		TickStallDuration:    runtimeParms.TickStallDuration,
+		PersistBandwidth:     runtimeParms.PersistBandwidth,
+		LinkBandwidth:        runtimeParms.LinkBandwidth,
+		HashBandwidth:        runtimeParms.HashBandwidth,
+	}
+
+	if runtimeParms.StorageFaults != nil {
+		rps.StorageFaults = &StorageFaultsSpec{
+			LoseUnsynced:    runtimeParms.StorageFaults.LoseUnsynced,
+			TearFinal:       runtimeParms.StorageFaults.TearFinal,
+			MissingRequests: runtimeParms.StorageFaults.MissingRequests,
+		}
+	}
+
+	if runtimeParms.LinkProfiles != nil {
+		rps.LinkProfiles = map[uint64]*LinkProfileSpec{}
+		for target, profile := range runtimeParms.LinkProfiles {
+			rps.LinkProfiles[target] = &LinkProfileSpec{
+				Latency:   profile.Latency,
+				Bandwidth: profile.Bandwidth,
+			}
+		}
+	}
+
+	return rps
+}
+
+func (rps *RuntimeParametersSpec) runtimeParameters() *RuntimeParameters {
+	runtimeParms := &RuntimeParameters{
+		TickInterval:         rps.TickInterval,
+		LinkLatency:          rps.LinkLatency,
+		ReadyLatency:         rps.ReadyLatency,
+		ProcessLatency:       rps.ProcessLatency,
+		ClientProcessLatency: rps.ClientProcessLatency,
+		PersistLatency:       rps.PersistLatency,
+		WALReadDelay:         rps.WALReadDelay,
+		ReqReadDelay:         rps.ReqReadDelay,
+		StateTransferLatency: rps.StateTransferLatency,
+		TickDrift:            rps.TickDrift,
+		TickStallPercent:     rps.TickStallPercent,
+		TickStallDuration:    rps.TickStallDuration,
+		PersistBandwidth:     rps.PersistBandwidth,
+		LinkBandwidth:        rps.LinkBandwidth,
+		HashBandwidth:        rps.HashBandwidth,
+	}
+
+	if rps.StorageFaults != nil {
+		runtimeParms.StorageFaults = &StorageFaults{
+			LoseUnsynced:    rps.StorageFaults.LoseUnsynced,
+			TearFinal:       rps.StorageFaults.TearFinal,
+			MissingRequests: rps.StorageFaults.MissingRequests,
+		}
+	}
+
+	if rps.LinkProfiles != nil {
+		runtimeParms.LinkProfiles = map[uint64]*LinkProfile{}
+		for target, profile := range rps.LinkProfiles {
+			runtimeParms.LinkProfiles[target] = &LinkProfile{
+				Latency:   profile.Latency,
+				Bandwidth: profile.Bandwidth,
+			}
+		}
+	}
+
+	return runtimeParms
+}
+
+// override decodes the base parameters, then the given subset of them, into
+// result, which must be empty so that it shares no maps with the base.
+func override(overrides map[string]interface{}, base, result interface{}) error {
+	data, err := yaml.Marshal(base)
+	if err != nil {
+		return err
+	}
+
+	if err := decodeStrict(data, result); err != nil {
+		return err
+	}
+
+	data, err = yaml.Marshal(overrides)
+	if err != nil {
+		return err
+	}
+
+	return decodeStrict(data, result)
+}
+
+// decodeStrict decodes the YAML (or JSON) data into out, rejecting any
+// fields which out does not have.  Empty data leaves out unchanged.
+func decodeStrict(data []byte, out interface{}) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(out); err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
+func (rs *ReconfigPointSpec) reconfigPoint(config *pb.NetworkState_Config) (*ReconfigPoint, error) {
+	reconfigPoint := &ReconfigPoint{
+		ClientID: rs.Client,
+		ReqNo:    rs.ReqNo,
+	}
+
+	var reconfiguration *pb.Reconfiguration
+	count := 0
+	if rs.NewClient != nil {
+		count++
+		reconfiguration = &pb.Reconfiguration{
+			Type: &pb.Reconfiguration_NewClient_{
+				NewClient: &pb.Reconfiguration_NewClient{
+					Id:    rs.NewClient.ID,
+					Width: rs.NewClient.Width,
+				},
+			},
+		}
+	}
+	if rs.RemoveClient != nil {
+		count++
+		reconfiguration = &pb.Reconfiguration{
+			Type: &pb.Reconfiguration_RemoveClient{
+				RemoveClient: *rs.RemoveClient,
+			},
+		}
+	}
+	if rs.NewConfig != nil {
+		count++
+		newConfig := proto.Clone(config).(*pb.NetworkState_Config)
+		rs.NewConfig.apply(newConfig)
+		reconfiguration = &pb.Reconfiguration{
+			Type: &pb.Reconfiguration_NewConfig{
+				NewConfig: newConfig,
+			},
+		}
+	}
+
+	if count != 1 {
+		return nil, errors.Errorf("reconfiguration must set exactly one of newClient, removeClient, or newConfig")
+	}
+
+	reconfigPoint.Reconfiguration = reconfiguration
+	return reconfigPoint, nil
+}
+
+var msgTypes = (&pb.Msg{}).ProtoReflect().Descriptor().Oneofs().ByName("type")
+
+// msgTypeName returns the name of the type of the message, for instance,
+// 'preprepare' or 'newEpochEcho'.  The name is that of the message's field
+// rather than of its proto type, as several fields share a type.
+func msgTypeName(msg *pb.Msg) string {
+	fd := msg.ProtoReflect().WhichOneof(msgTypes)
+	if fd == nil {
+		return ""
+	}
+	return fd.JSONName()
+}
+
+func validMsgTypeName(name string) bool {
+	fields := msgTypes.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if fields.Get(i).JSONName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// msgMatcher selects the messages a message fault applies to.
+func (fs *FaultSpec) msgMatcher() (MangleMatcher, error) {
+	for _, msgType := range fs.Types {
+		if !validMsgTypeName(msgType) {
+			return nil, errors.Errorf("unknown message type '%s'", msgType)
+		}
+	}
+
+	matching := MatchMsgs()
+	if fs.From != nil {
+		matching = matching.FromNodes(fs.From...)
+	}
+	if fs.To != nil {
+		matching = matching.ToNodes(fs.To...)
+	}
+	if fs.Percent != 0 {
+		matching = matching.AtPercent(fs.Percent)
+	}
+
+	return InlineMatcher(func(random int, event *rpb.RecordedEvent) bool {
+		if !matching.Matches(random, event) {
+			return false
+		}
+
+		step := event.StateEvent.GetStep()
+		if step.Source == event.NodeId {
+			return false
+		}
+
+		if fs.Types == nil {
+			return true
+		}
+
+		msgType := msgTypeName(step.Msg)
+		for _, t := range fs.Types {
+			if t == msgType {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// mangler returns the mangler for the fault, the window of the fault is
+// applied by the schedule.
+func (fs *FaultSpec) mangler(nodeConfigs []*RecorderNodeConfig) (Mangler, error) {
+	var manglers []Mangler
+
+	if fs.Drop || fs.Jitter != 0 || fs.Duplicate != 0 || fs.Delay != 0 {
+		matcher, err := fs.msgMatcher()
+		if err != nil {
+			return nil, err
+		}
+		mangling := For(matcher)
+
+		if fs.Drop {
+			manglers = append(manglers, mangling.Drop())
+		}
+		if fs.Jitter != 0 {
+			manglers = append(manglers, mangling.Jitter(fs.Jitter))
+		}
+		if fs.Duplicate != 0 {
+			manglers = append(manglers, mangling.Duplicate(fs.Duplicate))
+		}
+		if fs.Delay != 0 {
+			manglers = append(manglers, mangling.Delay(fs.Delay))
+		}
+	} else if fs.From != nil || fs.To != nil || fs.Types != nil || fs.Percent != 0 {
+		return nil, errors.Errorf("from, to, types, and percent apply only to drop, jitter, duplicate, and delay faults")
+	}
+
+	if fs.Partition != nil {
+		manglers = append(manglers, &PartitionMangler{Groups: fs.Partition})
+	}
+
+	if fs.FailLink != nil {
+		manglers = append(manglers, &LinkFailureMangler{From: fs.FailLink.From, To: fs.FailLink.To})
+	}
+
+	if fs.Crash != nil {
+		if fs.Crash.Node >= uint64(len(nodeConfigs)) {
+			return nil, errors.Errorf("cannot crash unknown node %d", fs.Crash.Node)
+		}
+
+		var matcher MangleMatcher
+		if fs.Crash.SeqNo != 0 {
+			matcher = MatchMsgs().ToNode(fs.Crash.Node).FromSelf().OfTypeCheckpoint().WithSequence(fs.Crash.SeqNo)
+		} else {
+			crashed := false
+			matcher = InlineMatcher(func(random int, event *rpb.RecordedEvent) bool {
+				if crashed || event.NodeId != fs.Crash.Node {
+					return false
+				}
+				crashed = true
+				return true
+			})
+		}
+
+		manglers = append(manglers, For(matcher).CrashAndRestartAfter(fs.Crash.RestartDelay, nodeConfigs[fs.Crash.Node].InitParms))
+	}
+
+	if fs.Byzantine != nil {
+		mangling := For(MatchMsgs().FromNode(fs.Byzantine.Node))
+		switch fs.Byzantine.Behavior {
+		case "equivocate":
+			manglers = append(manglers, mangling.Equivocate(fs.Byzantine.Targets...))
+		case "corruptDigests":
+			manglers = append(manglers, mangling.CorruptDigests())
+		case "forgeCheckpoints":
+			manglers = append(manglers, mangling.ForgeCheckpoints())
+		case "malformEpochChanges":
+			manglers = append(manglers, mangling.MalformEpochChanges())
+		case "forgeNewEpochs":
+			manglers = append(manglers, mangling.ForgeNewEpochs())
+		case "spamAcks":
+			manglers = append(manglers, mangling.SpamAcks(fs.Byzantine.Count))
+		default:
+			return nil, errors.Errorf("unknown byzantine behavior '%s'", fs.Byzantine.Behavior)
+		}
+	}
+
+	if len(manglers) != 1 {
+		return nil, errors.Errorf("fault must be exactly one of drop, jitter, duplicate, delay, partition, failLink, crash, or byzantine")
+	}
+
+	return manglers[0], nil
+}
+
+// Recorder constructs a recorder for the scenario.  Because recorders, and
+// many manglers, hold state, a new recorder must be constructed for every run.
+func (s *ScenarioSpec) Recorder() (*Recorder, error) {
+	networkState := mirbft.StandardInitialNetworkState(s.Nodes, s.Clients.Count)
+	s.Network.apply(networkState.Config)
+
+	recorder := &Recorder{
+		NetworkState:         networkState,
+		LogOutput:            ioutil.Discard,
+		Hasher:               sha256.New,
+		RandomSeed:           s.Seed,
+		ProgressTicks:        s.ProgressTicks,
+		GracefulEpochChanges: s.GracefulEpochChanges,
+	}
+
+	for _, nodeOverride := range s.NodeOverrides {
+		if nodeOverride.Node >= uint64(s.Nodes) {
+			return nil, errors.Errorf("cannot override parameters of unknown node %d", nodeOverride.Node)
+		}
+	}
+
+	for i := 0; i < s.Nodes; i++ {
+		initialParms := s.InitialParameters
+		runtimeParms := s.RuntimeParameters
+
+		for _, nodeOverride := range s.NodeOverrides {
+			if nodeOverride.Node != uint64(i) {
+				continue
+			}
+
+			overriddenInitialParms := InitialParametersSpec{}
+			if err := override(nodeOverride.InitialParameters, initialParms, &overriddenInitialParms); err != nil {
+				return nil, errors.WithMessagef(err, "invalid initial parameters for node %d", i)
+			}
+			initialParms = overriddenInitialParms
+
+			overriddenRuntimeParms := RuntimeParametersSpec{}
+			if err := override(nodeOverride.RuntimeParameters, runtimeParms, &overriddenRuntimeParms); err != nil {
+				return nil, errors.WithMessagef(err, "invalid runtime parameters for node %d", i)
+			}
+			runtimeParms = overriddenRuntimeParms
+		}
+
+		recorder.RecorderNodeConfigs = append(recorder.RecorderNodeConfigs, &RecorderNodeConfig{
+			InitParms:    initialParms.initialParameters(uint64(i)),
+			RuntimeParms: runtimeParms.runtimeParameters(),
+		})
+	}
+
+	maxInFlight := s.Clients.MaxInFlight
+	if maxInFlight == 0 {
+		maxInFlight = int(recorder.NetworkState.Config.CheckpointInterval / 2)
+	}
+
+	for _, client := range recorder.NetworkState.Clients {
+		recorder.ClientConfigs = append(recorder.ClientConfigs, &ClientConfig{
+			ID:              client.Id,
+			MaxInFlight:     maxInFlight,
+			Total:           s.Clients.Requests,
+			RequestInterval: s.Clients.RequestInterval,
+			RequestSize:     s.Clients.RequestSize,
+		})
+	}
+
+	for i, reconfiguration := range s.Reconfigurations {
+		reconfigPoint, err := reconfiguration.reconfigPoint(recorder.NetworkState.Config)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "invalid reconfiguration %d", i)
+		}
+		recorder.ReconfigPoints = append(recorder.ReconfigPoints, reconfigPoint)
+	}
+
+	var schedule FaultSchedule
+	for i, fault := range s.Faults {
+		mangler, err := fault.mangler(recorder.RecorderNodeConfigs)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "invalid fault %d", i)
+		}
+
+		schedule = append(schedule, ScheduledFault{
+			Start: fault.Start,
+			End:   fault.End,
+			Fault: mangler,
+		})
+	}
+
+	if schedule != nil {
+		recorder.Mangler = schedule
+	}
+
+	return recorder, nil
+}
+
+// ScenarioResult is the outcome of running a scenario.
+type ScenarioResult struct {
+	Recording *Recording
+
+	// Err is the error with which the scenario failed, if any.
+	Err error
+}
+
+// Run executes the scenario, writing its event log to output, and checks
+// the outcome against the scenario's expectations.  The outcome is returned
+// even if it is not as expected.
+func (s *ScenarioSpec) Run(output io.Writer) (*ScenarioResult, error) {
+	recorder, err := s.Recorder()
+	if err != nil {
+		return nil, err
+	}
+
+	recording, runErr := drain(recorder, s.Timeout, output)
+	if recording == nil {
+		return nil, runErr
+	}
+
+	result := &ScenarioResult{
+		Recording: recording,
+		Err:       runErr,
+	}
+
+	return result, s.Expect.check(result)
+}
+
+func (es *ExpectSpec) check(result *ScenarioResult) error {
+	switch {
+	case es.Failure == "" && result.Err != nil:
+		return errors.WithMessage(result.Err, "expected scenario to succeed")
+	case es.Failure != "" && result.Err == nil:
+		return errors.Errorf("expected scenario to fail with '%s', but it succeeded", es.Failure)
+	case es.Failure != "" && !strings.Contains(result.Err.Error(), es.Failure):
+		return errors.Errorf("expected scenario to fail with '%s', but it failed with: %s", es.Failure, result.Err)
+	}
+
+	recording := result.Recording
+	switch {
+	case es.Events != 0 && recording.EventIndex != es.Events:
+		return errors.Errorf("expected %d events, but the scenario executed %d", es.Events, recording.EventIndex)
+	case es.MinTime != 0 && recording.EventLog.FakeTime < es.MinTime:
+		return errors.Errorf("expected the scenario to end no earlier than %d, but it ended at %d", es.MinTime, recording.EventLog.FakeTime)
+	case es.MaxTime != 0 && recording.EventLog.FakeTime > es.MaxTime:
+		return errors.Errorf("expected the scenario to end no later than %d, but it ended at %d", es.MaxTime, recording.EventLog.FakeTime)
+	}
+
+	if es.Epoch != 0 {
+		for _, node := range recording.Nodes {
+			epoch := node.PlaybackNode.Status.EpochTracker.LastActiveEpoch
+			if epoch != es.Epoch {
+				return errors.Errorf("expected node %d to be in epoch %d, but it is in epoch %d", node.Config.InitParms.Id, es.Epoch, epoch)
+			}
+		}
+	}
+
+	for _, nodeID := range es.StateTransfers {
+		if nodeID >= uint64(len(recording.Nodes)) {
+			return errors.Errorf("expected unknown node %d to transfer state", nodeID)
+		}
+
+		if recording.Nodes[nodeID].StateTransfers == 0 {
+			return errors.Errorf("expected node %d to transfer state, but it never did", nodeID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testengine_test
+
+import (
+	"bytes"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	pb "github.com/IBM/mirbft/mirbftpb"
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+	"github.com/IBM/mirbft/pkg/testengine"
+)
+
+var _ = Describe("ScenarioSpec", func() {
+	It("defaults to the parameters of the basic recorder", func() {
+		spec, err := testengine.ParseScenarioSpec([]byte("nodes: 4\nclients: {count: 2, requests: 10}\n"))
+		Expect(err).NotTo(HaveOccurred())
+
+		recorder, err := spec.Recorder()
+		Expect(err).NotTo(HaveOccurred())
+
+		basic := testengine.BasicRecorder(4, 2, 10)
+		Expect(recorder.NetworkState).To(Equal(basic.NetworkState))
+		Expect(recorder.ClientConfigs).To(Equal(basic.ClientConfigs))
+		Expect(recorder.RecorderNodeConfigs).To(Equal(basic.RecorderNodeConfigs))
+		Expect(recorder.Mangler).To(BeNil())
+		Expect(spec.Timeout).To(Equal(100000))
+	})
+
+	It("overrides the parameters of individual nodes", func() {
+		spec, err := testengine.ParseScenarioSpec([]byte(`
+nodes: 4
+network: {checkpointInterval: 10}
+initialParameters: {batchSize: 3}
+runtimeParameters:
+  linkLatency: 50
+  linkProfiles:
+    2: {latency: 200}
+nodeOverrides:
+  - node: 1
+    initialParameters: {suspectTicks: 6}
+    runtimeParameters:
+      processLatency: 30
+      linkProfiles:
+        0: {latency: 300, bandwidth: 10}
+`))
+		Expect(err).NotTo(HaveOccurred())
+
+		recorder, err := spec.Recorder()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.NetworkState.Config.CheckpointInterval).To(Equal(int32(10)))
+
+		configs := recorder.RecorderNodeConfigs
+		Expect(configs[0].InitParms.BatchSize).To(Equal(uint32(3)))
+		Expect(configs[0].InitParms.SuspectTicks).To(Equal(uint32(4)))
+		Expect(configs[0].RuntimeParms.LinkLatency).To(Equal(50))
+		Expect(configs[0].RuntimeParms.ProcessLatency).To(Equal(10))
+		Expect(configs[0].RuntimeParms.LinkProfiles).To(Equal(map[uint64]*testengine.LinkProfile{
+			2: {Latency: 200},
+		}))
+
+		Expect(configs[1].InitParms).To(Equal(&pb.StateEvent_InitialParameters{
+			Id:                   1,
+			BatchSize:            3,
+			HeartbeatTicks:       2,
+			SuspectTicks:         6,
+			NewEpochTimeoutTicks: 8,
+			BufferSize:           5 * 1024 * 1024,
+		}))
+		Expect(configs[1].RuntimeParms.LinkLatency).To(Equal(50))
+		Expect(configs[1].RuntimeParms.ProcessLatency).To(Equal(30))
+		Expect(configs[1].RuntimeParms.LinkProfiles).To(Equal(map[uint64]*testengine.LinkProfile{
+			0: {Latency: 300, Bandwidth: 10},
+			2: {Latency: 200},
+		}))
+		Expect(configs[2].RuntimeParms.LinkProfiles).To(HaveLen(1))
+	})
+
+	It("builds reconfiguration points", func() {
+		spec, err := testengine.ReadScenarioSpec("testdata/scenarios/reconfiguration.yaml")
+		Expect(err).NotTo(HaveOccurred())
+
+		recorder, err := spec.Recorder()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.ReconfigPoints).To(HaveLen(2))
+		Expect(recorder.ReconfigPoints[0].ClientID).To(Equal(uint64(0)))
+		Expect(recorder.ReconfigPoints[0].ReqNo).To(Equal(uint64(5)))
+		Expect(recorder.ReconfigPoints[0].Reconfiguration.GetNewClient()).To(Equal(&pb.Reconfiguration_NewClient{
+			Id:    10,
+			Width: 100,
+		}))
+
+		newConfig := recorder.ReconfigPoints[1].Reconfiguration.GetNewConfig()
+		Expect(newConfig.CheckpointInterval).To(Equal(int32(40)))
+		Expect(newConfig.Nodes).To(Equal(recorder.NetworkState.Config.Nodes))
+		Expect(recorder.NetworkState.Config.CheckpointInterval).To(Equal(int32(20)))
+	})
+
+	It("rejects unknown fields", func() {
+		_, err := testengine.ParseScenarioSpec([]byte("nodes: 4\nclient: {count: 2}\n"))
+		Expect(err).To(MatchError(ContainSubstring("field client not found")))
+
+		spec, err := testengine.ParseScenarioSpec([]byte("nodes: 4\nnodeOverrides: [{node: 2, runtimeParameters: {latency: 3}}]\n"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = spec.Recorder()
+		Expect(err).To(MatchError(ContainSubstring("invalid runtime parameters for node 2")))
+	})
+
+	It("rejects invalid faults", func() {
+		for _, fault := range []string{
+			"{drop: true, jitter: 10}",
+			"{from: [1]}",
+			"{drop: true, types: [preprepared]}",
+			"{byzantine: {node: 1, behavior: lie}}",
+			"{crash: {node: 4}}",
+		} {
+			spec, err := testengine.ParseScenarioSpec([]byte("nodes: 4\nfaults: [" + fault + "]\n"))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = spec.Recorder()
+			Expect(err).To(MatchError(ContainSubstring("invalid fault 0")), fault)
+		}
+	})
+
+	It("applies message faults to the given types of messages", func() {
+		spec, err := testengine.ParseScenarioSpec([]byte(`
+nodes: 4
+clients: {count: 1, requests: 10}
+faults: [{types: [prepare, newEpochEcho], from: [1], drop: true}]
+`))
+		Expect(err).NotTo(HaveOccurred())
+
+		output := &bytes.Buffer{}
+		_, err = spec.Run(output)
+		Expect(err).NotTo(HaveOccurred())
+
+		eventLog, err := testengine.ReadEventLog(output)
+		Expect(err).NotTo(HaveOccurred())
+
+		prepares, commits := 0, 0
+		for el := eventLog.List.Front(); el != nil; el = el.Next() {
+			event := el.Value.(*rpb.RecordedEvent)
+			step := event.StateEvent.GetStep()
+			if step == nil || step.Source != 1 || event.NodeId == 1 {
+				continue
+			}
+			if step.Msg.GetPrepare() != nil {
+				prepares++
+			}
+			if step.Msg.GetCommit() != nil {
+				commits++
+			}
+		}
+		Expect(prepares).To(BeZero())
+		Expect(commits).NotTo(BeZero())
+	})
+
+	It("fails when the outcome is not as expected", func() {
+		spec, err := testengine.ParseScenarioSpec([]byte(`
+nodes: 1
+clients: {count: 1, requests: 5}
+expect: {maxTime: 100}
+`))
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := spec.Run(&bytes.Buffer{})
+		Expect(err).To(MatchError(ContainSubstring("expected the scenario to end no later than 100")))
+		Expect(result.Err).NotTo(HaveOccurred())
+	})
+
+	scenarios, err := filepath.Glob("testdata/scenarios/*")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, path := range scenarios {
+		path := path
+		It("runs "+path+" to the expected outcome", func() {
+			spec, err := testengine.ReadScenarioSpec(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			output := &bytes.Buffer{}
+			result, err := spec.Run(output)
+			Expect(err).NotTo(HaveOccurred())
+
+			eventLog, err := testengine.ReadEventLog(output)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uint64(eventLog.List.Len())).To(Equal(result.Recording.EventIndex))
+		})
+	}
+})
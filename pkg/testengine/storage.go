@@ -0,0 +1,123 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package testengine
+
+import (
+	rpb "github.com/IBM/mirbft/pkg/eventlog/recorderpb"
+)
+
+// StorageFaults describes how a node's storage fails when the node crashes.
+// The faults are applied each time the node restarts, before it loads its
+// write-ahead log.
+type StorageFaults struct {
+	// LoseUnsynced discards the write-ahead log appends which the node's
+	// disk had not yet synced when the node crashed.  Appends are synced
+	// once the node's persist delay has elapsed, and, as the messages which
+	// depend on them are sent only after they sync, those messages are never
+	// sent either.  The bootstrap entries of a new node's log are synced one
+	// persist delay after it first starts, so a crash before then loses the
+	// entire log, and the node cannot restart.
+	LoseUnsynced bool
+
+	// TearFinal tears the final entry of the write-ahead log, as when a
+	// crash interrupts writing it.  The write-ahead log detects the torn
+	// entry on restart, and discards it, even if the node had already sent
+	// messages which depend on it.
+	TearFinal bool
+
+	// MissingRequests is the number of the most recently stored requests
+	// which are missing from the node's request store after it restarts.
+	// The clients, having already received the node's acks for these
+	// requests, do not resubmit them.
+	MissingRequests int
+}
+
+// unsyncedAppends are the write-ahead log appends of a single batch of
+// actions, beginning at index, along with the messages sent once they sync.
+type unsyncedAppends struct {
+	syncedAt int64
+	index    uint64
+	sends    []*rpb.RecordedEvent
+}
+
+// trackUnsynced records the appends of a batch of actions, and forgets any
+// earlier appends which have since synced.
+func (rn *RecorderNode) trackUnsynced(now int64, appends *unsyncedAppends) {
+	i := 0
+	for ; i < len(rn.unsynced); i++ {
+		if rn.unsynced[i].syncedAt > now {
+			break
+		}
+	}
+	rn.unsynced = append(rn.unsynced[i:], appends)
+}
+
+// failStorage applies the node's storage faults as it restarts after a crash.
+func (rn *RecorderNode) failStorage(eventLog *EventLog) {
+	faults := rn.Config.RuntimeParms.StorageFaults
+	unsynced := rn.unsynced
+	rn.unsynced = nil
+
+	entries := rn.WAL.List.Len()
+	defer func() {
+		rn.LostEntries += entries - rn.WAL.List.Len()
+	}()
+
+	if faults.LoseUnsynced {
+		truncated := false
+		lost := map[*rpb.RecordedEvent]struct{}{}
+		for _, appends := range unsynced {
+			if appends.syncedAt <= eventLog.FakeTime {
+				continue
+			}
+
+			if !truncated {
+				// The log is lost from the first unsynced append,
+				// but truncations are treated as synced immediately,
+				// so the first remaining entry is kept, unless the
+				// entire log is unsynced, as when the node crashes
+				// before its bootstrap entries sync.
+				switch {
+				case appends.index == rn.WAL.LowIndex:
+					rn.WAL.List.Init()
+				case appends.index < rn.WAL.LowIndex:
+					rn.WAL.TruncateBack(rn.WAL.LowIndex)
+				default:
+					rn.WAL.TruncateBack(appends.index - 1)
+				}
+				truncated = true
+			}
+
+			for _, send := range appends.sends {
+				lost[send] = struct{}{}
+			}
+		}
+
+		el := eventLog.List.Front()
+		for el != nil {
+			x := el
+			el = el.Next()
+			if _, ok := lost[x.Value.(*rpb.RecordedEvent)]; ok {
+				eventLog.List.Remove(x)
+			}
+		}
+	}
+
+	if faults.TearFinal && rn.WAL.List.Len() > 1 {
+		rn.WAL.TruncateBack(rn.WAL.LowIndex + uint64(rn.WAL.List.Len()) - 2)
+	}
+
+	if faults.MissingRequests > 0 {
+		if rn.lostRequests == nil {
+			rn.lostRequests = map[requestID]struct{}{}
+		}
+
+		for _, ack := range rn.ReqStore.Lose(faults.MissingRequests) {
+			rn.lostRequests[requestID{clientID: ack.ClientId, reqNo: ack.ReqNo}] = struct{}{}
+		}
+	}
+}
@@ -48,25 +48,52 @@ type WAL interface {
 // hash and checkpoint results.  Because these operations include IO and are
 // blocking, this base implementation is most suitable for test or resource
 // constrained environments.
+//
+// If RequestStore is set, then whenever the state machine truncates the WAL
+// (which it does only once a checkpoint is stable), the requests which
+// committed prior to that checkpoint are removed from the RequestStore.
 type Processor struct {
-	Link   Link
-	Hasher Hasher
-	Log    Log
-	WAL    WAL
-	Node   *Node
+	Link         Link
+	Hasher       Hasher
+	Log          Log
+	WAL          WAL
+	RequestStore RequestStore
+	Node         *Node
+
+	// walCheckpoints are the CEntries which have been written to
+	// the WAL, but not yet truncated from it, in index order.
+	walCheckpoints []walCheckpoint
 }
 
-func (p *Processor) Process(actions *Actions) *ActionResults {
-	// Persist
-	for _, write := range actions.WriteAhead {
+type walCheckpoint struct {
+	index   uint64
+	clients []*pb.NetworkState_Client
+}
+
+// persist performs the WAL writes and truncations, then syncs the WAL.  Once
+// the WAL is synced, any truncations are reflected into the RequestStore.
+func (p *Processor) persist(writeAhead []*Write) {
+	var truncatedTo *walCheckpoint
+	for _, write := range writeAhead {
 		if write.Truncate != nil {
 			if err := p.WAL.Truncate(*write.Truncate); err != nil {
 				panic(fmt.Sprintf("could truncate WAL, not safe to continue: %s", err))
 			}
+
+			if cp := p.truncateCheckpoints(*write.Truncate); cp != nil {
+				truncatedTo = cp
+			}
 		} else {
 			if err := p.WAL.Write(write.Append.Index, write.Append.Data); err != nil {
 				panic(fmt.Sprintf("could not persist entry, not safe to continue: %s", err))
 			}
+
+			if cEntry, ok := write.Append.Data.Type.(*pb.Persistent_CEntry); ok {
+				p.walCheckpoints = append(p.walCheckpoints, walCheckpoint{
+					index:   write.Append.Index,
+					clients: cEntry.CEntry.NetworkState.Clients,
+				})
+			}
 		}
 	}
 
@@ -74,6 +101,59 @@ func (p *Processor) Process(actions *Actions) *ActionResults {
 		panic(fmt.Sprintf("could not sync WAL, not safe to continue: %s", err))
 	}
 
+	if truncatedTo == nil || p.RequestStore == nil {
+		return
+	}
+
+	// Unlike the WAL operations, failing to truncate the request store does
+	// not affect safety.  Because truncation removes every record below the
+	// low watermark, anything left behind (for instance because the store is
+	// shutting down) is removed at the next stable checkpoint.
+	for _, client := range truncatedTo.clients {
+		if err := p.RequestStore.Truncate(client.Id, client.LowWatermark); err != nil {
+			p.logger().Log(LevelWarn, "could not truncate request store", "client_id", client.Id, "low_watermark", client.LowWatermark, "err", err)
+			return
+		}
+	}
+}
+
+func (p *Processor) logger() Logger {
+	if p.Node == nil || p.Node.Config.Logger == nil {
+		return ConsoleWarnLogger
+	}
+	return p.Node.Config.Logger
+}
+
+// truncateCheckpoints discards the tracked checkpoints which are no longer in
+// the WAL after truncating to the given index, and returns the most recent
+// checkpoint at or below that index.  The state machine truncates to the
+// CEntry of the new stable checkpoint, but in the event that the checkpoint
+// was not written via this processor (for instance, it was loaded at startup)
+// the most recent older checkpoint is returned instead, or nil if there is none.
+func (p *Processor) truncateCheckpoints(index uint64) *walCheckpoint {
+	var result *walCheckpoint
+	i := 0
+	for ; i < len(p.walCheckpoints); i++ {
+		if p.walCheckpoints[i].index > index {
+			break
+		}
+		result = &p.walCheckpoints[i]
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	// Keep the checkpoint we truncated to, as it remains in the WAL.
+	truncated := *result
+	p.walCheckpoints = append([]walCheckpoint{truncated}, p.walCheckpoints[i:]...)
+	return &truncated
+}
+
+func (p *Processor) Process(actions *Actions) *ActionResults {
+	// Persist
+	p.persist(actions.WriteAhead)
+
 	// Transmit
 	for _, send := range actions.Send {
 		for _, replica := range send.Targets {
@@ -176,20 +256,7 @@ func (wp *ProcessorWorkPool) persistThenSendInParallel(
 	// Next, begin persisting the WAL, plus any pending requests, once done,
 	// send the other protocol messages
 	go func() {
-		for _, write := range writeAhead {
-			if write.Truncate != nil {
-				if err := wp.processor.WAL.Truncate(*write.Truncate); err != nil {
-					panic(fmt.Sprintf("could truncate WAL, not safe to continue: %s", err))
-				}
-			} else {
-				if err := wp.processor.WAL.Write(write.Append.Index, write.Append.Data); err != nil {
-					panic(fmt.Sprintf("could not persist entry, not safe to continue: %s", err))
-				}
-			}
-		}
-		if err := wp.processor.WAL.Sync(); err != nil {
-			panic(fmt.Sprintf("could not sync WAL: %s", err))
-		}
+		wp.processor.persist(writeAhead)
 
 		for _, send := range sends {
 			select {
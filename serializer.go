@@ -118,7 +118,16 @@ func (s *serializer) run() (exitErr error) {
 			}
 		}
 
-		newActions, newClientActions := toActions(sm.ApplyEvent(stateEvent))
+		result := sm.ApplyEvent(stateEvent)
+
+		if resultInterceptor, ok := s.myConfig.EventInterceptor.(ResultInterceptor); ok {
+			err := resultInterceptor.InterceptResult(stateEvent, result)
+			if err != nil {
+				return errors.WithMessage(err, "result interceptor error")
+			}
+		}
+
+		newActions, newClientActions := toActions(result)
 
 		actions.concat(newActions)
 		clientActions.concat(newClientActions)
@@ -141,6 +150,10 @@ func (s *serializer) run() (exitErr error) {
 		return err
 	}
 
+	// The client states of the most recent checkpoint in the WAL are
+	// handed to the client processing for recovery.
+	var recoverClients []*pb.NetworkState_Client
+
 	err = s.walStorage.LoadAll(func(i uint64, p *pb.Persistent) {
 		if _, ok := s.walStorage.(*dummyWAL); ok {
 			// This was our own startup/bootstrap WAL,
@@ -148,6 +161,10 @@ func (s *serializer) run() (exitErr error) {
 			actions.persist(i, p)
 		}
 
+		if cEntry, ok := p.Type.(*pb.Persistent_CEntry); ok {
+			recoverClients = cEntry.CEntry.NetworkState.Clients
+		}
+
 		applyEvent(&pb.StateEvent{
 			Type: &pb.StateEvent_LoadEntry{
 				LoadEntry: &pb.StateEvent_PersistedEntry{
@@ -162,6 +179,8 @@ func (s *serializer) run() (exitErr error) {
 		return errors.WithMessage(err, "failed to load persisted from WALStorage")
 	}
 
+	clientActions.RecoverClients = recoverClients
+
 	err = applyEvent(&pb.StateEvent{
 		Type: &pb.StateEvent_CompleteInitialization{
 			CompleteInitialization: &pb.StateEvent_LoadCompleted{},